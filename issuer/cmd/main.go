@@ -8,16 +8,17 @@ import (
 )
 
 func main() {
-	var fileName string
+	var fileName, backupFile string
 	flag.StringVar(&fileName, "cfg-file", "", "alternative path to the cfg file")
+	flag.StringVar(&backupFile, "import-backup", "", "path to an identity backup to import into the empty DB")
 	flag.Parse()
 
-	if err := run(fileName); err != nil {
+	if err := run(fileName, backupFile); err != nil {
 		fmt.Fprintf(os.Stdout, "%s\n", err)
 		os.Exit(1)
 	}
 }
 
-func run(fileName string) error {
-	return service.CreateApp(fileName)
+func run(fileName, backupFile string) error {
+	return service.CreateApp(fileName, backupFile)
 }
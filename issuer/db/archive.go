@@ -0,0 +1,53 @@
+package db
+
+import (
+	"github.com/google/uuid"
+	logger "github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+// ArchiveBucketName holds the claim rows moved out of the claims bucket. Only the rows are archived,
+// the tree nodes of the claims stay in place so the proofs against published states keep working.
+var ArchiveBucketName = []byte("claims_archive")
+
+// ArchiveClaims moves the given claims from the claims bucket to the archive bucket, in a single transaction, and
+// returns the number of archived claims. The claims that aren't in the claims bucket anymore are skipped.
+func (db *DB) ArchiveClaims(ids []uuid.UUID) (int, error) {
+	logger.Tracef("DB: archiving %d claims", len(ids))
+
+	archived := 0
+	err := db.conn.Update(func(tx *bbolt.Tx) error {
+		claims := tx.Bucket(ClaimsBucketName)
+		archive := tx.Bucket(ArchiveBucketName)
+
+		for _, id := range ids {
+			k := claimKey(id)
+			v := claims.Get(k)
+			if v == nil {
+				continue
+			}
+
+			err := archive.Put(k, v)
+			if err != nil {
+				return err
+			}
+			err = claims.Delete(k)
+			if err != nil {
+				return err
+			}
+			archived++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return archived, nil
+}
+
+// getArchivedClaim returns the raw claim from the archive bucket
+func getArchivedClaim(tx *bbolt.Tx, id uuid.UUID) []byte {
+	return tx.Bucket(ArchiveBucketName).Get(claimKey(id))
+}
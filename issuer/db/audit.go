@@ -0,0 +1,135 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	logger "github.com/sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	AuditEventClaimIssued  = "claim_issued"
+	AuditEventClaimRevoked = "claim_revoked"
+	// AuditEventClaimDiscarded records a claim removed before any state holding it was published
+	AuditEventClaimDiscarded = "claim_discarded"
+)
+
+var AuditBucketName = []byte("audit")
+
+// AuditEntry is a single record of the append-only audit log. Each entry carries the hash
+// of its predecessor, so changing or removing an entry breaks the chain from that point on.
+type AuditEntry struct {
+	Seq       uint64
+	Event     string
+	ClaimID   string
+	RevNonce  uint64
+	State     string
+	Timestamp int64
+	PrevHash  string
+	Hash      string
+}
+
+// ComputeHash returns the hex encoded sha256 hash over all the entry fields except Hash
+func (e *AuditEntry) ComputeHash() string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%d|%s|%s|%d|%s|%d|%s",
+		e.Seq, e.Event, e.ClaimID, e.RevNonce, e.State, e.Timestamp, e.PrevHash)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Audit is the audit entry and the event recorded along with a change of a claim, in the transaction of the change
+type Audit struct {
+	Entry *AuditEntry
+	Event *Event
+}
+
+// append appends the entry to the audit log and the event to the event stream, a nil audit records nothing
+func (a *Audit) append(tx *bbolt.Tx) error {
+	if a == nil {
+		return nil
+	}
+	err := appendAuditEntry(tx, a.Entry)
+	if err != nil {
+		return err
+	}
+	return appendEvent(tx, a.Event)
+}
+
+// AppendAuditEntry assigns the next sequence number to the entry, chains it to the last entry of the log and stores it
+func (db *DB) AppendAuditEntry(e *AuditEntry) error {
+	logger.Tracef("DB: appending audit entry for event %s", e.Event)
+
+	return db.conn.Update(func(tx *bbolt.Tx) error {
+		return appendAuditEntry(tx, e)
+	})
+}
+
+func appendAuditEntry(tx *bbolt.Tx, e *AuditEntry) error {
+	b := tx.Bucket(AuditBucketName)
+
+	e.PrevHash = ""
+	if _, v := b.Cursor().Last(); v != nil {
+		last := &AuditEntry{}
+		if err := codec.NewDecoderBytes(v, &jsonHandle).Decode(last); err != nil {
+			return err
+		}
+		e.PrevHash = last.Hash
+	}
+
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	e.Seq = seq
+	e.Hash = e.ComputeHash()
+
+	entryB := make([]byte, 0)
+	if err = codec.NewEncoderBytes(&entryB, &jsonHandle).Encode(e); err != nil {
+		return err
+	}
+
+	return b.Put(seqKey(seq), entryB)
+}
+
+// GetAuditLog returns the whole audit log ordered by sequence number
+func (db *DB) GetAuditLog() ([]*AuditEntry, error) {
+	logger.Trace("DB: getting the audit log")
+
+	res := make([]*AuditEntry, 0)
+
+	return res, db.conn.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(AuditBucketName).ForEach(func(k, v []byte) error {
+			e := &AuditEntry{}
+			if err := codec.NewDecoderBytes(v, &jsonHandle).Decode(e); err != nil {
+				return err
+			}
+
+			res = append(res, e)
+			return nil
+		})
+	})
+}
+
+// VerifyAuditLog checks the hash chain of the given log. It returns the index of the first entry that
+// doesn't match its hash or its predecessor, or -1 if the whole log is consistent.
+func VerifyAuditLog(entries []*AuditEntry) int {
+	prevHash := ""
+	for i, e := range entries {
+		if e.Seq != uint64(i+1) || e.PrevHash != prevHash || e.ComputeHash() != e.Hash {
+			return i
+		}
+		prevHash = e.Hash
+	}
+
+	return -1
+}
+
+// seqKey encodes a sequence number as a big-endian key so bbolt keeps the entries in order
+func seqKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"errors"
+
+	logger "github.com/sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+	"go.etcd.io/bbolt"
+	"issuer/service/claim"
+)
+
+// ClaimRows are the raw rows of the claims bucket and the archive bucket, as they are stored
+type ClaimRows struct {
+	Claims   [][]byte
+	Archived [][]byte
+}
+
+// GetClaimRows returns the raw rows of all the claims, the archived ones included, in a single read transaction
+func (db *DB) GetClaimRows() (*ClaimRows, error) {
+	logger.Trace("DB: getting all the claim rows")
+
+	rows := &ClaimRows{}
+	err := db.conn.View(func(tx *bbolt.Tx) error {
+		err := tx.Bucket(ClaimsBucketName).ForEach(func(k, v []byte) error {
+			rows.Claims = append(rows.Claims, append([]byte{}, v...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(ArchiveBucketName).ForEach(func(k, v []byte) error {
+			rows.Archived = append(rows.Archived, append([]byte{}, v...))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// Decode decodes the claims of the rows, the archived ones included
+func (rows *ClaimRows) Decode() ([]*claim.Claim, error) {
+	res := make([]*claim.Claim, 0, len(rows.Claims)+len(rows.Archived))
+	for _, v := range append(append([][]byte{}, rows.Claims...), rows.Archived...) {
+		c := &claim.Claim{}
+		err := codec.NewDecoderBytes(v, &jsonHandle).Decode(c)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+
+	return res, nil
+}
+
+// IdentityRestore is what a backup restores of an identity
+type IdentityRestore struct {
+	ID     []byte
+	Record *IdentityRecord
+	// Primary records the identity as the single identity of the DB
+	Primary bool
+	Rows    *ClaimRows
+	// TreeNodes are the nodes of the rebuilt trees and their roots, by their key in the tree bucket
+	TreeNodes map[string][]byte
+}
+
+// RestoreIdentity puts the raw claim rows back in the claims and the archive buckets, indexing their subjects and
+// nonces, and writes the tree nodes and the record of the identity, in a single transaction so a failed restore
+// leaves the DB as it was. The claims buckets must be empty.
+func (db *DB) RestoreIdentity(r *IdentityRestore) error {
+	logger.Tracef("DB: restoring identity %x with %d claim rows, %d archived rows and %d tree nodes",
+		r.ID, len(r.Rows.Claims), len(r.Rows.Archived), len(r.TreeNodes))
+
+	recordB := make([]byte, 0)
+	err := codec.NewEncoderBytes(&recordB, &jsonHandle).Encode(r.Record)
+	if err != nil {
+		return err
+	}
+
+	return db.conn.Update(func(tx *bbolt.Tx) error {
+		err := restoreRows(tx, ClaimsBucketName, r.Rows.Claims)
+		if err != nil {
+			return err
+		}
+		err = restoreRows(tx, ArchiveBucketName, r.Rows.Archived)
+		if err != nil {
+			return err
+		}
+
+		tree, err := tx.CreateBucketIfNotExists(TreeBucketName)
+		if err != nil {
+			return err
+		}
+		for k, v := range r.TreeNodes {
+			err = tree.Put([]byte(k), v)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tx.Bucket(IdentityBucketName).Put(r.ID, recordB)
+		if err != nil {
+			return err
+		}
+		if r.Primary {
+			return tx.Bucket(PrimaryIdentityBucketName).Put(primaryIdentityKey, r.ID)
+		}
+		return nil
+	})
+}
+
+// restoreRows puts the raw claim rows in the empty bucket
+func restoreRows(tx *bbolt.Tx, bucket []byte, rows [][]byte) error {
+	b := tx.Bucket(bucket)
+	if k, _ := b.Cursor().First(); k != nil {
+		return errors.New("the DB holds claims already")
+	}
+
+	for _, v := range rows {
+		c := &claim.Claim{}
+		err := codec.NewDecoderBytes(v, &jsonHandle).Decode(c)
+		if err != nil {
+			return err
+		}
+		err = b.Put(claimKey(c.ID), v)
+		if err != nil {
+			return err
+		}
+		err = indexRevNonce(tx, c)
+		if err != nil {
+			return err
+		}
+		err = indexSubject(tx, c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package db
+
+import (
+	"encoding/binary"
+	logger "github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+// CursorsBucketName holds the offsets in the event stream up to which the internal consumers processed it
+var CursorsBucketName = []byte("cursors")
+
+// GetCursor returns the offset the named consumer processed the event stream up to, 0 if it never did
+func (db *DB) GetCursor(name string) (uint64, error) {
+	logger.Tracef("DB: getting cursor %s", name)
+
+	var offset uint64
+	return offset, db.conn.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(CursorsBucketName).Get([]byte(name))
+		if v != nil {
+			offset = binary.BigEndian.Uint64(v)
+		}
+		return nil
+	})
+}
+
+// SaveCursor records the offset the named consumer processed the event stream up to
+func (db *DB) SaveCursor(name string, offset uint64) error {
+	logger.Tracef("DB: saving cursor %s at offset %d", name, offset)
+
+	return db.conn.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(CursorsBucketName).Put([]byte(name), seqKey(offset))
+	})
+}
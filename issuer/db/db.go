@@ -1,7 +1,9 @@
 package db
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/google/uuid"
 	logger "github.com/sirupsen/logrus"
 	"github.com/ugorji/go/codec"
 	"go.etcd.io/bbolt"
@@ -13,14 +15,28 @@ var (
 	jsonHandle         codec.JsonHandle
 	ClaimsBucketName   = []byte("claims")
 	IdentityBucketName = []byte("identities")
-	ErrKeyNotFound     = fmt.Errorf("key not found")
+	// PrimaryIdentityBucketName holds the identifier of the single identity of the DB, telling its record apart from
+	// the records of the tenants
+	PrimaryIdentityBucketName = []byte("primary_identity")
+	ErrKeyNotFound            = fmt.Errorf("key not found")
+	// ErrClaimExists is returned when a claim is issued with the id of a saved or archived claim
+	ErrClaimExists = fmt.Errorf("a claim with the id is saved already")
+
+	primaryIdentityKey = []byte("identifier")
 )
 
 type DB struct {
 	conn *bbolt.DB
+	// tempPath is the file of an in-memory DB, removed on Close
+	tempPath string
 }
 
+// New opens the DB file, InMemoryPath opens an in-memory DB
 func New(dbFilePath string, removeOldDB bool) (*DB, error) {
+	if dbFilePath == InMemoryPath {
+		return NewInMemory()
+	}
+
 	if removeOldDB {
 		logger.Info("DB: remove-old-DB flag is true -> delete DB file to start from a clean state")
 		_ = os.Remove(dbFilePath)
@@ -54,6 +70,76 @@ func initDB(conn *bbolt.DB) error {
 			return err
 		}
 
+		_, err = tx.CreateBucketIfNotExists(PrimaryIdentityBucketName)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists(AuditBucketName)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists(ArchiveBucketName)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists(EventsBucketName)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists(CursorsBucketName)
+		if err != nil {
+			return err
+		}
+
+		if tx.Bucket(RevNonceIndexBucketName) == nil {
+			_, err = tx.CreateBucket(RevNonceIndexBucketName)
+			if err != nil {
+				return err
+			}
+			err = backfillRevNonceIndex(tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		if tx.Bucket(SubjectIndexBucketName) == nil {
+			_, err = tx.CreateBucket(SubjectIndexBucketName)
+			if err != nil {
+				return err
+			}
+			err = backfillSubjectIndex(tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Close closes the DB file, once the transactions in flight are done. The file of an in-memory DB is removed.
+func (db *DB) Close() error {
+	logger.Debug("DB: closing DB connection")
+
+	err := db.conn.Close()
+	if db.tempPath != "" {
+		if rmErr := os.Remove(db.tempPath); rmErr != nil && err == nil {
+			err = rmErr
+		}
+	}
+	return err
+}
+
+// Ping checks the DB is open and can be read
+func (db *DB) Ping() error {
+	return db.conn.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(IdentityBucketName) == nil {
+			return fmt.Errorf("the %s bucket is missing", IdentityBucketName)
+		}
 		return nil
 	})
 }
@@ -62,23 +148,101 @@ func (db *DB) GetConnection() *bbolt.DB {
 	return db.conn
 }
 
-func (db *DB) SaveIdentity(id, authClaimId []byte) error {
+// IdentityRecord is what's persisted about an identity, keyed by the identifier
+type IdentityRecord struct {
+	AuthClaimID  string
+	GenesisState string
+	// LastPublishedState is the latest state confirmed on chain, empty until the identity publishes
+	LastPublishedState string
+	// Transitions are the confirmed state transitions of the identity, oldest first
+	Transitions []*StateTransition
+	// TreeNamespace is the prefix the merkle trees of the identity are stored under, empty for the trees of an
+	// identity saved before they were namespaced, which are at the root of the tree storage
+	TreeNamespace []byte
+}
+
+// StateTransition is a state transition of an identity confirmed on chain
+type StateTransition struct {
+	OldState    string
+	NewState    string
+	TxID        string
+	BlockNumber uint64
+	// Timestamp is the time of the block the transition was mined in, in unix seconds
+	Timestamp int64
+	// the roots of the trees of the new state, empty for the transitions recorded before they were
+	ClaimsTreeRoot     string
+	RevocationTreeRoot string
+	RootsTreeRoot      string
+}
+
+func (db *DB) SaveIdentity(id []byte, record *IdentityRecord) error {
 	logger.Tracef("DB: saving identity with id: %x", id)
 
+	recordB := make([]byte, 0)
+	err := codec.NewEncoderBytes(&recordB, &jsonHandle).Encode(record)
+	if err != nil {
+		return err
+	}
+
+	return db.conn.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(IdentityBucketName).Put(id, recordB)
+	})
+}
+
+// SavePrimaryIdentity saves the record of the single identity and records the identifier it's looked up by
+func (db *DB) SavePrimaryIdentity(id []byte, record *IdentityRecord) error {
+	logger.Tracef("DB: saving the primary identity with id: %x", id)
+
+	recordB := make([]byte, 0)
+	err := codec.NewEncoderBytes(&recordB, &jsonHandle).Encode(record)
+	if err != nil {
+		return err
+	}
+
 	return db.conn.Update(func(tx *bbolt.Tx) error {
-		return tx.Bucket(IdentityBucketName).Put(id, authClaimId)
+		err := tx.Bucket(IdentityBucketName).Put(id, recordB)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(PrimaryIdentityBucketName).Put(primaryIdentityKey, id)
 	})
 }
 
-func (db *DB) GetClaim(key []byte) (*claim.Claim, error) {
-	logger.Tracef("DB: getting claim with the key: %x", key)
+// decodeIdentityRecord decodes a saved identity. Identities saved before the record was introduced
+// hold only the auth claim id as the value.
+func decodeIdentityRecord(v []byte) (*IdentityRecord, error) {
+	if len(v) == 0 || v[0] != '{' {
+		return &IdentityRecord{AuthClaimID: string(v)}, nil
+	}
+
+	record := &IdentityRecord{}
+	err := codec.NewDecoderBytes(v, &jsonHandle).Decode(record)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// claimKey is the key a claim is stored under in the claims bucket - the canonical string form of its id
+func claimKey(id uuid.UUID) []byte {
+	return []byte(id.String())
+}
+
+func (db *DB) GetClaim(id uuid.UUID) (*claim.Claim, error) {
+	logger.Tracef("DB: getting claim with the id: %s", id)
 
+	key := claimKey(id)
 	claimB := make([]byte, 0)
 
 	err := db.conn.View(func(tx *bbolt.Tx) error {
 
 		claimB = tx.Bucket(ClaimsBucketName).Get(key)
-		if claimB == nil || len(claimB) == 0 {
+		if len(claimB) == 0 {
+			// the claim may be expired and revoked, look for it in the archive
+			claimB = getArchivedClaim(tx, id)
+		}
+		if len(claimB) == 0 {
 			return ErrKeyNotFound
 		}
 
@@ -97,7 +261,8 @@ func (db *DB) GetClaim(key []byte) (*claim.Claim, error) {
 	return res, nil
 }
 
-func (db *DB) SaveClaim(c *claim.Claim) error {
+// SaveClaim saves the claim along with the audit of its change, in a single transaction. A nil audit records nothing.
+func (db *DB) SaveClaim(c *claim.Claim, a *Audit) error {
 	logger.Tracef("DB: saving claim with the id: %s", c.ID.String())
 
 	claimB := make([]byte, 0)
@@ -106,11 +271,154 @@ func (db *DB) SaveClaim(c *claim.Claim) error {
 		return err
 	}
 
-	claimIdBytes := []byte(c.ID.String())
+	return db.conn.Update(func(tx *bbolt.Tx) error {
+		return putClaim(tx, c, claimB, a)
+	})
+}
+
+// InsertClaim saves a newly issued claim like SaveClaim, it fails with ErrClaimExists when a saved or archived claim
+// has its id rather than overwriting that claim
+func (db *DB) InsertClaim(c *claim.Claim, a *Audit) error {
+	logger.Tracef("DB: inserting claim with the id: %s", c.ID.String())
+
+	claimB := make([]byte, 0)
+	err := codec.NewEncoderBytes(&claimB, &jsonHandle).Encode(c)
+	if err != nil {
+		return err
+	}
+
+	return db.conn.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(ClaimsBucketName).Get(claimKey(c.ID)) != nil || getArchivedClaim(tx, c.ID) != nil {
+			return fmt.Errorf("%w: %s", ErrClaimExists, c.ID)
+		}
+
+		return putClaim(tx, c, claimB, a)
+	})
+}
+
+// putClaim writes the encoded claim with its revocation nonce and subject index entries and the audit of its change
+func putClaim(tx *bbolt.Tx, c *claim.Claim, claimB []byte, a *Audit) error {
+	err := indexRevNonce(tx, c)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Bucket(ClaimsBucketName).Put(claimKey(c.ID), claimB)
+	if err != nil {
+		return err
+	}
+
+	err = indexSubject(tx, c)
+	if err != nil {
+		return err
+	}
+
+	return a.append(tx)
+}
+
+// DeleteClaim removes the claim and its subject index entry, releasing its revocation nonce, and records the audit of
+// the removal in the same transaction
+func (db *DB) DeleteClaim(c *claim.Claim, a *Audit) error {
+	logger.Tracef("DB: deleting claim with the id: %s", c.ID.String())
 
 	return db.conn.Update(func(tx *bbolt.Tx) error {
-		return tx.Bucket(ClaimsBucketName).Put(claimIdBytes, claimB)
+		err := tx.Bucket(ClaimsBucketName).Delete(claimKey(c.ID))
+		if err != nil {
+			return err
+		}
+
+		err = unindexRevNonce(tx, c)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Bucket(SubjectIndexBucketName).Delete(subjectIndexKey(c.OtherIdentifier, c.ID))
+		if err != nil {
+			return err
+		}
+
+		return a.append(tx)
+	})
+}
+
+// GetClaimByRevNonce returns the claim issued with the revocation nonce, or ErrKeyNotFound. The claim is found through
+// the revocation nonce index, in the claims bucket or in the archive.
+func (db *DB) GetClaimByRevNonce(nonce uint64) (*claim.Claim, error) {
+	logger.Tracef("DB: getting claim with the revocation nonce: %d", nonce)
+
+	var claimB []byte
+	err := db.conn.View(func(tx *bbolt.Tx) error {
+		id := tx.Bucket(RevNonceIndexBucketName).Get(seqKey(nonce))
+		if id == nil {
+			return ErrKeyNotFound
+		}
+
+		claimB = tx.Bucket(ClaimsBucketName).Get(id)
+		if claimB == nil {
+			claimB = tx.Bucket(ArchiveBucketName).Get(id)
+		}
+		if claimB == nil {
+			return ErrKeyNotFound
+		}
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &claim.Claim{}
+	err = codec.NewDecoderBytes(claimB, &jsonHandle).Decode(res)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ListClaims returns the page of the claims of the issuer ordered by their id that follows the claim after, skipping
+// the excluded ones, and the number of the claims of the issuer that aren't excluded. A nil after starts from the
+// first claim. An empty issuer lists the claims of all the issuers. The archived claims aren't listed.
+func (db *DB) ListClaims(issuer string, after *uuid.UUID, limit int, exclude ...uuid.UUID) ([]*claim.Claim, int, error) {
+	logger.Tracef("DB: listing claims after %v with limit %d", after, limit)
+
+	excluded := make(map[string]bool, len(exclude))
+	for _, id := range exclude {
+		excluded[string(claimKey(id))] = true
+	}
+	var afterKey []byte
+	if after != nil {
+		afterKey = claimKey(*after)
+	}
+
+	res := []*claim.Claim{}
+	total := 0
+	err := db.conn.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(ClaimsBucketName).ForEach(func(k, v []byte) error {
+			if excluded[string(k)] {
+				return nil
+			}
+
+			c := &claim.Claim{}
+			err := codec.NewDecoderBytes(v, &jsonHandle).Decode(c)
+			if err != nil {
+				return err
+			}
+			if issuer != "" && c.Issuer != issuer {
+				return nil
+			}
+			total++
+			if bytes.Compare(k, afterKey) <= 0 || len(res) >= limit {
+				return nil
+			}
+			res = append(res, c)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return res, total, nil
 }
 
 func (db *DB) GetAllClaims() ([]claim.Claim, error) {
@@ -134,23 +442,92 @@ func (db *DB) GetAllClaims() ([]claim.Claim, error) {
 	})
 }
 
-func (db *DB) GetSavedIdentity() ([]byte, []byte, error) {
+// GetIdentity returns the record of the identity, ErrKeyNotFound if it isn't saved
+func (db *DB) GetIdentity(id []byte) (*IdentityRecord, error) {
+	logger.Tracef("DB: getting identity with id: %x", id)
+
+	var record *IdentityRecord
+	err := db.conn.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(IdentityBucketName).Get(id)
+		if v == nil {
+			return ErrKeyNotFound
+		}
+
+		var err error
+		record, err = decodeIdentityRecord(v)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// ListIdentities returns the identifiers of all the saved identities
+func (db *DB) ListIdentities() ([][]byte, error) {
+	logger.Trace("DB: listing the saved identities")
+
+	var ids [][]byte
+	err := db.conn.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(IdentityBucketName).ForEach(func(k, _ []byte) error {
+			ids = append(ids, append([]byte{}, k...))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// SetPrimaryIdentity records the identifier of the saved single identity, for the DBs saved before it was recorded
+func (db *DB) SetPrimaryIdentity(id []byte) error {
+	logger.Tracef("DB: setting the primary identity to id: %x", id)
+
+	return db.conn.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(IdentityBucketName).Get(id) == nil {
+			return ErrKeyNotFound
+		}
+		return tx.Bucket(PrimaryIdentityBucketName).Put(primaryIdentityKey, id)
+	})
+}
+
+// GetSavedIdentity returns the record of the single identity, looked up by the identifier SavePrimaryIdentity recorded.
+// A DB saved before the identifier was recorded holds no tenants, its first record is the single identity. Both are
+// nil when no identity is saved.
+func (db *DB) GetSavedIdentity() ([]byte, *IdentityRecord, error) {
 	logger.Trace("DB: getting the saved identity")
 
 	var id []byte
-	var authClaimId []byte
+	var record *IdentityRecord
 
 	err := db.conn.View(func(tx *bbolt.Tx) error {
 		b := tx.Bucket(IdentityBucketName)
-		return b.ForEach(func(k, v []byte) error {
-			id = k
-			authClaimId = v
+
+		var v []byte
+		if primary := tx.Bucket(PrimaryIdentityBucketName); primary != nil {
+			id = primary.Get(primaryIdentityKey)
+		}
+		if id != nil {
+			v = b.Get(id)
+		} else {
+			id, v = b.Cursor().First()
+		}
+		if id == nil || v == nil {
+			id = nil
 			return nil
-		})
+		}
+
+		id = append([]byte{}, id...)
+		var err error
+		record, err = decodeIdentityRecord(v)
+		return err
 	})
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return id, authClaimId, nil
+	return id, record, nil
 }
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"encoding/binary"
+	logger "github.com/sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+	"go.etcd.io/bbolt"
+)
+
+var EventsBucketName = []byte("events")
+
+// EventMTPProofAvailable is appended once the state including an issued claim is published, the claim can then be
+// fetched along with its MTP proof
+const EventMTPProofAvailable = "mtp_proof_available"
+
+// Event is an entry of the issuance and revocation stream consumed by downstream systems. The offsets
+// start at 1 and increase by one with every event, a consumer resumes from the last offset it processed.
+type Event struct {
+	Offset     uint64
+	Type       string
+	ClaimID    string
+	SchemaType string
+	RevNonce   uint64
+	Timestamp  int64
+	// TxID is the transaction that published the state, set on EventMTPProofAvailable events
+	TxID string
+}
+
+// AppendEvent assigns the next offset to the event and stores it
+func (db *DB) AppendEvent(e *Event) error {
+	logger.Tracef("DB: appending event %s", e.Type)
+
+	return db.conn.Update(func(tx *bbolt.Tx) error {
+		return appendEvent(tx, e)
+	})
+}
+
+func appendEvent(tx *bbolt.Tx, e *Event) error {
+	b := tx.Bucket(EventsBucketName)
+
+	offset, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	e.Offset = offset
+
+	eventB := make([]byte, 0)
+	if err = codec.NewEncoderBytes(&eventB, &jsonHandle).Encode(e); err != nil {
+		return err
+	}
+
+	return b.Put(seqKey(offset), eventB)
+}
+
+// GetEvents returns at most limit events with an offset greater than since, ordered by offset
+func (db *DB) GetEvents(since uint64, limit int) ([]*Event, error) {
+	logger.Tracef("DB: getting events since offset %d", since)
+
+	res := make([]*Event, 0)
+
+	return res, db.conn.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(EventsBucketName).Cursor()
+		for k, v := c.Seek(seqKey(since + 1)); k != nil && len(res) < limit; k, v = c.Next() {
+			if binary.BigEndian.Uint64(k) <= since {
+				continue
+			}
+
+			e := &Event{}
+			if err := codec.NewDecoderBytes(v, &jsonHandle).Decode(e); err != nil {
+				return err
+			}
+			res = append(res, e)
+		}
+		return nil
+	})
+}
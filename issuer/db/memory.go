@@ -0,0 +1,45 @@
+package db
+
+import (
+	logger "github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+	"os"
+)
+
+// InMemoryPath is the DB file path that opens an ephemeral DB with NewInMemory
+const InMemoryPath = ":memory:"
+
+// NewInMemory opens an empty DB for tests and ephemeral issuers, it's gone once closed. bbolt maps a file, so the DB
+// lives in a temporary file, in the tmpfs of /dev/shm when there's one, and isn't synced to the disk.
+func NewInMemory() (*DB, error) {
+	dir := ""
+	if fi, err := os.Stat("/dev/shm"); err == nil && fi.IsDir() {
+		dir = "/dev/shm"
+	}
+	f, err := os.CreateTemp(dir, "issuer-*.db")
+	if err != nil {
+		return nil, err
+	}
+	path := f.Name()
+	err = f.Close()
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+
+	logger.Debugf("DB: opening in-memory DB (file-path: %s)", path)
+	conn, err := bbolt.Open(path, 0600, &bbolt.Options{NoSync: true, NoFreelistSync: true})
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+
+	err = initDB(conn)
+	if err != nil {
+		_ = conn.Close()
+		_ = os.Remove(path)
+		return nil, err
+	}
+
+	return &DB{conn: conn, tempPath: path}, nil
+}
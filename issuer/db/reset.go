@@ -0,0 +1,47 @@
+package db
+
+import (
+	"bytes"
+
+	logger "github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+// TreeBucketName is the bucket the merkle tree storage keeps the nodes of all the trees in
+var TreeBucketName = []byte("tree")
+
+// Reset empties the claims, the archived claims, the subject and revocation nonce indexes and the identities, and
+// deletes the tree nodes under the given prefixes, in a single transaction. The audit log and the events are kept.
+func (db *DB) Reset(treePrefixes [][]byte) error {
+	logger.Info("DB: resetting the identity")
+
+	return db.conn.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{ClaimsBucketName, ArchiveBucketName, SubjectIndexBucketName, RevNonceIndexBucketName, IdentityBucketName, PrimaryIdentityBucketName} {
+			err := tx.DeleteBucket(name)
+			if err != nil && err != bbolt.ErrBucketNotFound {
+				return err
+			}
+			_, err = tx.CreateBucket(name)
+			if err != nil {
+				return err
+			}
+		}
+
+		tree := tx.Bucket(TreeBucketName)
+		if tree == nil {
+			return nil
+		}
+		for _, prefix := range treePrefixes {
+			// deleting under the cursor skips the next key, the cursor is moved back to the prefix instead
+			c := tree.Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+				err := c.Delete()
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	logger "github.com/sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+	"go.etcd.io/bbolt"
+	"issuer/service/claim"
+)
+
+// RevNonceIndexBucketName holds the revocation nonces in use, the keys are the nonces and the values the ids of the
+// claims issued with them. Archived claims keep their nonces, only deleted claims release them.
+var RevNonceIndexBucketName = []byte("claims_by_rev_nonce")
+
+// ErrRevNonceInUse is returned when a claim is saved with the revocation nonce of another claim
+var ErrRevNonceInUse = fmt.Errorf("the revocation nonce is used by another claim")
+
+// indexRevNonce records the nonce of the claim as used, it fails when another claim uses it
+func indexRevNonce(tx *bbolt.Tx, c *claim.Claim) error {
+	b := tx.Bucket(RevNonceIndexBucketName)
+	key := seqKey(c.RevNonce)
+	id := claimKey(c.ID)
+
+	if owner := b.Get(key); owner != nil && !bytes.Equal(owner, id) {
+		return fmt.Errorf("%w: nonce %d, claim %s", ErrRevNonceInUse, c.RevNonce, owner)
+	}
+	return b.Put(key, id)
+}
+
+// unindexRevNonce releases the nonce of the claim, unless another claim holds it
+func unindexRevNonce(tx *bbolt.Tx, c *claim.Claim) error {
+	b := tx.Bucket(RevNonceIndexBucketName)
+	key := seqKey(c.RevNonce)
+
+	if !bytes.Equal(b.Get(key), claimKey(c.ID)) {
+		return nil
+	}
+	return b.Delete(key)
+}
+
+// backfillRevNonceIndex indexes the nonces of the claims and the archived claims saved before the index was introduced.
+// Claims sharing a nonce are kept, the first one holds it in the index.
+func backfillRevNonceIndex(tx *bbolt.Tx) error {
+	logger.Trace("DB: backfilling the revocation nonce index")
+
+	b := tx.Bucket(RevNonceIndexBucketName)
+	for _, name := range [][]byte{ClaimsBucketName, ArchiveBucketName} {
+		err := tx.Bucket(name).ForEach(func(k, v []byte) error {
+			c := &claim.Claim{}
+			if err := codec.NewDecoderBytes(v, &jsonHandle).Decode(c); err != nil {
+				return err
+			}
+			key := seqKey(c.RevNonce)
+			if b.Get(key) != nil {
+				logger.Warnf("DB: claim %s shares the revocation nonce %d with another claim", c.ID, c.RevNonce)
+				return nil
+			}
+			return b.Put(key, claimKey(c.ID))
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IsRevNonceUsed tells whether a saved or archived claim was issued with the revocation nonce
+func (db *DB) IsRevNonceUsed(nonce uint64) (bool, error) {
+	logger.Tracef("DB: checking the revocation nonce %d", nonce)
+
+	var used bool
+	return used, db.conn.View(func(tx *bbolt.Tx) error {
+		used = tx.Bucket(RevNonceIndexBucketName).Get(seqKey(nonce)) != nil
+		return nil
+	})
+}
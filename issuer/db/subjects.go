@@ -0,0 +1,68 @@
+package db
+
+import (
+	"bytes"
+	"github.com/google/uuid"
+	logger "github.com/sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+	"go.etcd.io/bbolt"
+	"issuer/service/claim"
+)
+
+// SubjectIndexBucketName indexes the claims by their subject, the keys are <subject>/<claim id> and the values are empty
+var SubjectIndexBucketName = []byte("claims_by_subject")
+
+func subjectIndexKey(subject string, id uuid.UUID) []byte {
+	return append([]byte(subject+"/"), claimKey(id)...)
+}
+
+// indexSubject adds the claim to the subject index, claims without a subject aren't indexed
+func indexSubject(tx *bbolt.Tx, c *claim.Claim) error {
+	if c.OtherIdentifier == "" {
+		return nil
+	}
+	return tx.Bucket(SubjectIndexBucketName).Put(subjectIndexKey(c.OtherIdentifier, c.ID), []byte{})
+}
+
+// backfillSubjectIndex indexes the claims saved before the subject index was introduced
+func backfillSubjectIndex(tx *bbolt.Tx) error {
+	logger.Trace("DB: backfilling the subject index")
+
+	return tx.Bucket(ClaimsBucketName).ForEach(func(k, v []byte) error {
+		c := &claim.Claim{}
+		if err := codec.NewDecoderBytes(v, &jsonHandle).Decode(c); err != nil {
+			return err
+		}
+		return indexSubject(tx, c)
+	})
+}
+
+// GetClaimsBySubject returns the claims issued to the subject, archived claims included
+func (db *DB) GetClaimsBySubject(subject string) ([]*claim.Claim, error) {
+	logger.Tracef("DB: getting claims of subject %s", subject)
+
+	res := make([]*claim.Claim, 0)
+	prefix := []byte(subject + "/")
+
+	return res, db.conn.View(func(tx *bbolt.Tx) error {
+		claims := tx.Bucket(ClaimsBucketName)
+		c := tx.Bucket(SubjectIndexBucketName).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			id := k[len(prefix):]
+			claimB := claims.Get(id)
+			if len(claimB) == 0 {
+				claimB = tx.Bucket(ArchiveBucketName).Get(id)
+			}
+			if len(claimB) == 0 {
+				continue
+			}
+
+			cl := &claim.Claim{}
+			if err := codec.NewDecoderBytes(claimB, &jsonHandle).Decode(cl); err != nil {
+				return err
+			}
+			res = append(res, cl)
+		}
+		return nil
+	})
+}
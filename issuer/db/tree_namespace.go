@@ -0,0 +1,72 @@
+package db
+
+import (
+	"bytes"
+	logger "github.com/sirupsen/logrus"
+	"github.com/ugorji/go/codec"
+	"go.etcd.io/bbolt"
+)
+
+// MoveTreesToNamespace moves the tree nodes stored under the prefixes at the root of the tree storage into the
+// namespace and saves the namespace in the record of the identity, in a single transaction. The trees of the single
+// identity of a DB were stored at the root before they were namespaced. Nothing is moved when the namespace already
+// holds nodes, the trees there are the ones of the identity.
+func (db *DB) MoveTreesToNamespace(id []byte, treePrefixes [][]byte, namespace []byte) error {
+	logger.Infof("DB: moving the trees of identity %x into their namespace", id)
+
+	return db.conn.Update(func(tx *bbolt.Tx) error {
+		records := tx.Bucket(IdentityBucketName)
+		v := records.Get(id)
+		if v == nil {
+			return ErrKeyNotFound
+		}
+		record, err := decodeIdentityRecord(v)
+		if err != nil {
+			return err
+		}
+
+		tree := tx.Bucket(TreeBucketName)
+		if tree != nil && !hasPrefixedKey(tree, namespace) {
+			for _, prefix := range treePrefixes {
+				err = moveUnderNamespace(tree, prefix, namespace)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		record.TreeNamespace = namespace
+		recordB := make([]byte, 0)
+		err = codec.NewEncoderBytes(&recordB, &jsonHandle).Encode(record)
+		if err != nil {
+			return err
+		}
+		return records.Put(id, recordB)
+	})
+}
+
+func hasPrefixedKey(b *bbolt.Bucket, prefix []byte) bool {
+	k, _ := b.Cursor().Seek(prefix)
+	return k != nil && bytes.HasPrefix(k, prefix)
+}
+
+// moveUnderNamespace puts every node of the prefix under the namespace and deletes it from the root
+func moveUnderNamespace(tree *bbolt.Bucket, prefix, namespace []byte) error {
+	// the bucket changes under the cursor, it's moved back to the prefix after every node
+	c := tree.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Seek(prefix) {
+		key := append(append([]byte{}, namespace...), k...)
+		val := append([]byte{}, v...)
+
+		err := c.Delete()
+		if err != nil {
+			return err
+		}
+		err = tree.Put(key, val)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -3,27 +3,68 @@ package http
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
-
-	"github.com/pkg/errors"
+	"strconv"
+	"time"
 )
 
 // Client represents default http client that can be used to send requests to third party services
 type Client struct {
-	base http.Client
+	base  http.Client
+	retry RetryPolicy
+}
+
+// RetryPolicy describes how requests that failed with a transient error are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, it's doubled on every subsequent retry
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts, 0 leaves it uncapped
+	MaxDelay time.Duration
+	// Jitter is the fraction of the delay it's randomly shortened or lengthened by, from 0 to 1
+	Jitter float64
+}
+
+// StatusError is returned when the server answers with a status other than 200
+type StatusError struct {
+	StatusCode int
+	Body       string
+	retryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http request failed with status %v, error: %v", e.StatusCode, e.Body)
+}
+
+// NewClient creates a client that sends every request exactly once
+func NewClient(c http.Client) *Client {
+	return &Client{base: c}
+}
+
+// NewClientWithRetry creates a client that retries GET requests failing with a network error, 429 or 5xx
+// according to the given policy. POST requests aren't idempotent, they are retried only when they couldn't
+// connect to the server: the server may have acted on a request it answered with an error, or whose
+// response was lost.
+func NewClientWithRetry(c http.Client, p RetryPolicy) *Client {
+	return &Client{base: c, retry: p}
 }
 
 // Post send posts request to url with additional headers
 func (c *Client) Post(ctx context.Context, url string, req []byte) ([]byte, error) {
 	reqBody := bytes.NewBuffer(req)
 
-	request, err := http.NewRequest(http.MethodPost, url, reqBody)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, reqBody)
 	if err != nil {
 		return nil, err
 	}
 
-	return executeRequest(c, request)
+	return executeWithRetry(c, request, isConnectionError)
 }
 
 // Get send request to url with requestID headers
@@ -34,7 +75,45 @@ func (c *Client) Get(ctx context.Context, url string) ([]byte, error) {
 		return nil, err
 	}
 
-	return executeRequest(c, req)
+	return executeWithRetry(c, req, isRetryable)
+}
+
+// executeWithRetry executes the request until it succeeds, fails with an error the retryable check rejects
+// or the attempts are used
+func executeWithRetry(c *Client, r *http.Request, retryable func(error) bool) ([]byte, error) {
+	delay := c.retry.BaseDelay
+	for attempt := 1; ; attempt++ {
+		body, err := executeRequest(c, r)
+		if err == nil || attempt >= c.retry.MaxAttempts || !retryable(err) {
+			return body, err
+		}
+		if r.Context().Err() != nil {
+			// the request was aborted by its context, not by the server
+			return nil, r.Context().Err()
+		}
+		if r.GetBody != nil {
+			// the body was consumed by the failed attempt
+			r.Body, err = r.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		wait := c.retry.backoff(delay)
+		if statusErr, ok := err.(*StatusError); ok && statusErr.retryAfter > 0 {
+			wait = statusErr.retryAfter
+			if c.retry.MaxDelay > 0 && wait > c.retry.MaxDelay {
+				wait = c.retry.MaxDelay
+			}
+		}
+		delay *= 2
+
+		select {
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		case <-time.After(wait):
+		}
+	}
 }
 
 // executeRequest contains utils logic of request execution
@@ -50,8 +129,61 @@ func executeRequest(c *Client, r *http.Request) ([]byte, error) {
 		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.Errorf("http request failed with status %v, error: %v", resp.StatusCode, string(body))
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
 	}
 
 	return body, nil
 }
+
+// backoff returns the delay capped by the max delay and spread by the jitter
+func (p RetryPolicy) backoff(delay time.Duration) time.Duration {
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay += time.Duration(p.Jitter * (2*rand.Float64() - 1) * float64(delay))
+	}
+
+	return delay
+}
+
+// isConnectionError reports whether the request failed before it reached the server: the host wasn't resolved or the
+// connection wasn't opened. A request failing later, e.g. while its response is read, may have been acted on.
+func isConnectionError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func isRetryable(err error) bool {
+	statusErr, ok := err.(*StatusError)
+	if !ok {
+		return true // network error
+	}
+
+	return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+}
+
+// parseRetryAfter parses the Retry-After header, given either in seconds or as an HTTP date
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+
+	return 0
+}
@@ -0,0 +1,130 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestPostCancelled posts to a server that doesn't answer, the post must end with the context instead of retrying
+func TestPostCancelled(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := NewClientWithRetry(http.Client{}, RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.Post(ctx, srv.URL, []byte(`{}`))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the post returned after %s, want it to return once its context is done", elapsed)
+	}
+}
+
+// TestPostAlreadyCancelled posts with a context cancelled before, no attempt is made
+func TestPostAlreadyCancelled(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+	}))
+	defer srv.Close()
+
+	c := NewClientWithRetry(http.Client{}, RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.Post(ctx, srv.URL, []byte(`{}`))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 0 {
+		t.Errorf("the server got %d requests, want none", n)
+	}
+}
+
+// TestPostNotRetried posts to a server failing with 500, the post isn't retried as the server may have acted on it
+func TestPostNotRetried(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c := NewClientWithRetry(http.Client{}, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	_, err := c.Post(context.Background(), srv.URL, []byte(`{}`))
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("got %v, want a 500 status error", err)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 1 {
+		t.Errorf("the server got %d requests, want 1", n)
+	}
+}
+
+// TestPostRetriedOnDialError posts to a closed port, the request never reached a server and is retried
+func TestPostRetriedOnDialError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	var dials int32
+	base := http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	c := NewClientWithRetry(base, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})
+
+	_, err := c.Post(context.Background(), url, []byte(`{}`))
+	if err == nil {
+		t.Fatal("the post to a closed port succeeded")
+	}
+	if n := atomic.LoadInt32(&dials); n != 3 {
+		t.Errorf("got %d dials, want 3", n)
+	}
+}
+
+// TestRetryAfterCapped gets from a server asking to retry in a minute, the wait is capped by the max delay
+func TestRetryAfterCapped(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClientWithRetry(http.Client{}, RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+
+	start := time.Now()
+	_, err := c.Get(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the get returned after %s, want the retry after capped to the max delay", elapsed)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Errorf("the server got %d requests, want 2", n)
+	}
+}
@@ -5,44 +5,107 @@ import (
 	"crypto/ecdsa"
 	"fmt"
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/params"
+	core "github.com/iden3/go-iden3-core"
+	"github.com/iden3/go-merkletree-sql"
 	"github.com/pkg/errors"
 	logger "github.com/sirupsen/logrus"
 	eth "issuer/service/blockchain/contracts"
+	"issuer/service/cfgs"
 	"issuer/service/identity"
 	"math"
 	"math/big"
+	"strings"
+	"sync"
 	"time"
 )
 
+// ErrTxReorged is returned when a chain reorg dropped the state transition from the block it was mined in
+var ErrTxReorged = errors.New("state transition transaction was reorged")
+
+// ErrGasFeeCapExceeded is returned when the fee a transaction requires is above the configured cap
+var ErrGasFeeCapExceeded = errors.New("required gas fee exceeds the max gas fee cap")
+
 type StateManager struct {
+	// mu guards client, it's replaced when the connection to the RPC node drops
+	mu              sync.RWMutex
 	client          *ethclient.Client
+	rpcURL          string
 	contractAddress common.Address
 	privateKey      *ecdsa.PrivateKey
+
+	// failover holds the clients the confirmations are polled with, the primary client first
+	failover *rpcFailover
+	// confirmations is the number of blocks a state transition is buried under before it's treated as final
+	confirmations int
+
+	// gasTipCapFallback is used when the node fails to suggest a gas tip
+	gasTipCapFallback *big.Int
+	// minGasTipCap is the lowest gas tip a transaction is sent with
+	minGasTipCap *big.Int
+	// baseFeeMultiplier is applied to the next block's base fee, as a margin for the fee rising meanwhile
+	baseFeeMultiplier float64
+	// maxGasFeeCap is the highest fee per gas a transaction is sent with, nil doesn't cap the fee
+	maxGasFeeCap *big.Int
+	// txLogLevel is the level the steps of the transaction lifecycle are logged at
+	txLogLevel logger.Level
+
+	// sendMu serializes the sent transactions, each one takes the next pending nonce
+	sendMu sync.Mutex
+	// queue holds the state transitions of Enqueue
+	queue *transitionQueue
+	// sendTimeout bounds the sending of a queued state transition, zero leaves it unbounded
+	sendTimeout time.Duration
 }
 
-func NewStateManager(nodeAddress, contractAddress, publishPrivateKey string) (*StateManager, error) {
-	privateKey, err := crypto.HexToECDSA(publishPrivateKey)
+func NewStateManager(cfg *cfgs.IssuerConfig) (*StateManager, error) {
+	privateKey, err := crypto.HexToECDSA(cfg.PublishingPrivateKey)
 	if err != nil {
 		return nil, err
 	}
 
-	ethClient, err := ethclient.Dial(nodeAddress)
+	ethClient, err := ethclient.Dial(cfg.NodeRpcUrl)
 	if err != nil {
 		return nil, err
 	}
+	failover, err := newRPCFailover(ethClient, cfg.NodeRpcUrl, cfg.BackupNodeRpcUrls, cfg.RpcFailoverAfter)
+	if err != nil {
+		return nil, err
+	}
+	var maxGasFeeCap *big.Int
+	if cfg.MaxGasFeeCap > 0 {
+		maxGasFeeCap = big.NewInt(cfg.MaxGasFeeCap)
+	}
 	return &StateManager{
-		client:          ethClient,
-		contractAddress: common.HexToAddress(contractAddress),
-		privateKey:      privateKey,
+		client:            ethClient,
+		rpcURL:            cfg.NodeRpcUrl,
+		failover:          failover,
+		confirmations:     cfg.Confirmations,
+		contractAddress:   common.HexToAddress(cfg.PublishingContractAddress),
+		privateKey:        privateKey,
+		gasTipCapFallback: big.NewInt(cfg.GasTipCapFallback),
+		minGasTipCap:      big.NewInt(cfg.MinGasTipCap),
+		baseFeeMultiplier: cfg.BaseFeeMultiplier,
+		maxGasFeeCap:      maxGasFeeCap,
+		txLogLevel:        txLogLevel(cfg.LogTxLifecycle),
+		queue:             newTransitionQueue(),
+		sendTimeout:       cfg.PublishTimeout,
 	}, nil
 }
 
+func txLogLevel(logTxLifecycle bool) logger.Level {
+	if logTxLifecycle {
+		return logger.InfoLevel
+	}
+	return logger.DebugLevel
+}
+
 func (ps *StateManager) UpdateState(ctx context.Context, trInfo *identity.TransitionInfoRequest) (string, error) {
 	if trInfo.NewState.Equals(trInfo.LatestState) {
 		return "", errors.New("state hasn't been changed")
@@ -54,14 +117,24 @@ func (ps *StateManager) UpdateState(ctx context.Context, trInfo *identity.Transi
 		return "", errors.New("error casting public key to ECDSA")
 	}
 
+	txLog := logger.WithFields(logger.Fields{
+		"identifier":   trInfo.Identifier.String(),
+		"latest_state": trInfo.LatestState.Hex(),
+		"new_state":    trInfo.NewState.Hex(),
+	})
+
 	payload, err := ps.getStatePayload(trInfo)
 	if err != nil {
 		return "", err
 	}
 
 	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-	tx, err := ps.sendTransaction(ctx, fromAddress, ps.contractAddress, payload)
+	ps.sendMu.Lock()
+	defer ps.sendMu.Unlock()
+	tx, err := ps.sendTransaction(ctx, txLog, fromAddress, ps.contractAddress, payload)
 	if err != nil {
+		txLog.WithError(err).Error("state transition transaction wasn't sent")
+		ps.reconnectOnConnectionError(err)
 		return "", err
 	}
 
@@ -70,18 +143,31 @@ func (ps *StateManager) UpdateState(ctx context.Context, trInfo *identity.Transi
 
 func (ps *StateManager) WaitTransaction(ctx context.Context, txHex string) (*identity.TransitionInfoResponse, error) {
 	txID := common.HexToHash(txHex)
+	txLog := logger.WithField("tx_hash", txHex)
+
 	receipt, err := ps.waitingReceipt(ctx, txID)
 	if err != nil {
+		txLog.WithError(err).Error("state transition transaction wasn't mined")
 		return nil, err
 	}
-	err = ps.waitConfirmation(ctx, txID, receipt.BlockNumber)
+	txLog.WithFields(logger.Fields{
+		"block_number": receipt.BlockNumber.Uint64(),
+		"gas_used":     receipt.GasUsed,
+	}).Log(ps.txLogLevel, "state transition transaction mined")
+
+	err = ps.WaitForConfirmations(ctx, txID, ps.confirmations)
 	if err != nil {
+		txLog.WithError(err).Error("state transition transaction wasn't confirmed")
 		return nil, err
 	}
 	block, err := ps.getBlockByNumber(ctx, receipt.BlockNumber)
 	if err != nil {
 		return nil, err
 	}
+	txLog.WithFields(logger.Fields{
+		"block_number":    block.NumberU64(),
+		"block_timestamp": block.Time(),
+	}).Log(ps.txLogLevel, "state transition transaction confirmed")
 	return &identity.TransitionInfoResponse{
 		TxID:           txHex,
 		BlockTimestamp: block.Time(),
@@ -89,16 +175,31 @@ func (ps *StateManager) WaitTransaction(ctx context.Context, txHex string) (*ide
 	}, nil
 }
 
-func (ps *StateManager) waitConfirmation(ctx context.Context, hash common.Hash, formBlock *big.Int) error {
+// WaitForConfirmations waits until the block holding the mined transaction is buried under at least n blocks.
+// The transaction is looked up again once the depth is reached, ErrTxReorged is returned when a reorg dropped it
+// from the block it was mined in
+func (ps *StateManager) WaitForConfirmations(ctx context.Context, hash common.Hash, n int) error {
+	mined, err := ps.waitingReceipt(ctx, hash)
+	if err != nil {
+		return err
+	}
+
 	tryCount := 100
 	for tryCount > 0 {
-		latestBlock, err := ps.client.BlockNumber(ctx)
+		latest, err := ps.failover.client().HeaderByNumber(ctx, nil)
 		if err != nil {
-			return err
+			if !ps.failover.failed(ctx, err) {
+				return err
+			}
+			tryCount--
+			time.Sleep(time.Second * 5)
+			continue
 		}
-		diff := latestBlock - formBlock.Uint64()
-		if diff > 3 {
-			return nil
+		ps.failover.succeeded()
+
+		depth := new(big.Int).Sub(latest.Number, mined.BlockNumber)
+		if depth.Cmp(big.NewInt(int64(n))) >= 0 {
+			return ps.checkNotReorged(ctx, mined)
 		}
 		tryCount--
 		time.Sleep(time.Second * 5)
@@ -106,18 +207,41 @@ func (ps *StateManager) waitConfirmation(ctx context.Context, hash common.Hash,
 	return fmt.Errorf("transaction '%s' is stuck", hash)
 }
 
+// checkNotReorged checks the transaction is still part of the block it was mined in
+func (ps *StateManager) checkNotReorged(ctx context.Context, mined *types.Receipt) error {
+	receipt, err := ps.failover.client().TransactionReceipt(ctx, mined.TxHash)
+	if errors.Is(err, ethereum.NotFound) {
+		return errors.Wrapf(ErrTxReorged, "transaction '%s' disappeared from block %d", mined.TxHash, mined.BlockNumber)
+	}
+	if err != nil {
+		return err
+	}
+	if receipt.BlockHash != mined.BlockHash {
+		return errors.Wrapf(ErrTxReorged, "transaction '%s' moved from block %s to %s", mined.TxHash, mined.BlockHash, receipt.BlockHash)
+	}
+
+	return nil
+}
+
 func (ps *StateManager) waitingReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
 	tryCount := 100
 	for tryCount > 0 {
-		receipt, err := ps.client.TransactionReceipt(ctx, hash)
+		receipt, err := ps.failover.client().TransactionReceipt(ctx, hash)
 		if err != nil && errors.Is(err, ethereum.NotFound) {
+			ps.failover.succeeded()
 			logger.Printf("transaction '%s' not found", hash)
 			tryCount--
 			time.Sleep(time.Second * 5)
 			continue
 		} else if err != nil {
-			return nil, err
+			if !ps.failover.failed(ctx, err) {
+				return nil, err
+			}
+			tryCount--
+			time.Sleep(time.Second * 5)
+			continue
 		}
+		ps.failover.succeeded()
 
 		switch receipt.Status {
 		case types.ReceiptStatusFailed:
@@ -131,16 +255,28 @@ func (ps *StateManager) waitingReceipt(ctx context.Context, hash common.Hash) (*
 }
 
 func (ps *StateManager) getBlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
-	return ps.client.BlockByNumber(ctx, number)
+	var block *types.Block
+	err := ps.failover.do(ctx, func(c *ethclient.Client) error {
+		var err error
+		block, err = c.BlockByNumber(ctx, number)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return block, nil
 }
 
-func (ps *StateManager) sendTransaction(ctx context.Context, from, to common.Address, payload []byte) (*types.Transaction, error) {
-	nonce, err := ps.client.PendingNonceAt(ctx, from)
+func (ps *StateManager) sendTransaction(ctx context.Context, txLog *logger.Entry, from, to common.Address, payload []byte) (*types.Transaction, error) {
+	nonce, err := ps.ethClient().PendingNonceAt(ctx, from)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get nonce")
 	}
+	txLog = txLog.WithField("from", from.Hex())
+	txLog.WithField("nonce", nonce).Log(ps.txLogLevel, "computed transaction nonce")
 
-	gasLimit, err := ps.client.EstimateGas(ctx, ethereum.CallMsg{
+	gasLimit, err := ps.ethClient().EstimateGas(ctx, ethereum.CallMsg{
 		From:  from, // the sender of the 'transaction'
 		To:    &to,
 		Gas:   0,             // wei <-> gas exchange ratio
@@ -150,22 +286,32 @@ func (ps *StateManager) sendTransaction(ctx context.Context, from, to common.Add
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to estimate gas")
 	}
+	txLog.WithField("gas_limit", gasLimit).Log(ps.txLogLevel, "estimated transaction gas")
 
-	latestBlockHeader, err := ps.client.HeaderByNumber(ctx, nil)
+	latestBlockHeader, err := ps.ethClient().HeaderByNumber(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	baseFee := misc.CalcBaseFee(&params.ChainConfig{LondonBlock: big.NewInt(1)}, latestBlockHeader)
-	b := math.Round(float64(baseFee.Int64()) * 1.25)
+	b := math.Round(float64(baseFee.Int64()) * ps.baseFeeMultiplier)
 	baseFee = big.NewInt(int64(b))
 
-	gasTip, err := ps.client.SuggestGasTipCap(ctx)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed get suggest gas tip")
-	}
+	gasTip := ps.suggestGasTip(ctx)
 
 	maxGasPricePerFee := big.NewInt(0).Add(baseFee, gasTip)
+	if ps.maxGasFeeCap != nil && maxGasPricePerFee.Cmp(ps.maxGasFeeCap) > 0 {
+		txLog.WithFields(logger.Fields{
+			"gas_fee_cap":     maxGasPricePerFee,
+			"max_gas_fee_cap": ps.maxGasFeeCap,
+		}).Warn("transaction fee is above the max gas fee cap, not sending it")
+		return nil, errors.Wrapf(ErrGasFeeCapExceeded, "%s wei required, %s wei allowed", maxGasPricePerFee, ps.maxGasFeeCap)
+	}
+	txLog.WithFields(logger.Fields{
+		"base_fee":    baseFee,
+		"gas_tip_cap": gasTip,
+		"gas_fee_cap": maxGasPricePerFee,
+	}).Log(ps.txLogLevel, "computed transaction fees")
 	baseTx := &types.DynamicFeeTx{
 		To:        &to,
 		Nonce:     nonce,
@@ -178,7 +324,7 @@ func (ps *StateManager) sendTransaction(ctx context.Context, from, to common.Add
 
 	tx := types.NewTx(baseTx)
 
-	cid, err := ps.client.ChainID(ctx)
+	cid, err := ps.ethClient().ChainID(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -190,14 +336,72 @@ func (ps *StateManager) sendTransaction(ctx context.Context, from, to common.Add
 		return nil, err
 	}
 
-	err = ps.client.SendTransaction(ctx, signedTx)
+	txLog = txLog.WithFields(logger.Fields{"tx_hash": signedTx.Hash().Hex(), "chain_id": cid})
+	txLog.Log(ps.txLogLevel, "signed transaction")
+
+	err = ps.ethClient().SendTransaction(ctx, signedTx)
 	if err != nil {
 		return nil, err
 	}
+	txLog.Log(ps.txLogLevel, "sent transaction")
 
 	return signedTx, nil
 }
 
+// suggestGasTip asks the node for a gas tip, falling back to the configured value if the node
+// doesn't support it, and never goes below the configured minimum tip
+func (ps *StateManager) suggestGasTip(ctx context.Context) *big.Int {
+	gasTip, err := ps.ethClient().SuggestGasTipCap(ctx)
+	if err != nil {
+		logger.Warnf("failed get suggest gas tip, using fallback tip of %s wei. err: %v", ps.gasTipCapFallback, err)
+		gasTip = new(big.Int).Set(ps.gasTipCapFallback)
+	}
+
+	if gasTip.Cmp(ps.minGasTipCap) < 0 {
+		logger.Debugf("suggested gas tip %s wei is below the minimum, using %s wei", gasTip, ps.minGasTipCap)
+		gasTip = new(big.Int).Set(ps.minGasTipCap)
+	}
+
+	return gasTip
+}
+
+// GetLatestState reads the latest state of the identity from the state contract
+func (ps *StateManager) GetLatestState(ctx context.Context, id *core.ID) (*identity.OnChainState, error) {
+	caller, err := eth.NewStateCaller(ps.contractAddress, ps.ethClient())
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := caller.GetStateInfoById(&bind.CallOpts{Context: ctx}, id.BigInt())
+	if err != nil && strings.Contains(err.Error(), "does not exist") {
+		return nil, nil
+	}
+	if err != nil {
+		ps.reconnectOnConnectionError(err)
+		return nil, errors.Wrap(err, "failed to get state info")
+	}
+
+	state, err := merkletree.NewHashFromBigInt(info.State)
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity.OnChainState{
+		State:          state,
+		BlockNumber:    info.CreatedAtBlock.Uint64(),
+		BlockTimestamp: info.CreatedAtTimestamp.Uint64(),
+	}, nil
+}
+
+// BuildStatePayload returns the ABI encoded call data of the transitState call for the transition
+func (ps *StateManager) BuildStatePayload(trInfo *identity.TransitionInfoRequest) ([]byte, error) {
+	if trInfo.NewState.Equals(trInfo.LatestState) {
+		return nil, errors.New("state hasn't been changed")
+	}
+
+	return ps.getStatePayload(trInfo)
+}
+
 func (ps *StateManager) getStatePayload(ti *identity.TransitionInfoRequest) ([]byte, error) {
 	a, b, c, err := ti.Proof.ProofToBigInts()
 	if err != nil {
@@ -0,0 +1,116 @@
+package blockchain
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	logger "github.com/sirupsen/logrus"
+)
+
+// rpcRetryDelay is the pause between the retries of a failed RPC call
+const rpcRetryDelay = 5 * time.Second
+
+// rpcFailover holds the clients of the primary and backup RPC endpoints the confirmation of a transaction is polled
+// with. Once the active endpoint failed maxFailures times in a row, the polling moves on to the next one.
+type rpcFailover struct {
+	mu          sync.Mutex
+	clients     []*ethclient.Client
+	urls        []string
+	active      int
+	failures    int
+	maxFailures int
+}
+
+func newRPCFailover(primary *ethclient.Client, primaryURL string, backupURLs []string, maxFailures int) (*rpcFailover, error) {
+	f := &rpcFailover{
+		clients:     []*ethclient.Client{primary},
+		urls:        []string{primaryURL},
+		maxFailures: maxFailures,
+	}
+	for _, url := range backupURLs {
+		c, err := ethclient.Dial(url)
+		if err != nil {
+			return nil, err
+		}
+		f.clients = append(f.clients, c)
+		f.urls = append(f.urls, url)
+	}
+
+	return f, nil
+}
+
+// client returns the client of the active endpoint
+func (f *rpcFailover) client() *ethclient.Client {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.clients[f.active]
+}
+
+// replacePrimary swaps the client of the primary endpoint for a reconnected one
+func (f *rpcFailover) replacePrimary(c *ethclient.Client) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.clients[0] = c
+}
+
+// succeeded resets the failures of the active endpoint
+func (f *rpcFailover) succeeded() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failures = 0
+}
+
+// failed records a failed call to the active endpoint and fails over to the next endpoint after maxFailures failures
+// in a row. It returns false when there is no backup endpoint, or when the call failed because the ctx is done, which
+// isn't a failure of the endpoint. The caller then gives up right away.
+func (f *rpcFailover) failed(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.clients) == 1 {
+		return false
+	}
+
+	f.failures++
+	if f.failures >= f.maxFailures {
+		next := (f.active + 1) % len(f.clients)
+		logger.WithError(err).Warnf("RPC endpoint %d failed %d times in a row, failing over to endpoint %d", f.active, f.failures, next)
+		f.active = next
+		f.failures = 0
+	}
+
+	return true
+}
+
+// do calls fn with the client of the active endpoint until it succeeds, failing over like the other calls do. It gives
+// up once every endpoint failed maxFailures times in turn, or when the ctx is done.
+func (f *rpcFailover) do(ctx context.Context, fn func(c *ethclient.Client) error) error {
+	var err error
+	for attempt := 0; attempt < f.maxFailures*len(f.clients); attempt++ {
+		err = fn(f.client())
+		if err == nil {
+			f.succeeded()
+			return nil
+		}
+		if !f.failed(ctx, err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(rpcRetryDelay):
+		}
+	}
+
+	return err
+}
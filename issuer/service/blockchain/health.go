@@ -0,0 +1,66 @@
+package blockchain
+
+import (
+	"context"
+	"io"
+	"net"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+// ethClient returns the client of the RPC node the transactions are sent to
+func (ps *StateManager) ethClient() *ethclient.Client {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	return ps.client
+}
+
+// Ping checks the RPC node is reachable by asking it for the chain id. A dropped connection is dialed again
+// and checked once more before the node is reported down.
+func (ps *StateManager) Ping(ctx context.Context) error {
+	_, err := ps.ethClient().ChainID(ctx)
+	if err == nil || !ps.reconnectOnConnectionError(err) {
+		return err
+	}
+
+	_, err = ps.ethClient().ChainID(ctx)
+	return err
+}
+
+// reconnectOnConnectionError dials the RPC node again when the call failed because of the connection, the
+// following calls use the new client. It reports whether the client was replaced.
+func (ps *StateManager) reconnectOnConnectionError(err error) bool {
+	if !isConnectionError(err) {
+		return false
+	}
+
+	c, dialErr := ethclient.Dial(ps.rpcURL)
+	if dialErr != nil {
+		logger.WithError(dialErr).Warn("failed to reconnect to the RPC node")
+		return false
+	}
+
+	ps.mu.Lock()
+	old := ps.client
+	ps.client = c
+	ps.mu.Unlock()
+
+	ps.failover.replacePrimary(c)
+	old.Close()
+	logger.WithError(err).Warn("reconnected to the RPC node after a connection error")
+
+	return true
+}
+
+// isConnectionError reports whether the call failed before the RPC node answered it
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, rpc.ErrClientQuit)
+}
@@ -0,0 +1,160 @@
+package blockchain
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"issuer/service/identity"
+)
+
+// finishedJobTTL is how long the status of a sent or failed job can be polled
+const finishedJobTTL = time.Hour
+
+type transitionJob struct {
+	id     string
+	trInfo *identity.TransitionInfoRequest
+	onSent func(txHex string, err error)
+}
+
+// transitionQueue holds the state transitions waiting to be sent, they're sent one at a time in the order they were
+// enqueued so the nonces and the states follow each other
+type transitionQueue struct {
+	mu      sync.Mutex
+	pending []*transitionJob
+	// wake is signalled when a job is enqueued, the worker waits on it while the queue is empty
+	wake     chan struct{}
+	statuses *cache.Cache
+	start    sync.Once
+}
+
+func newTransitionQueue() *transitionQueue {
+	return &transitionQueue{
+		wake:     make(chan struct{}, 1),
+		statuses: cache.New(finishedJobTTL, 2*finishedJobTTL),
+	}
+}
+
+func (q *transitionQueue) push(job *transitionJob) {
+	q.mu.Lock()
+	q.pending = append(q.pending, job)
+	q.statuses.Set(job.id, &identity.PublishJobStatus{State: identity.PublishJobQueued}, cache.NoExpiration)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pop returns the oldest job, or nil when the queue is empty
+func (q *transitionQueue) pop() *transitionJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) == 0 {
+		return nil
+	}
+	job := q.pending[0]
+	q.pending[0] = nil
+	q.pending = q.pending[1:]
+	q.statuses.Set(job.id, &identity.PublishJobStatus{State: identity.PublishJobSending}, cache.NoExpiration)
+
+	return job
+}
+
+// drain empties the queue and returns the jobs it held
+func (q *transitionQueue) drain() []*transitionJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := q.pending
+	q.pending = nil
+	return jobs
+}
+
+// finish sets the final status of the job and tells its caller
+func (q *transitionQueue) finish(job *transitionJob, txHash string, err error) {
+	status := &identity.PublishJobStatus{State: identity.PublishJobSent, TxHash: txHash}
+	if err != nil {
+		status = &identity.PublishJobStatus{State: identity.PublishJobFailed, Error: err.Error()}
+	}
+	q.statuses.Set(job.id, status, cache.DefaultExpiration)
+
+	if job.onSent != nil {
+		job.onSent(txHash, err)
+	}
+}
+
+// Enqueue queues the state transition to be sent in the background and returns the id to poll its PublishStatus
+// with. The ctx only bounds the enqueueing, the transaction is sent after the caller returned, onSent is called once
+// it's sent or failed.
+func (ps *StateManager) Enqueue(ctx context.Context, trInfo *identity.TransitionInfoRequest, onSent func(txHex string, err error)) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if trInfo.NewState.Equals(trInfo.LatestState) {
+		return "", errors.New("state hasn't been changed")
+	}
+
+	ps.queue.start.Do(func() {
+		go ps.sendQueued()
+	})
+
+	job := &transitionJob{id: uuid.NewString(), trInfo: trInfo, onSent: onSent}
+	ps.queue.push(job)
+	logger.WithFields(logger.Fields{
+		"job_id":    job.id,
+		"new_state": trInfo.NewState.Hex(),
+	}).Log(ps.txLogLevel, "queued state transition")
+
+	return job.id, nil
+}
+
+// PublishStatus returns the status of the queued state transition
+func (ps *StateManager) PublishStatus(jobID string) (*identity.PublishJobStatus, error) {
+	v, ok := ps.queue.statuses.Get(jobID)
+	if !ok {
+		return nil, errors.Wrapf(identity.ErrPublishJobNotFound, "job %s", jobID)
+	}
+
+	status := *v.(*identity.PublishJobStatus)
+	return &status, nil
+}
+
+// sendQueued is the worker sending the queued state transitions, it runs for the lifetime of the process. A queued
+// transition starts from the state of the one before it, so when a job fails the jobs queued after it are failed too,
+// they'd be reverted on chain.
+func (ps *StateManager) sendQueued() {
+	for {
+		job := ps.queue.pop()
+		if job == nil {
+			<-ps.queue.wake
+			continue
+		}
+
+		txHash, err := ps.sendJob(job)
+		ps.queue.finish(job, txHash, err)
+		if err == nil {
+			continue
+		}
+		for _, dropped := range ps.queue.drain() {
+			ps.queue.finish(dropped, "", errors.Errorf("job %s queued before it failed: %v", job.id, err))
+		}
+	}
+}
+
+// sendJob sends the transaction of the job, bounded by the send timeout
+func (ps *StateManager) sendJob(job *transitionJob) (string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if ps.sendTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), ps.sendTimeout)
+	}
+	defer cancel()
+
+	return ps.UpdateState(ctx, job.trInfo)
+}
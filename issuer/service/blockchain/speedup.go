@@ -0,0 +1,94 @@
+package blockchain
+
+import (
+	"context"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+// MinFeeBumpPct is the lowest fee increase nodes accept to replace a pending transaction
+const MinFeeBumpPct = 10
+
+// ErrTxNotPending is returned when the transaction to speed up was already mined or isn't known to the node
+var ErrTxNotPending = errors.New("transaction isn't pending")
+
+// SpeedUpTransaction replaces a pending transaction with the same payload and nonce, paying a tip and fee cap
+// bumpPct percent higher (at least MinFeeBumpPct). It returns the hash of the replacement, the caller waits on
+// it instead of the stuck transaction, only one of both can be mined.
+func (ps *StateManager) SpeedUpTransaction(ctx context.Context, txHash string, bumpPct float64) (string, error) {
+	txLog := logger.WithField("stuck_tx_hash", txHash)
+
+	stuck, pending, err := ps.ethClient().TransactionByHash(ctx, common.HexToHash(txHash))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get transaction")
+	}
+	if !pending {
+		return "", errors.Wrapf(ErrTxNotPending, "transaction %s was already mined", txHash)
+	}
+
+	from := crypto.PubkeyToAddress(ps.privateKey.PublicKey)
+	sender, err := types.Sender(types.LatestSignerForChainID(stuck.ChainId()), stuck)
+	if err != nil {
+		return "", err
+	}
+	if sender != from {
+		return "", errors.Errorf("transaction %s wasn't sent by the issuer", txHash)
+	}
+
+	if bumpPct < MinFeeBumpPct {
+		bumpPct = MinFeeBumpPct
+	}
+	gasTip := bumpFee(stuck.GasTipCap(), bumpPct)
+	gasFeeCap := bumpFee(stuck.GasFeeCap(), bumpPct)
+	if ps.maxGasFeeCap != nil && gasFeeCap.Cmp(ps.maxGasFeeCap) > 0 {
+		return "", errors.Wrapf(ErrGasFeeCapExceeded, "%s wei required, %s wei allowed", gasFeeCap, ps.maxGasFeeCap)
+	}
+	txLog.WithFields(logger.Fields{
+		"nonce":       stuck.Nonce(),
+		"gas_tip_cap": gasTip,
+		"gas_fee_cap": gasFeeCap,
+	}).Log(ps.txLogLevel, "computed replacement transaction fees")
+
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   stuck.ChainId(),
+		To:        stuck.To(),
+		Nonce:     stuck.Nonce(),
+		Gas:       stuck.Gas(),
+		Value:     stuck.Value(),
+		Data:      stuck.Data(),
+		GasTipCap: gasTip,
+		GasFeeCap: gasFeeCap,
+	})
+
+	signedTx, err := types.SignTx(tx, types.LatestSignerForChainID(stuck.ChainId()), ps.privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	err = ps.ethClient().SendTransaction(ctx, signedTx)
+	if err != nil {
+		txLog.WithError(err).Error("replacement transaction wasn't sent")
+		return "", err
+	}
+	txLog.WithField("tx_hash", signedTx.Hash().Hex()).Log(ps.txLogLevel, "sent replacement transaction")
+
+	return signedTx.Hash().Hex(), nil
+}
+
+// bumpFee raises the fee by pct percent, rounding up so the increase is never below pct
+func bumpFee(fee *big.Int, pct float64) *big.Int {
+	basisPoints := big.NewInt(10000 + int64(math.Ceil(pct*100)))
+	bumped := new(big.Int).Mul(fee, basisPoints)
+
+	q, r := new(big.Int).QuoRem(bumped, big.NewInt(10000), new(big.Int))
+	if r.Sign() > 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	return q
+}
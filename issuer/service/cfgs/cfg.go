@@ -76,8 +76,53 @@ func setConfigDefaults() {
 	viper.SetDefault("DB_FILE_PATH", "issuer.db")
 	viper.SetDefault("RESET_DB", true)
 	viper.SetDefault("LOCAL_URL", "localhost:8001")
+	viper.SetDefault("READ_TIMEOUT", "10s")
+	viper.SetDefault("WRITE_TIMEOUT", "30s")
+	viper.SetDefault("PUBLISH_TIMEOUT", "5m")
+	viper.SetDefault("PUBLISH_MODE", "queue")
+	viper.SetDefault("HTTP2", true)
+	viper.SetDefault("KEEP_ALIVE", true)
+	viper.SetDefault("IDLE_TIMEOUT", "2m")
+	viper.SetDefault("CLAIMS_TREE_DEPTH", 32)
+	viper.SetDefault("REVOCATION_TREE_DEPTH", 32)
+	viper.SetDefault("ROOTS_TREE_DEPTH", 32)
+	viper.SetDefault("JANITOR_INTERVAL", "10m")
+	viper.SetDefault("CLAIM_ARCHIVE", false)
+	viper.SetDefault("CLAIM_ARCHIVE_GRACE_PERIOD", "720h")
+	viper.SetDefault("CLAIM_MAX_ISSUANCE_SKEW", "5m")
+	viper.SetDefault("STRICT_ISSUANCE", false)
+	viper.SetDefault("SUBJECT_BLINDING", false)
+	viper.SetDefault("BULK_ISSUANCE_MODE", "best_effort")
+	viper.SetDefault("PROOF_UPGRADE_NOTIFICATIONS", false)
+	viper.SetDefault("SHUTDOWN_TIMEOUT", "30s")
 	viper.SetDefault("PUBLISHING_CONTRACT_ADDRESS", "0x46Fd04eEa588a3EA7e9F055dd691C688c4148ab3")
+	viper.SetDefault("RPC_FAILOVER_AFTER", 3)
+	viper.SetDefault("CONFIRMATIONS", 3)
+	viper.SetDefault("GAS_TIP_CAP_FALLBACK", 30000000000) // 30 gwei
+	viper.SetDefault("MIN_GAS_TIP_CAP", 0)
+	viper.SetDefault("BASE_FEE_MULTIPLIER", 1.25)
+	viper.SetDefault("MAX_GAS_FEE_CAP", 0)
+	viper.SetDefault("LOG_TX_LIFECYCLE", true)
+	viper.SetDefault("BLOCKCHAIN", "polygon")
+	viper.SetDefault("NETWORK", "test")
 	viper.SetDefault("CIRCUITS_DIR", "keys")
 	viper.SetDefault("IPFS_URL", "ipfs.io")
+	viper.SetDefault("SCHEMA_LOAD_ATTEMPTS", 3)
+	viper.SetDefault("SCHEMA_LOAD_BACKOFF", "500ms")
+	viper.SetDefault("SCHEMA_LOAD_MAX_BACKOFF", "10s")
+	viper.SetDefault("SCHEMA_LOAD_JITTER", 0.2)
+	viper.SetDefault("SCHEMA_LOAD_CONCURRENCY", 8)
+	viper.SetDefault("SCHEMA_LOAD_QUEUE_TIMEOUT", "2s")
+	viper.SetDefault("SCHEMA_CACHE_TTL", "1h")
+	viper.SetDefault("ALLOW_RESET", false)
+	viper.SetDefault("SCHEMA_LOAD_TIMEOUT", "30s")
+	viper.SetDefault("REVOCATION_BATCH_WORKERS", 8)
+	viper.SetDefault("HTTP_CLIENT_TIMEOUT", "30s")
+	viper.SetDefault("REV_NONCE_BITS", 32)
+	viper.SetDefault("MAX_REQUEST_BODY_SIZE", 1<<20) // 1 MiB
+	viper.SetDefault("MAX_BULK_BODY_SIZE", 16<<20)   // 16 MiB
+	viper.SetDefault("LOG_FORMAT", "json")
+	viper.SetDefault("LOG_OUTPUT", "stdout")
+	viper.SetDefault("ARWEAVE_GATEWAY_URL", "https://arweave.net")
 }
 
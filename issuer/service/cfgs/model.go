@@ -1,19 +1,160 @@
 package cfgs
 
+import "time"
+
 type IssuerConfig struct {
 	LogLevel string `mapstructure:"LOG_LEVEL" yaml:"log_level"`
+	// LogFormat is either json or text, LogOutput is stdout, stderr or the path of a file, reopened on SIGHUP
+	LogFormat string `mapstructure:"LOG_FORMAT" yaml:"log_format"`
+	LogOutput string `mapstructure:"LOG_OUTPUT" yaml:"log_output"`
 
 	DBFilePath string `mapstructure:"DB_FILE_PATH" yaml:"db_file_path"`
 	ResetDb    bool   `mapstructure:"RESET_DB" yaml:"reset_db"`
 
+	// The depths of the identity's merkle trees, they can't be changed once the trees hold leaves
+	ClaimsTreeDepth     int `mapstructure:"CLAIMS_TREE_DEPTH" yaml:"claims_tree_depth"`
+	RevocationTreeDepth int `mapstructure:"REVOCATION_TREE_DEPTH" yaml:"revocation_tree_depth"`
+	RootsTreeDepth      int `mapstructure:"ROOTS_TREE_DEPTH" yaml:"roots_tree_depth"`
+
 	LocalUrl  string `mapstructure:"LOCAL_URL" yaml:"local_url"`
 	PublicUrl string `mapstructure:"PUBLIC_URL" yaml:"public_url"`
 
+	ReadTimeout    time.Duration `mapstructure:"READ_TIMEOUT" yaml:"read_timeout"`
+	WriteTimeout   time.Duration `mapstructure:"WRITE_TIMEOUT" yaml:"write_timeout"`
+	PublishTimeout time.Duration `mapstructure:"PUBLISH_TIMEOUT" yaml:"publish_timeout"`
+	PublishMode    string        `mapstructure:"PUBLISH_MODE" yaml:"publish_mode"`
+
+	TLSCertFile string        `mapstructure:"TLS_CERT_FILE" yaml:"tls_cert_file"`
+	TLSKeyFile  string        `mapstructure:"TLS_KEY_FILE" yaml:"tls_key_file"`
+	HTTP2       bool          `mapstructure:"HTTP2" yaml:"http2"`
+	KeepAlive   bool          `mapstructure:"KEEP_ALIVE" yaml:"keep_alive"`
+	IdleTimeout time.Duration `mapstructure:"IDLE_TIMEOUT" yaml:"idle_timeout"`
+
+	JanitorInterval         time.Duration `mapstructure:"JANITOR_INTERVAL" yaml:"janitor_interval"`
+	ClaimArchive            bool          `mapstructure:"CLAIM_ARCHIVE" yaml:"claim_archive"`
+	ClaimArchiveGracePeriod time.Duration `mapstructure:"CLAIM_ARCHIVE_GRACE_PERIOD" yaml:"claim_archive_grace_period"`
+	ClaimMaxIssuanceSkew    time.Duration `mapstructure:"CLAIM_MAX_ISSUANCE_SKEW" yaml:"claim_max_issuance_skew"`
+	StrictIssuance          bool          `mapstructure:"STRICT_ISSUANCE" yaml:"strict_issuance"`
+	BulkIssuanceMode        string        `mapstructure:"BULK_ISSUANCE_MODE" yaml:"bulk_issuance_mode"`
+	ShutdownTimeout         time.Duration `mapstructure:"SHUTDOWN_TIMEOUT" yaml:"shutdown_timeout"`
+
+	// SubjectBlinding blinds the subject id of every claim with a salt of its own, so the claims of a subject can't
+	// be linked by their id slot. The holder is given the salt with the credential.
+	SubjectBlinding bool `mapstructure:"SUBJECT_BLINDING" yaml:"subject_blinding"`
+
+	ProofUpgradeNotifications bool   `mapstructure:"PROOF_UPGRADE_NOTIFICATIONS" yaml:"proof_upgrade_notifications"`
+	ProofUpgradeWebhookUrl    string `mapstructure:"PROOF_UPGRADE_WEBHOOK_URL" yaml:"proof_upgrade_webhook_url"`
+
+	// ReverseHashServiceUrl is the reverse hash service mirroring the published states, credentials can have their
+	// revocation checked on it when it's set
+	ReverseHashServiceUrl string `mapstructure:"REVERSE_HASH_SERVICE_URL" yaml:"reverse_hash_service_url"`
+
+	// PublishingDisabled runs the issuer without a blockchain node: the states aren't published and the on-chain
+	// lookups are skipped
+	PublishingDisabled bool `mapstructure:"PUBLISHING_DISABLED" yaml:"publishing_disabled"`
+
 	NodeRpcUrl                string `mapstructure:"NODE_RPC_URL" yaml:"node_rpc_url"`
 	PublishingContractAddress string `mapstructure:"PUBLISHING_CONTRACT_ADDRESS" yaml:"publishing_contract_address"`
 	PublishingPrivateKey      string `mapstructure:"PUBLISHING_PRIVATE_KEY" yaml:"publishing_private_key"`
+	GasTipCapFallback         int64  `mapstructure:"GAS_TIP_CAP_FALLBACK" yaml:"gas_tip_cap_fallback"`
+	MinGasTipCap              int64  `mapstructure:"MIN_GAS_TIP_CAP" yaml:"min_gas_tip_cap"`
+	LogTxLifecycle            bool   `mapstructure:"LOG_TX_LIFECYCLE" yaml:"log_tx_lifecycle"`
+
+	// BaseFeeMultiplier is the margin on the next block's base fee, MaxGasFeeCap bounds the fee per gas (0 doesn't)
+	BaseFeeMultiplier float64 `mapstructure:"BASE_FEE_MULTIPLIER" yaml:"base_fee_multiplier"`
+	MaxGasFeeCap      int64   `mapstructure:"MAX_GAS_FEE_CAP" yaml:"max_gas_fee_cap"`
+
+	// BackupNodeRpcUrls are polled for the confirmation of a transaction once the active endpoint keeps failing
+	BackupNodeRpcUrls []string `mapstructure:"BACKUP_NODE_RPC_URLS" yaml:"backup_node_rpc_urls"`
+	RpcFailoverAfter  int      `mapstructure:"RPC_FAILOVER_AFTER" yaml:"rpc_failover_after"`
+
+	// Confirmations is the number of blocks a state transition is buried under before it's treated as final
+	Confirmations int `mapstructure:"CONFIRMATIONS" yaml:"confirmations"`
+
+	Blockchain             string   `mapstructure:"BLOCKCHAIN" yaml:"blockchain"`
+	Network                string   `mapstructure:"NETWORK" yaml:"network"`
+	SubjectNetworkPolicy   string   `mapstructure:"SUBJECT_NETWORK_POLICY" yaml:"subject_network_policy"`
+	AllowedSubjectNetworks []string `mapstructure:"ALLOWED_SUBJECT_NETWORKS" yaml:"allowed_subject_networks"`
 
 	CircuitsDir       string `mapstructure:"CIRCUITS_DIR" yaml:"circuits_dir"`
 	IpfsUrl           string `mapstructure:"IPFS_URL" yaml:"ipfs_url"`
 	IdentitySecretKey string `mapstructure:"IDENTITY_SECRET_KEY" yaml:"identity_secret_key"`
+	AdminApiKey       string `mapstructure:"ADMIN_API_KEY" yaml:"admin_api_key"`
+
+	// TenantSecretKeys are the hex keys of the tenant identities sharing the DB, each one is served under its own path
+	TenantSecretKeys []string `mapstructure:"TENANT_SECRET_KEYS" yaml:"tenant_secret_keys"`
+
+	// BackupPassphrase encrypts the identity backups, the backups can't be exported without it
+	BackupPassphrase string `mapstructure:"BACKUP_PASSPHRASE" yaml:"backup_passphrase"`
+
+	// APIKeys are the bearer tokens accepted by the issuance, revocation and publish endpoints, they're open when
+	// it's empty
+	APIKeys []string `mapstructure:"API_KEYS" yaml:"api_keys"`
+
+	// MaxRequestBodySize bounds the bodies of the claim requests in bytes, 0 doesn't
+	MaxRequestBodySize int64 `mapstructure:"MAX_REQUEST_BODY_SIZE" yaml:"max_request_body_size"`
+	// MaxBulkBodySize bounds the bodies of the bulk uploads in bytes, 0 doesn't
+	MaxBulkBodySize int64 `mapstructure:"MAX_BULK_BODY_SIZE" yaml:"max_bulk_body_size"`
+
+	// AllowReset serves the admin endpoint wiping the identity, for development only
+	AllowReset bool `mapstructure:"ALLOW_RESET" yaml:"allow_reset"`
+
+	SchemaLoadAttempts int           `mapstructure:"SCHEMA_LOAD_ATTEMPTS" yaml:"schema_load_attempts"`
+	SchemaLoadBackoff  time.Duration `mapstructure:"SCHEMA_LOAD_BACKOFF" yaml:"schema_load_backoff"`
+
+	SchemaLoadMaxBackoff time.Duration `mapstructure:"SCHEMA_LOAD_MAX_BACKOFF" yaml:"schema_load_max_backoff"`
+	SchemaLoadJitter     float64       `mapstructure:"SCHEMA_LOAD_JITTER" yaml:"schema_load_jitter"`
+
+	SchemaLoadConcurrency  int           `mapstructure:"SCHEMA_LOAD_CONCURRENCY" yaml:"schema_load_concurrency"`
+	SchemaLoadQueueTimeout time.Duration `mapstructure:"SCHEMA_LOAD_QUEUE_TIMEOUT" yaml:"schema_load_queue_timeout"`
+
+	// SchemaLoadTimeout bounds a download of a schema with its retries, and the download from each IPFS gateway.
+	// 0 doesn't bound them.
+	SchemaLoadTimeout time.Duration `mapstructure:"SCHEMA_LOAD_TIMEOUT" yaml:"schema_load_timeout"`
+	// IpfsGateways are tried in order when the IPFS node of IpfsUrl fails to serve a schema
+	IpfsGateways []string `mapstructure:"IPFS_GATEWAYS" yaml:"ipfs_gateways"`
+	// ArweaveGatewayUrl serves the schemas of the ar:// and arweave:// urls, e.g. https://arweave.net
+	ArweaveGatewayUrl string `mapstructure:"ARWEAVE_GATEWAY_URL" yaml:"arweave_gateway_url"`
+
+	// HTTPClientTimeout bounds every request of the outgoing HTTP calls, schema downloads and webhooks. 0 doesn't bound
+	// them, for endpoints that long-poll.
+	HTTPClientTimeout time.Duration `mapstructure:"HTTP_CLIENT_TIMEOUT" yaml:"http_client_timeout"`
+
+	// SchemaCacheTTL is how long a downloaded schema is served from the cache, 0 disables the caching
+	SchemaCacheTTL time.Duration `mapstructure:"SCHEMA_CACHE_TTL" yaml:"schema_cache_ttl"`
+
+	RevocationBatchWorkers int `mapstructure:"REVOCATION_BATCH_WORKERS" yaml:"revocation_batch_workers"`
+
+	// RevNonceBits is the size of the revocation nonces generated for the claims requested without one. The wallets
+	// reading the nonces as JS numbers cut the ones larger than 53 bits.
+	RevNonceBits int `mapstructure:"REV_NONCE_BITS" yaml:"rev_nonce_bits"`
+
+	Schemas    []SchemaConfig `mapstructure:"SCHEMAS" yaml:"schemas"`
+	SchemasDir string         `mapstructure:"SCHEMAS_DIR" yaml:"schemas_dir"`
+
+	// SchemaFilesDir is the directory the file:// schema urls are read from, empty disables them
+	SchemaFilesDir string `mapstructure:"SCHEMA_FILES_DIR" yaml:"schema_files_dir"`
+
+	Templates []ClaimTemplate `mapstructure:"TEMPLATES" yaml:"templates"`
+}
+
+// SchemaConfig describes a credential type the issuer is able to issue
+type SchemaConfig struct {
+	URL         string `mapstructure:"URL" yaml:"url"`
+	Type        string `mapstructure:"TYPE" yaml:"type"`
+	DisplayName string `mapstructure:"DISPLAY_NAME" yaml:"display_name"`
+	// SingleActive is the policy for a credential of the type issued to a subject holding an active one:
+	// empty allows it, "reject" refuses it and "supersede" revokes the held one
+	SingleActive string `mapstructure:"SINGLE_ACTIVE" yaml:"single_active"`
+}
+
+// ClaimTemplate pre-fills the parts of a claim request that are the same for every credential of a kind
+type ClaimTemplate struct {
+	Name            string `mapstructure:"NAME" yaml:"name"`
+	SchemaURL       string `mapstructure:"SCHEMA_URL" yaml:"schema_url"`
+	SchemaType      string `mapstructure:"SCHEMA_TYPE" yaml:"schema_type"`
+	SubjectPosition string `mapstructure:"SUBJECT_POSITION" yaml:"subject_position"`
+	// Expiration is the validity period of the credential from its issuance, 0 issues credentials that don't expire
+	Expiration     time.Duration `mapstructure:"EXPIRATION" yaml:"expiration"`
+	RequiredFields []string      `mapstructure:"REQUIRED_FIELDS" yaml:"required_fields"`
 }
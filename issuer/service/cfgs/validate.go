@@ -1,12 +1,39 @@
 package cfgs
 
-import "fmt"
+import (
+	"encoding/hex"
+	"fmt"
+	"net/url"
+)
+
+// supportedNetworks are the networks of the DID method, by blockchain
+var supportedNetworks = map[string][]string{
+	"eth":     {"main", "test", "ropsten", "rinkeby", "kovan"},
+	"polygon": {"main", "test", "mumbai"},
+}
+
+func isSupportedNetwork(blockchain, network string) bool {
+	for _, n := range supportedNetworks[blockchain] {
+		if n == network {
+			return true
+		}
+	}
+	return false
+}
 
 func validateConfig(cfg *IssuerConfig) error {
 	if len(cfg.LogLevel) < 4 {
 		return fmt.Errorf(`the config parameter "log_level" wasn't specified'`)
 	}
 
+	if cfg.LogFormat != "json" && cfg.LogFormat != "text" {
+		return fmt.Errorf(`the config parameter "log_format" must be either "json" or "text"`)
+	}
+
+	if len(cfg.LogOutput) == 0 {
+		return fmt.Errorf(`the config parameter "log_output" wasn't specified'`)
+	}
+
 	if len(cfg.DBFilePath) == 0 {
 		return fmt.Errorf(`the config parameter "db_file_path" wasn't specified'`)
 	}
@@ -19,16 +46,61 @@ func validateConfig(cfg *IssuerConfig) error {
 		return fmt.Errorf(`the config parameter "public_url" wasn't specified'`)
 	}
 
-	if len(cfg.NodeRpcUrl) == 0 {
-		return fmt.Errorf(`the config parameter "node_rpc_url" wasn't specified'`)
+	if !isSupportedNetwork(cfg.Blockchain, cfg.Network) {
+		return fmt.Errorf(`the config parameters "blockchain" and "network" name %s:%s, which isn't a supported DID network`,
+			cfg.Blockchain, cfg.Network)
 	}
 
-	if len(cfg.PublishingContractAddress) < 32 {
-		return fmt.Errorf(`the config parameter "publishing_contract_address" wasn't specified'`)
+	if cfg.MaxRequestBodySize < 0 {
+		return fmt.Errorf(`the config parameter "max_request_body_size" can't be negative`)
+	}
+	if cfg.MaxBulkBodySize < 0 {
+		return fmt.Errorf(`the config parameter "max_bulk_body_size" can't be negative`)
+	}
+
+	for _, k := range cfg.APIKeys {
+		if k == "" {
+			return fmt.Errorf(`the config parameter "api_keys" can't hold an empty key`)
+		}
+	}
+
+	if cfg.SubjectNetworkPolicy != "" && cfg.SubjectNetworkPolicy != "match" && cfg.SubjectNetworkPolicy != "strict" {
+		return fmt.Errorf(`the config parameter "subject_network_policy" must be either "match" or "strict"`)
+	}
+
+	if cfg.RpcFailoverAfter <= 0 {
+		return fmt.Errorf(`the config parameter "rpc_failover_after" must be positive`)
 	}
 
-	if len(cfg.PublishingPrivateKey) < 32 {
-		return fmt.Errorf(`the config parameter "publishing_private_key" wasn't specified'`)
+	if cfg.Confirmations < 0 {
+		return fmt.Errorf(`the config parameter "confirmations" can't be negative`)
+	}
+
+	// the node and the publishing account are only needed to publish the states
+	if !cfg.PublishingDisabled {
+		if len(cfg.NodeRpcUrl) == 0 {
+			return fmt.Errorf(`the config parameter "node_rpc_url" wasn't specified'`)
+		}
+
+		if len(cfg.PublishingContractAddress) < 32 {
+			return fmt.Errorf(`the config parameter "publishing_contract_address" wasn't specified'`)
+		}
+
+		if len(cfg.PublishingPrivateKey) < 32 {
+			return fmt.Errorf(`the config parameter "publishing_private_key" wasn't specified'`)
+		}
+	}
+
+	if cfg.GasTipCapFallback < 0 || cfg.MinGasTipCap < 0 {
+		return fmt.Errorf(`the config parameters "gas_tip_cap_fallback" and "min_gas_tip_cap" can't be negative`)
+	}
+
+	if cfg.BaseFeeMultiplier < 1 {
+		return fmt.Errorf(`the config parameter "base_fee_multiplier" can't be below 1, got %v`, cfg.BaseFeeMultiplier)
+	}
+
+	if cfg.MaxGasFeeCap < 0 {
+		return fmt.Errorf(`the config parameter "max_gas_fee_cap" can't be negative`)
 	}
 
 	if len(cfg.CircuitsDir) == 0 {
@@ -39,5 +111,107 @@ func validateConfig(cfg *IssuerConfig) error {
 		return fmt.Errorf(`the config parameter "ipfs_url" wasn't specified'`)
 	}
 
+	if u, err := url.Parse(cfg.ArweaveGatewayUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf(`the config parameter "arweave_gateway_url" must be an http(s) url`)
+	}
+
+	if cfg.SchemaLoadAttempts < 1 {
+		return fmt.Errorf(`the config parameter "schema_load_attempts" must be at least 1`)
+	}
+
+	if cfg.SchemaLoadJitter < 0 || cfg.SchemaLoadJitter > 1 {
+		return fmt.Errorf(`the config parameter "schema_load_jitter" must be between 0 and 1`)
+	}
+
+	if cfg.SchemaLoadQueueTimeout < 0 {
+		return fmt.Errorf(`the config parameter "schema_load_queue_timeout" can't be negative`)
+	}
+
+	if cfg.SchemaLoadTimeout < 0 {
+		return fmt.Errorf(`the config parameter "schema_load_timeout" can't be negative`)
+	}
+
+	if cfg.HTTPClientTimeout < 0 {
+		return fmt.Errorf(`the config parameter "http_client_timeout" can't be negative`)
+	}
+
+	if cfg.SchemaCacheTTL < 0 {
+		return fmt.Errorf(`the config parameter "schema_cache_ttl" can't be negative`)
+	}
+
+	if cfg.SchemaLoadConcurrency < 1 {
+		return fmt.Errorf(`the config parameter "schema_load_concurrency" must be at least 1`)
+	}
+
+	if cfg.RevocationBatchWorkers < 1 {
+		return fmt.Errorf(`the config parameter "revocation_batch_workers" must be at least 1`)
+	}
+
+	if cfg.RevNonceBits < 16 || cfg.RevNonceBits > 64 {
+		return fmt.Errorf(`the config parameter "rev_nonce_bits" must be between 16 and 64`)
+	}
+
+	if cfg.PublishMode != "queue" && cfg.PublishMode != "reject" {
+		return fmt.Errorf(`the config parameter "publish_mode" must be either "queue" or "reject"`)
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return fmt.Errorf(`the config parameters "tls_cert_file" and "tls_key_file" must be specified together`)
+	}
+
+	if cfg.IdleTimeout < 0 {
+		return fmt.Errorf(`the config parameter "idle_timeout" can't be negative`)
+	}
+
+	if cfg.JanitorInterval <= 0 {
+		return fmt.Errorf(`the config parameter "janitor_interval" must be positive`)
+	}
+
+	if cfg.ClaimArchiveGracePeriod < 0 {
+		return fmt.Errorf(`the config parameter "claim_archive_grace_period" can't be negative`)
+	}
+
+	if cfg.BulkIssuanceMode != "best_effort" && cfg.BulkIssuanceMode != "all_or_nothing" {
+		return fmt.Errorf(`the config parameter "bulk_issuance_mode" must be either "best_effort" or "all_or_nothing"`)
+	}
+
+	if cfg.ClaimMaxIssuanceSkew < 0 {
+		return fmt.Errorf(`the config parameter "claim_max_issuance_skew" can't be negative`)
+	}
+
+	for i, s := range cfg.Schemas {
+		if len(s.URL) == 0 || len(s.Type) == 0 {
+			return fmt.Errorf(`the config parameter "schemas[%d]" must specify both "url" and "type"`, i)
+		}
+		if s.SingleActive != "" && s.SingleActive != "reject" && s.SingleActive != "supersede" {
+			return fmt.Errorf(`the config parameter "schemas[%d].single_active" must be either "reject" or "supersede"`, i)
+		}
+	}
+
+	tenants := make(map[string]bool, len(cfg.TenantSecretKeys))
+	for i, k := range cfg.TenantSecretKeys {
+		if b, err := hex.DecodeString(k); err != nil || len(b) != 32 {
+			return fmt.Errorf(`the config parameter "tenant_secret_keys[%d]" must be a hex encoded 32 bytes key`, i)
+		}
+		if tenants[k] || k == cfg.IdentitySecretKey {
+			return fmt.Errorf(`the config parameter "tenant_secret_keys[%d]" duplicates the key of another identity`, i)
+		}
+		tenants[k] = true
+	}
+
+	templates := make(map[string]bool, len(cfg.Templates))
+	for i, t := range cfg.Templates {
+		if len(t.Name) == 0 || len(t.SchemaURL) == 0 || len(t.SchemaType) == 0 {
+			return fmt.Errorf(`the config parameter "templates[%d]" must specify "name", "schema_url" and "schema_type"`, i)
+		}
+		if templates[t.Name] {
+			return fmt.Errorf(`the config parameter "templates[%d]" duplicates the template name "%s"`, i, t.Name)
+		}
+		if t.SubjectPosition != "" && t.SubjectPosition != "index" && t.SubjectPosition != "value" {
+			return fmt.Errorf(`the config parameter "templates[%d].subject_position" must be either "index" or "value"`, i)
+		}
+		templates[t.Name] = true
+	}
+
 	return nil
 }
@@ -28,6 +28,16 @@ const (
 	BabyJubSignatureType = "BJJSignature2021"
 )
 
+// EvidenceTerm is the credential subject term under which the URN of the referenced credential is embedded
+const EvidenceTerm = "evidence"
+
+// SubjectSaltTerm is the credential subject term under which the salt of a blinded subject id is given to the holder,
+// who needs it to prove the claim is about them
+const SubjectSaltTerm = "subjectSalt"
+
+// credentialIDNamespace is the namespace of the name based (v5) uuids used as credential ids
+var credentialIDNamespace = uuid.MustParse("71aa02b0-3511-4bed-af8e-471590d52b8f")
+
 type Claim struct {
 	ID               uuid.UUID
 	Identifier       string
@@ -49,6 +59,14 @@ type Claim struct {
 	Status           string
 	CredentialStatus []byte
 	HIndex           string
+	Evidence         *uuid.UUID
+	// SignatureOnly claims are proven by the signature proof alone, they aren't added to the claims tree
+	SignatureOnly bool
+	// IssuanceDate is the unix time the claim was issued at, 0 for the claims issued before it was recorded
+	IssuanceDate int64
+	// SubjectSalt is the decimal salt the subject id is blinded with in the core claim, empty when the core claim holds
+	// the subject id as is. OtherIdentifier is the subject id either way.
+	SubjectSalt string
 }
 
 type CoreClaimData struct {
@@ -59,6 +77,8 @@ type CoreClaimData struct {
 	Version         uint32
 	Nonce           *uint64
 	SubjectPosition string
+	// SubjectSalt blinds the subject id held by the claim when it's set
+	SubjectSalt *big.Int
 }
 
 // GenerateCoreClaim generate core claim via settings from CoreClaimData.
@@ -98,6 +118,12 @@ func GenerateCoreClaim(req *CoreClaimData) (*core.Claim, error) {
 		if err != nil {
 			return nil, err
 		}
+		if req.SubjectSalt != nil {
+			userID, err = BlindSubjectID(userID, req.SubjectSalt)
+			if err != nil {
+				return nil, err
+			}
+		}
 
 		switch req.SubjectPosition {
 		case "", SubjectPositionIndex:
@@ -115,6 +141,58 @@ func GenerateCoreClaim(req *CoreClaimData) (*core.Claim, error) {
 	return coreClaim, nil
 }
 
+// NewSubjectSalt generates a random salt to blind a subject id with, it fits the field of the poseidon hash
+func NewSubjectSalt() (*big.Int, error) {
+	var buf [31]byte
+	_, err := rand.Read(buf[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(buf[:]), nil
+}
+
+// BlindSubjectID blinds the subject id with the salt. The blinded id keeps the type of the subject id, its genesis is
+// the low 27 bytes of poseidon(id, salt), so the claims issued to a subject with different salts can't be linked
+// while the holder knowing the salt can open the hash.
+func BlindSubjectID(id core.ID, salt *big.Int) (core.ID, error) {
+	h, err := poseidon.Hash([]*big.Int{id.BigInt(), salt})
+	if err != nil {
+		return core.ID{}, err
+	}
+
+	var b [32]byte
+	h.FillBytes(b[:])
+	var typ [2]byte
+	copy(typ[:], id[:2])
+	var genesis [27]byte
+	copy(genesis[:], b[len(b)-len(genesis):])
+
+	return core.NewID(typ, genesis), nil
+}
+
+// CoreSubjectID is the subject id as the core claim holds it, blinded with the subject salt when the claim has one
+func (c *Claim) CoreSubjectID() (string, error) {
+	if c.SubjectSalt == "" || c.OtherIdentifier == "" {
+		return c.OtherIdentifier, nil
+	}
+
+	id, err := core.IDFromString(c.OtherIdentifier)
+	if err != nil {
+		return "", err
+	}
+	salt, ok := new(big.Int).SetString(c.SubjectSalt, 10)
+	if !ok {
+		return "", fmt.Errorf("invalid subject salt of claim %s", c.ID)
+	}
+	blinded, err := BlindSubjectID(id, salt)
+	if err != nil {
+		return "", err
+	}
+
+	return blinded.String(), nil
+}
+
 func CoreClaimToClaimModel(claim *core.Claim, schemaURL, schemaType string) (*Claim, error) {
 	otherIdentifier := ""
 	id, err := claim.GetID()
@@ -151,6 +229,28 @@ func CoreClaimToClaimModel(claim *core.Claim, schemaURL, schemaType string) (*Cl
 	return &res, nil
 }
 
+// CredentialID derives the id of the credential from the hashes of the claim's index and value, so the same
+// claim always gets the same printable id. The index alone doesn't tell the issued claims apart: the signature-only
+// claims and the claims with the subject in the value share it, their value holds the revocation nonce of each.
+// The id is a uuid, its URN form is returned by CredentialURN.
+func CredentialID(claim *core.Claim) (uuid.UUID, error) {
+	hIndex, hValue, err := claim.HiHv()
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	var name [64]byte
+	hIndex.FillBytes(name[:32])
+	hValue.FillBytes(name[32:])
+
+	return uuid.NewSHA1(credentialIDNamespace, name[:]), nil
+}
+
+// CredentialURN returns the URN form (urn:uuid:...) of a credential id, for referencing the credential from other systems
+func CredentialURN(id uuid.UUID) string {
+	return id.URN()
+}
+
 func NewAuthClaim(key *babyjub.PublicKey, schemaHash core.SchemaHash) (*core.Claim, error) {
 	revNonce, err := Rand()
 	if err != nil {
@@ -162,9 +262,26 @@ func NewAuthClaim(key *babyjub.PublicKey, schemaHash core.SchemaHash) (*core.Cla
 		core.WithRevocationNonce(revNonce))
 }
 
+// Iden3ReverseSparseMerkleTreeProof credentials have their revocation checked on a reverse hash service mirroring
+// the published states of the issuer, so the verifiers don't depend on the issuer being up
+const Iden3ReverseSparseMerkleTreeProof verifiable.CredentialStatusType = "Iden3ReverseSparseMerkleTreeProof"
+
+// CreateCredentialStatus builds the credential status of the type. urlBase is the issuer's for a SparseMerkleTreeProof
+// status, pointing at its revocation endpoint, and the reverse hash service's for an Iden3ReverseSparseMerkleTreeProof
+// status, the revocation nonce is found on the credential.
 func CreateCredentialStatus(urlBase string, sType verifiable.CredentialStatusType, revNonce uint64) ([]byte, error) {
+	var id string
+	switch sType {
+	case verifiable.SparseMerkleTreeProof:
+		id = fmt.Sprintf("%s/api/v1/claims/revocations/%d", urlBase, revNonce)
+	case Iden3ReverseSparseMerkleTreeProof:
+		id = urlBase
+	default:
+		return nil, fmt.Errorf("unsupported credential status type %s", sType)
+	}
+
 	cStatus := verifiable.CredentialStatus{
-		ID:   fmt.Sprintf("%s/api/v1/claims/revocations/%d", urlBase, revNonce),
+		ID:   id,
 		Type: sType,
 	}
 
@@ -272,6 +389,12 @@ func ClaimModelToIden3Credential(c *Claim) (*verifiable.Iden3Credential, error)
 	if len(c.OtherIdentifier) > 0 {
 		credSubjects["id"] = c.OtherIdentifier
 	}
+	if c.Evidence != nil {
+		credSubjects[EvidenceTerm] = CredentialURN(*c.Evidence)
+	}
+	if c.SubjectSalt != "" {
+		credSubjects[SubjectSaltTerm] = c.SubjectSalt
+	}
 
 	// * create proof object
 	proofs := make([]interface{}, 0)
@@ -329,11 +452,16 @@ func ClaimModelToIden3Credential(c *Claim) (*verifiable.Iden3Credential, error)
 	return res, nil
 }
 
+// getClaimIdPosition returns the position of the subject id in the claim, empty for a claim about the issuer itself,
+// e.g. its auth claim
 func getClaimIdPosition(c *core.Claim) (string, error) {
 	claimIdPos, err := c.GetIDPosition()
 	if err != nil {
 		return "", err
 	}
+	if claimIdPos == core.IDPositionNone {
+		return "", nil
+	}
 
 	return subjectPositionIDToString(claimIdPos)
 }
@@ -368,3 +496,15 @@ func Rand() (uint64, error) {
 
 	return binary.LittleEndian.Uint64(buf[:]), err
 }
+
+// RandBits generates a random uint64 of at most the given number of bits (1 to 64)
+func RandBits(bits int) (uint64, error) {
+	var buf [8]byte
+	_, err := rand.Read(buf[:])
+
+	n := binary.LittleEndian.Uint64(buf[:])
+	if bits < 64 {
+		n &= 1<<uint(bits) - 1
+	}
+	return n, err
+}
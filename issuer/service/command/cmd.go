@@ -33,6 +33,13 @@ func NewHandler(
 	}
 }
 
+// WithIssuer returns a copy of the handler for the given issuer identifier
+func (comm *Handler) WithIssuer(issuerIdentifier *core.ID) *Handler {
+	h := *comm
+	h.issuerIdentifier = issuerIdentifier
+	return &h
+}
+
 // Handle POST /api/v1/agent
 func (comm *Handler) Handle(body []byte) (*protocol.CredentialIssuanceMessage, error) {
 	logger.Debug("CommandHandler.Handle() invoked")
@@ -62,7 +69,7 @@ func (comm *Handler) Handle(body []byte) (*protocol.CredentialIssuanceMessage, e
 		return nil, fmt.Errorf("invalid claim id in fetch request body, err: %v", err)
 	}
 
-	c, err := comm.idenState.Claims.GetClaim([]byte(claimID.String()))
+	c, err := comm.idenState.Claims.GetClaim(claimID)
 	if err != nil {
 		return nil, err
 	}
@@ -70,7 +77,7 @@ func (comm *Handler) Handle(body []byte) (*protocol.CredentialIssuanceMessage, e
 		return nil, err
 	}
 
-	if !comm.idenState.CommittedState.IsLatestStateGenesis {
+	if !comm.idenState.SnapshotCommittedState().IsLatestStateGenesis && !c.SignatureOnly {
 		claimIdx, err := c.CoreClaim.HIndex()
 		if err != nil {
 			return nil, err
@@ -39,6 +39,13 @@ type Handler struct {
 	ipfsUrl    string
 }
 
+// WithIssuer returns a copy of the handler for the given issuer identifier
+func (h *Handler) WithIssuer(issuerId string) *Handler {
+	c := *h
+	c.issuerId = issuerId
+	return &c
+}
+
 // sending sign in request to the client (move it to the issuer communication (identity))
 func (h *Handler) GetAuthVerificationRequest() ([]byte, string, error) {
 	logger.Debug("Communication.GetAuthVerificationRequest() invoked")
@@ -68,7 +75,7 @@ func verifySupportedAgeCircuit(circuitType string) error {
 		return nil
 	}
 
-	return fmt.Errorf("'%s' unsupported circuit type")
+	return fmt.Errorf("'%s' unsupported circuit type", circuitType)
 }
 
 func (h *Handler) GetAgeVerificationRequest(circuitType string) ([]byte, string, error) {
@@ -212,3 +219,15 @@ func (h *Handler) GetRequestStatus(id string) ([]byte, error) {
 
 	return nil, fmt.Errorf("unknown item return from tracker (type %T)", item)
 }
+
+// PruneSessions evicts the expired user sessions and returns the number of evicted sessions
+func PruneSessions() (int, error) {
+	before := userSessionTracker.ItemCount()
+	userSessionTracker.DeleteExpired()
+
+	evicted := before - userSessionTracker.ItemCount()
+	if evicted < 0 { // sessions were added meanwhile
+		evicted = 0
+	}
+	return evicted, nil
+}
@@ -1,20 +1,29 @@
 package service
 
 import (
+	"context"
 	"encoding/hex"
+	"fmt"
 	"github.com/iden3/go-iden3-crypto/babyjub"
 	logger "github.com/sirupsen/logrus"
 	database "issuer/db"
+	httpclient "issuer/http"
 	"issuer/service/blockchain"
 	"issuer/service/cfgs"
+	"issuer/service/communication"
 	"issuer/service/http"
 	"issuer/service/identity"
 	"issuer/service/identity/state"
+	"issuer/service/janitor"
 	"issuer/service/schema"
+	stdhttp "net/http"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
-func CreateApp(altCfgPath string) error {
+// CreateApp boots the issuer, importing the identity of the backup file into the empty DB when the path is given
+func CreateApp(altCfgPath, backupPath string) error {
 	logger.Info("boot up issuer service")
 
 	logger.Info("loading Configuration")
@@ -24,21 +33,28 @@ func CreateApp(altCfgPath string) error {
 	}
 
 	logger.Info("setting up logger")
-	err = initGlobalLogger(cfg.LogLevel)
+	closeLog, err := initGlobalLogger(cfg.LogLevel, cfg.LogFormat, cfg.LogOutput)
 	if err != nil {
 		return err
 	}
+	defer closeLog()
 
 	logger.Info("creating DB")
 	db, err := database.New(cfg.DBFilePath, cfg.ResetDb)
 	if err != nil {
 		return err
 	}
-
-	logger.Info("creating identity state")
-	idenState, err := state.NewIdentityState(db)
-	if err != nil {
-		return err
+	// the DB is closed even when the writes in flight don't finish in time, bbolt drops the uncommitted ones
+	defer func() {
+		if dbErr := db.Close(); dbErr != nil {
+			logger.Errorf("can't close the DB, err: %v", dbErr)
+		}
+	}()
+
+	depths := state.TreeDepths{
+		Claims:      cfg.ClaimsTreeDepth,
+		Revocations: cfg.RevocationTreeDepth,
+		Roots:       cfg.RootsTreeDepth,
 	}
 
 	logger.Info("processing secret key")
@@ -47,23 +63,151 @@ func CreateApp(altCfgPath string) error {
 		return err
 	}
 
-	schemaBuilder := schema.NewBuilder(cfg.IpfsUrl)
+	schemaClient := httpclient.NewClientWithRetry(stdhttp.Client{Timeout: cfg.HTTPClientTimeout}, httpclient.RetryPolicy{
+		MaxAttempts: cfg.SchemaLoadAttempts,
+		BaseDelay:   cfg.SchemaLoadBackoff,
+		MaxDelay:    cfg.SchemaLoadMaxBackoff,
+		Jitter:      cfg.SchemaLoadJitter,
+	})
+	schemaBuilder := schema.NewBuilder(cfg, schemaClient)
+
+	// a nil state store keeps the identities off the chain
+	var stateManager identity.StateStore
+	if cfg.PublishingDisabled {
+		logger.Warn("publishing is disabled, the states won't be published")
+	} else {
+		stateManager, err = blockchain.NewStateManager(cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	var issuer *identity.Identity
+	if backupPath != "" {
+		logger.Infof("importing Identity from %s", backupPath)
+		backup, err := os.ReadFile(backupPath)
+		if err != nil {
+			return err
+		}
+		issuer, err = identity.Import(db, depths, backup, schemaBuilder, cfg, stateManager)
+		if err != nil {
+			return err
+		}
+	} else {
+		logger.Info("opening Identity")
+		issuer, err = identity.Open(db, schemaBuilder, sk, cfg, stateManager, depths)
+		if err != nil {
+			return err
+		}
+	}
 
-	stateManager, err := blockchain.NewStateManager(cfg.NodeRpcUrl, cfg.PublishingContractAddress, cfg.PublishingPrivateKey)
+	tenants, err := loadTenants(db, schemaBuilder, cfg, stateManager, depths)
 	if err != nil {
 		return err
 	}
 
-	logger.Info("creating Identity")
-	issuer, err := identity.New(idenState, schemaBuilder, sk, cfg, stateManager)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	j := janitor.New(cfg.JanitorInterval)
+	j.Register("sessions", communication.PruneSessions)
+	if cfg.ClaimArchive {
+		j.Register("claims", issuer.ArchiveClaims)
+		for _, t := range tenants {
+			j.Register("claims of "+t.Identifier().String(), t.ArchiveClaims)
+		}
+	}
+	janitorDone := make(chan struct{})
+	go func() {
+		defer close(janitorDone)
+		j.Run(ctx)
+	}()
+
+	s := http.NewServer(cfg, issuer, tenants)
+
+	logger.Infof("spining up API server @%s", cfg.LocalUrl)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Run()
+	}()
+
+	select {
+	case err = <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down issuer service")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// the claim writes are made by the requests, they're done once the server is shut down
+	err = s.Close(shutdownCtx)
 	if err != nil {
 		return err
 	}
+	if err = <-errCh; err != stdhttp.ErrServerClosed {
+		return err
+	}
 
-	s := http.NewServer(cfg.LocalUrl, issuer)
+	var janitorErr error
+	select {
+	case <-janitorDone:
+	case <-shutdownCtx.Done():
+		janitorErr = fmt.Errorf("the janitor sweep wasn't done in time, %w", shutdownCtx.Err())
+	}
 
-	logger.Infof("spining up API server @%s", cfg.LocalUrl)
-	return s.Run()
+	err = closeIdentities(shutdownCtx, issuer, tenants)
+	if janitorErr != nil {
+		return janitorErr
+	}
+	return err
+}
+
+// closeIdentities waits for the publishes in flight of the issuer and of every tenant, their confirmations write to
+// the DB so they're closed before it. The tenants are closed even when the issuer fails to, the first error is returned.
+func closeIdentities(ctx context.Context, issuer *identity.Identity, tenants []*identity.Identity) error {
+	err := issuer.Close(ctx)
+	for _, t := range tenants {
+		tErr := t.Close(ctx)
+		if tErr == nil {
+			continue
+		}
+		logger.Errorf("can't close the tenant identity %s, err: %v", t.Identifier(), tErr)
+		if err == nil {
+			err = tErr
+		}
+	}
+
+	return err
+}
+
+// loadTenants opens the tenant identities of the configured keys, setting up the ones that aren't saved yet
+func loadTenants(
+	db *database.DB,
+	schemaBuilder *schema.Builder,
+	cfg *cfgs.IssuerConfig,
+	stateStore identity.StateStore,
+	depths state.TreeDepths,
+) ([]*identity.Identity, error) {
+	if len(cfg.TenantSecretKeys) == 0 {
+		return nil, nil
+	}
+
+	t := identity.NewTenants(db, schemaBuilder, cfg, stateStore, depths)
+	for _, k := range cfg.TenantSecretKeys {
+		sk, err := secretKeyToBabyJub(k)
+		if err != nil {
+			return nil, err
+		}
+		iden, err := t.Load(sk)
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("loaded tenant identity %s", iden.Identifier())
+	}
+
+	return t.List(), nil
 }
 
 func secretKeyToBabyJub(sk string) (babyjub.PrivateKey, error) {
@@ -80,15 +224,3 @@ func secretKeyToBabyJub(sk string) (babyjub.PrivateKey, error) {
 
 	return privKey, nil
 }
-
-func initGlobalLogger(level string) error {
-	logLevel, err := logger.ParseLevel(level)
-	if err != nil {
-		return err
-	}
-
-	logger.SetLevel(logLevel)
-	//logger.SetFormatter(&logger.JSONFormatter{TimestampFormat: time.RFC3339Nano})
-	logger.SetOutput(os.Stdout)
-	return nil
-}
@@ -0,0 +1,126 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"io"
+	"issuer/service/models"
+	"mime"
+	"net/http"
+	"reflect"
+)
+
+const (
+	contentTypeCSV    = "text/csv"
+	contentTypeNDJSON = "application/x-ndjson"
+)
+
+// bulkColumns are the CSV columns that are fields of the request, every other column is a field of the claim data
+var bulkColumns = map[string]bool{
+	"identifier": true,
+	"expiration": true,
+	"revNonce":   true,
+	"evidence":   true,
+}
+
+// bulkRowType types the values of the request columns, the claim data values are typed by the template's schema
+var bulkRowType = reflect.TypeOf(models.CreateClaimFromTemplateRequest{})
+
+// DecodeBulkRows decodes the rows of a bulk issuance. A CSV body starts with a header row naming the columns:
+// identifier, expiration, revNonce and evidence are the fields of the request, the other columns are the claim data
+// fields, dotted names being nested objects. An NDJSON body holds one claim from template request per line.
+func DecodeBulkRows(r *http.Request) ([]*models.CreateClaimFromTemplateRequest, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedContentType, err)
+	}
+
+	switch mediaType {
+	case contentTypeCSV:
+		return decodeCSVRows(r.Body)
+	case contentTypeNDJSON:
+		return decodeNDJSONRows(r.Body)
+	default:
+		return nil, fmt.Errorf("%w '%s', supported are %s and %s",
+			ErrUnsupportedContentType, mediaType, contentTypeCSV, contentTypeNDJSON)
+	}
+}
+
+func decodeCSVRows(body io.Reader) ([]*models.CreateClaimFromTemplateRequest, error) {
+	records, err := csv.NewReader(body).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("the csv has no header row")
+	}
+
+	header := records[0]
+	rows := make([]*models.CreateClaimFromTemplateRequest, 0, len(records)-1)
+	for n, record := range records[1:] {
+		form := make(map[string][]string, len(header))
+		for col, value := range record {
+			if value == "" {
+				continue
+			}
+			name := header[col]
+			if !bulkColumns[name] {
+				name = "data." + name
+			}
+			form[name] = []string{value}
+		}
+
+		obj, err := formToObject(form, bulkRowType)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", n+1, err)
+		}
+
+		row, err := objectToBulkRow(obj)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", n+1, err)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func decodeNDJSONRows(body io.Reader) ([]*models.CreateClaimFromTemplateRequest, error) {
+	rows := make([]*models.CreateClaimFromTemplateRequest, 0)
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		row := &models.CreateClaimFromTemplateRequest{}
+		err := codec.NewDecoderBytes(line, &jsonHandle).Decode(row)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
+
+func objectToBulkRow(obj map[string]interface{}) (*models.CreateClaimFromTemplateRequest, error) {
+	if _, ok := obj["data"]; !ok {
+		obj["data"] = map[string]interface{}{}
+	}
+
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	row := &models.CreateClaimFromTemplateRequest{}
+	return row, codec.NewDecoderBytes(b, &jsonHandle).Decode(row)
+}
@@ -0,0 +1,219 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ugorji/go/codec"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentTypeJSON = "application/json"
+	contentTypeCBOR = "application/cbor"
+	contentTypeForm = "application/x-www-form-urlencoded"
+)
+
+// ErrUnsupportedContentType is returned for request bodies in a format the endpoint can't decode
+var ErrUnsupportedContentType = errors.New("unsupported content type")
+
+// ErrInvalidBody is returned for request bodies that don't decode strictly into the request, e.g. the ones holding
+// a field the request doesn't have or a value of another type
+var ErrInvalidBody = errors.New("invalid request body")
+
+// strictJsonHandle rejects the fields of the body the target doesn't have
+var strictJsonHandle = codec.JsonHandle{BasicHandle: codec.BasicHandle{
+	DecodeOptions: codec.DecodeOptions{ErrorIfNoField: true},
+}}
+
+var cborHandle = codec.CborHandle{BasicHandle: codec.BasicHandle{
+	DecodeOptions: codec.DecodeOptions{MapType: reflect.TypeOf(map[string]interface{}(nil))},
+}}
+
+// DecodeBody decodes the request body into the target according to the content type of the request. JSON is
+// decoded as is, CBOR and form encoded bodies are normalized to the canonical JSON first. Form fields with
+// dotted names (e.g. schema.url or data.birthday) are nested objects.
+func DecodeBody(r *http.Request, target interface{}) error {
+	return decodeBody(r, target, &jsonHandle)
+}
+
+// DecodeStrictBody decodes the request body like DecodeBody does, rejecting the fields the target doesn't have
+func DecodeStrictBody(r *http.Request, target interface{}) error {
+	return strictError(decodeBody(r, target, &strictJsonHandle))
+}
+
+// StrictJsonToStruct decodes the JSON request body, rejecting the fields the target doesn't have
+func StrictJsonToStruct(r *http.Request, target interface{}) error {
+	return strictError(codec.NewDecoder(r.Body, &strictJsonHandle).Decode(target))
+}
+
+// strictError wraps the errors of a body that doesn't decode into the target with ErrInvalidBody. The errors of a
+// body in an unsupported format are kept as they are, and a body too large gives the error of its limit.
+func strictError(err error) error {
+	if err == nil || errors.Is(err, ErrUnsupportedContentType) {
+		return err
+	}
+	if tooLarge := maxBytesError(err); tooLarge != nil {
+		return tooLarge
+	}
+	return fmt.Errorf("%w: %v", ErrInvalidBody, err)
+}
+
+// maxBytesError returns the error of a body read past its limit, the decoder keeps it as the cause of its error
+func maxBytesError(err error) *http.MaxBytesError {
+	for err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return tooLarge
+		}
+		c, ok := err.(interface{ Cause() error })
+		if !ok {
+			return nil
+		}
+		err = c.Cause()
+	}
+	return nil
+}
+
+// requestMediaType returns the media type of the request body, JSON when the request doesn't tell
+func requestMediaType(r *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return contentTypeJSON
+	}
+	return mediaType
+}
+
+func decodeBody(r *http.Request, target interface{}, h *codec.JsonHandle) error {
+	mediaType := contentTypeJSON
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(ct)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrUnsupportedContentType, err)
+		}
+	}
+
+	var normalized interface{}
+	switch mediaType {
+	case contentTypeJSON:
+		return codec.NewDecoder(r.Body, h).Decode(target)
+	case contentTypeCBOR:
+		err := codec.NewDecoder(r.Body, &cborHandle).Decode(&normalized)
+		if err != nil {
+			return err
+		}
+	case contentTypeForm:
+		err := r.ParseForm()
+		if err != nil {
+			return err
+		}
+		normalized, err = formToObject(r.PostForm, reflect.TypeOf(target))
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w '%s', supported are %s, %s and %s",
+			ErrUnsupportedContentType, mediaType, contentTypeJSON, contentTypeCBOR, contentTypeForm)
+	}
+
+	b, err := json.Marshal(normalized)
+	if err != nil {
+		return err
+	}
+
+	return codec.NewDecoder(bytes.NewReader(b), h).Decode(target)
+}
+
+// formToObject nests the dotted form fields into objects and types their values by the fields of the target they
+// decode into: the values of the integer and boolean fields are parsed, the other ones are kept as strings, so
+// "01234" keeps its leading zero. The values under a free-form field, e.g. the credential data, stay strings too,
+// they are typed by the schema afterwards.
+func formToObject(form map[string][]string, target reflect.Type) (map[string]interface{}, error) {
+	res := make(map[string]interface{})
+	for name, values := range form {
+		if len(values) == 0 {
+			continue
+		}
+
+		obj := res
+		t := target
+		keys := strings.Split(name, ".")
+		for _, k := range keys[:len(keys)-1] {
+			nested, ok := obj[k].(map[string]interface{})
+			if !ok {
+				if _, exists := obj[k]; exists {
+					return nil, fmt.Errorf("form field '%s' is both a value and an object", k)
+				}
+				nested = make(map[string]interface{})
+				obj[k] = nested
+			}
+			obj = nested
+			t = formFieldType(t, k)
+		}
+
+		last := keys[len(keys)-1]
+		if _, exists := obj[last]; exists {
+			return nil, fmt.Errorf("form field '%s' is both a value and an object", name)
+		}
+		v, err := formValue(values[0], formFieldType(t, last))
+		if err != nil {
+			return nil, fmt.Errorf("form field '%s': %w", name, err)
+		}
+		obj[last] = v
+	}
+
+	return res, nil
+}
+
+// formFieldType returns the type of the field of the struct with the codec name, nil when the type isn't a struct
+// or has no such field
+func formFieldType(t reflect.Type, name string) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("codec"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if tag == name {
+			return f.Type
+		}
+	}
+	return nil
+}
+
+// formValue types a form value after the field it decodes into, the values of the other fields are strings
+func formValue(v string, t reflect.Type) (interface{}, error) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return v, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(v, 10, t.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(v, 10, t.Bits())
+	case reflect.Bool:
+		return strconv.ParseBool(v)
+	default:
+		return v, nil
+	}
+}
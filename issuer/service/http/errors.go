@@ -0,0 +1,73 @@
+package http
+
+import (
+	"errors"
+	"issuer/db"
+	"issuer/service/identity"
+	"issuer/service/identity/state"
+	"issuer/service/schema"
+	"net/http"
+)
+
+// errorStatusCode maps a known issuer error to the status code returned to the client,
+// any other error is answered with the fallback status code
+func errorStatusCode(err error, fallback int) int {
+	switch {
+	case errors.Is(err, schema.ErrSchemaLoadBusy):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, state.ErrTreeFull):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, identity.ErrEvidenceNotFound), errors.Is(err, identity.ErrEvidenceRevoked):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, identity.ErrTemplateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, schema.ErrSchemaNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, schema.ErrSchemaValidation), errors.Is(err, schema.ErrUnsupportedScheme):
+		return http.StatusBadRequest
+	case errors.Is(err, schema.ErrSchemaLoad):
+		return http.StatusBadGateway
+	case errors.Is(err, identity.ErrPublishInProgress):
+		return http.StatusConflict
+	case errors.Is(err, identity.ErrPublishJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, identity.ErrPublishingDisabled):
+		return http.StatusNotImplemented
+	case errors.Is(err, ErrUnsupportedContentType):
+		return http.StatusUnsupportedMediaType
+	case errors.As(err, new(*http.MaxBytesError)):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrInvalidBody), errors.Is(err, identity.ErrInvalidClaimRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, identity.ErrActiveCredentialExists):
+		return http.StatusConflict
+	case errors.As(err, new(*identity.TemporalError)):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, identity.ErrSelfVerification), errors.Is(err, identity.ErrStoredClaimInvalid):
+		return http.StatusInternalServerError
+	case errors.Is(err, identity.ErrBulkRejected):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, identity.ErrClaimPublished):
+		return http.StatusConflict
+	case errors.Is(err, identity.ErrInvalidSubjectPosition), errors.Is(err, identity.ErrInvalidSubject):
+		return http.StatusBadRequest
+	case errors.Is(err, identity.ErrSubjectNetwork):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, schema.ErrUnsupportedSchemaFormat), errors.Is(err, schema.ErrSchemaHashMismatch):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, identity.ErrUnsupportedProofType), errors.Is(err, identity.ErrUnsupportedCredentialStatus):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, identity.ErrBackupPassphrase):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, state.ErrUnknownRevocationRoot), errors.Is(err, state.ErrUnknownState):
+		return http.StatusNotFound
+	case errors.Is(err, identity.ErrClaimNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, identity.ErrClaimAlreadyRevoked):
+		return http.StatusConflict
+	case errors.Is(err, db.ErrRevNonceInUse), errors.Is(err, db.ErrClaimExists):
+		return http.StatusConflict
+	default:
+		return fallback
+	}
+}
@@ -0,0 +1,91 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"github.com/go-chi/chi/middleware"
+	logger "github.com/sirupsen/logrus"
+	"issuer/service/logging"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// withRequestLogger puts a logger holding the ID of the request in its context, the layers serving the request log
+// with it
+func withRequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := logger.WithField(logging.RequestIDField, middleware.GetReqID(r.Context()))
+		next.ServeHTTP(w, r.WithContext(logging.NewContext(r.Context(), l)))
+	})
+}
+
+// withTimeout bounds the context of the request by the given timeout, a timeout of 0 leaves the context unbounded
+func withTimeout(timeout time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// withBodyLimit fails the reads of the request body past the given size, a size of 0 doesn't bound the body
+func withBodyLimit(size int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if size <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, size)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// withAdminAuth lets through only the requests carrying the admin API key as a bearer token
+func withAdminAuth(key string) func(next http.Handler) http.Handler {
+	return withBearerAuth([]string{key}, "admin API key")
+}
+
+// withAPIKeyAuth lets through only the requests carrying one of the API keys as a bearer token, no keys lets
+// every request through
+func withAPIKeyAuth(keys []string) func(next http.Handler) http.Handler {
+	if len(keys) == 0 {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+	return withBearerAuth(keys, "API key")
+}
+
+func withBearerAuth(keys []string, name string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !matchesKey(token, keys) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				EncodeResponse(w, http.StatusUnauthorized, "missing or invalid "+name)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// matchesKey compares the token with every key in constant time, whichever key matches
+func matchesKey(token string, keys []string) bool {
+	match := 0
+	for _, k := range keys {
+		match |= subtle.ConstantTimeCompare([]byte(token), []byte(k))
+	}
+	return match == 1
+}
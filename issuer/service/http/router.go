@@ -6,6 +6,9 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/go-chi/render"
 	logger "github.com/sirupsen/logrus"
+	"issuer/service/identity"
+	"issuer/service/metrics"
+	"issuer/service/schema"
 )
 
 func newRouter(s *Server) chi.Router {
@@ -14,6 +17,7 @@ func newRouter(s *Server) chi.Router {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(withRequestLogger)
 
 	corsMiddleware := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://*", "https://*", "*"},
@@ -24,45 +28,138 @@ func newRouter(s *Server) chi.Router {
 
 	r.Use(corsMiddleware.Handler)
 
+	read := withTimeout(s.timeouts.Read)
+	write := withTimeout(s.timeouts.Write)
+
+	r.With(read).Get("/.well-known/jwks.json", s.getJWKS)
+	r.Get("/health", s.getHealth)
+	r.With(read).Get("/ready", s.getReadiness)
+	r.With(read).Handle("/metrics", metrics.Handler())
+	r.With(read).Get(schema.LocalSchemasPath+"{name}", s.getLocalSchema)
+
 	r.Route("/api/v1", func(root chi.Router) {
 		root.Use(render.SetContentType(render.ContentTypeJSON))
 
-		root.Route("/identity", func(r chi.Router) {
-			r.Get("/", s.getIdentity)
-			r.Post("/publish", s.publish)
+		s.issuerRoutes(root)
+
+		root.Route("/schemas", func(r chi.Router) {
+			r.Use(read)
+			r.Get("/", s.getSchemas)
 		})
 
 		root.Route("/requests", func(reqs chi.Router) {
+			reqs.Use(read)
 			reqs.Get("/auth", s.getAuthVerificationRequest)
 			reqs.Get("/age-kyc", s.getAgeVerificationRequest)
 		})
 
-		root.Route("/claims", func(claims chi.Router) {
-			claims.Get("/{id}", s.getClaim)
-			claims.Post("/", s.createClaim)
+		root.Route("/events", func(events chi.Router) {
+			events.Use(read)
+			events.Get("/", s.getEvents)
+		})
 
-			claims.Route("/offers", func(claimRequests chi.Router) {
-				claimRequests.Get("/{user-id}/{claim-id}", s.getAgeClaimOffer)
-			})
+		root.Route("/audit", func(audit chi.Router) {
+			audit.Use(read)
+			audit.Get("/", s.getAuditLog)
+		})
 
-			claims.Route("/revocations", func(revs chi.Router) {
-				revs.Get("/{nonce}", s.getRevocationStatus)
+		if s.adminKey != "" {
+			root.Route("/admin", func(admin chi.Router) {
+				admin.Use(read, withAdminAuth(s.adminKey))
+				admin.Get("/debug/claim/{id}", s.debugClaim)
+				admin.Get("/claims", s.listClaims)
+				admin.Get("/backup", s.exportBackup)
+				admin.Get("/subjects/{subject}/claims", s.getClaimsBySubject)
+				admin.Delete("/claims/{id}", s.discardClaim)
+				if s.allowReset {
+					admin.Post("/reset", s.resetIdentity)
+				}
 			})
-
-		})
+		}
 
 		root.Route("/agent", func(agent chi.Router) {
+			agent.Use(write)
 			agent.Post("/", s.agent)
 		})
 
 		root.Route("/callback", func(agent chi.Router) {
+			agent.Use(write)
 			agent.Post("/", s.callback)
 		})
 		root.Route("/status", func(agent chi.Router) {
+			agent.Use(read)
 			agent.Get("/", s.getRequestStatus)
 		})
 
 	})
 
+	for _, t := range s.tenants {
+		ts := s.withIssuer(t)
+		r.Route(identity.TenantPath(t.Identifier())+"/api/v1", func(root chi.Router) {
+			root.Use(render.SetContentType(render.ContentTypeJSON))
+			ts.issuerRoutes(root)
+		})
+	}
+
 	return r
 }
+
+// issuerRoutes serves the identity, the state and the claims endpoints of the issuer of the server
+func (s *Server) issuerRoutes(root chi.Router) {
+	read := withTimeout(s.timeouts.Read)
+	write := withTimeout(s.timeouts.Write)
+	publish := withTimeout(s.timeouts.Publish)
+	// auth guards the endpoints issuing, offering and revoking claims and publishing the state
+	auth := withAPIKeyAuth(s.apiKeys)
+	// limit bounds the bodies of the claim requests, bulkLimit the ones of the bulk uploads
+	limit := withBodyLimit(s.maxBodySize)
+	bulkLimit := withBodyLimit(s.maxBulkBodySize)
+
+	root.Route("/identity", func(r chi.Router) {
+		r.With(read).Get("/", s.getIdentity)
+		r.With(read).Get("/genesis", s.getGenesis)
+		r.With(read).Get("/auth-proof", s.getAuthProof)
+		r.With(publish, auth).Post("/publish", s.publish)
+		r.With(read).Get("/publish/{jobID}", s.getPublishStatus)
+		r.With(publish, auth).Post("/publish/dry-run", s.publishDryRun)
+	})
+
+	root.Route("/state", func(r chi.Router) {
+		r.Use(read)
+		r.Get("/verify-onchain", s.verifyOnChainState)
+		r.Get("/snapshot", s.exportTreeSnapshot)
+		r.Get("/transitions", s.getStateTransitions)
+	})
+
+	root.Route("/claims", func(claims chi.Router) {
+		claims.With(read).Get("/{id}", s.getClaim)
+		claims.With(read).Get("/{id}/proof", s.getProofBundle)
+		claims.With(read).Get("/{id}/w3c", s.getW3CCredential)
+		claims.With(read, auth).Get("/{id}/offer", s.getCredentialOffer)
+		claims.With(read).Get("/{id}/status", s.getClaimStatus)
+		claims.With(read).Get("/{id}/verify", s.verifyCredential)
+		claims.With(write, auth, limit).Post("/", s.createClaim)
+		claims.With(write, auth, limit).Post("/dry-run", s.validateClaim)
+		claims.With(write, auth, limit).Post("/template/{name}", s.createClaimFromTemplate)
+		claims.With(write, auth, bulkLimit).Post("/bulk", s.createClaimsBulk)
+		claims.With(write, auth, limit).Post("/batch", s.createClaimsBatch)
+
+		claims.Route("/offers", func(claimRequests chi.Router) {
+			claimRequests.Use(read)
+			claimRequests.Get("/{user-id}/{claim-id}", s.getAgeClaimOffer)
+		})
+
+		claims.Route("/revocations", func(revs chi.Router) {
+			revs.With(read).Get("/", s.exportRevocations)
+			revs.With(read).Get("/{nonce}", s.getRevocationStatus)
+			revs.With(read).Post("/batch", s.getRevocationStatuses)
+			revs.With(write, auth).Post("/{nonce}/revoke", s.revokeClaim)
+		})
+
+		claims.Route("/revocation", func(rev chi.Router) {
+			rev.Use(read)
+			rev.Post("/verify", s.verifyRevocationStatus)
+		})
+
+	})
+}
@@ -1,31 +1,98 @@
 package http
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/iden3comm/protocol"
 	logger "github.com/sirupsen/logrus"
 	"io"
+	"issuer/service/cfgs"
 	"issuer/service/identity"
+	"issuer/service/logging"
 	"issuer/service/models"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type Server struct {
 	httpServer *http.Server
 	address    string
 	issuer     *identity.Identity
+	// tenants are the tenant identities, each one served under its identity.TenantPath
+	tenants  []*identity.Identity
+	timeouts Timeouts
+	// adminKey is the API key of the admin endpoints, they aren't served when it's empty
+	adminKey string
+	// apiKeys are the API keys of the endpoints changing the state, they're open when it's empty
+	apiKeys []string
+	// maxBodySize bounds the bodies of the claim requests, 0 doesn't
+	maxBodySize int64
+	// maxBulkBodySize bounds the bodies of the bulk uploads, 0 doesn't
+	maxBulkBodySize int64
+	// allowReset serves the admin endpoint wiping the identity
+	allowReset bool
+	conn       Connections
 }
 
-func NewServer(localHostAdd string, issuer *identity.Identity) *Server {
+// Connections configures the connections of the server
+type Connections struct {
+	// TLSCertFile and TLSKeyFile enable TLS when both are set
+	TLSCertFile string
+	TLSKeyFile  string
+	// HTTP2 lets TLS clients negotiate HTTP/2, the others are served over HTTP/1.1
+	HTTP2       bool
+	KeepAlive   bool
+	IdleTimeout time.Duration
+}
+
+// Timeouts bound the time a request of each class of endpoints may take
+type Timeouts struct {
+	Read    time.Duration
+	Write   time.Duration
+	Publish time.Duration
+}
+
+func NewServer(cfg *cfgs.IssuerConfig, issuer *identity.Identity, tenants []*identity.Identity) *Server {
 
 	return &Server{
-		address: localHostAdd,
+		address: cfg.LocalUrl,
 		issuer:  issuer,
+		tenants: tenants,
+		timeouts: Timeouts{
+			Read:    cfg.ReadTimeout,
+			Write:   cfg.WriteTimeout,
+			Publish: cfg.PublishTimeout,
+		},
+		adminKey:        cfg.AdminApiKey,
+		apiKeys:         cfg.APIKeys,
+		maxBodySize:     cfg.MaxRequestBodySize,
+		maxBulkBodySize: cfg.MaxBulkBodySize,
+		allowReset:      cfg.AllowReset,
+		conn: Connections{
+			TLSCertFile: cfg.TLSCertFile,
+			TLSKeyFile:  cfg.TLSKeyFile,
+			HTTP2:       cfg.HTTP2,
+			KeepAlive:   cfg.KeepAlive,
+			IdleTimeout: cfg.IdleTimeout,
+		},
 	}
 }
 
+// withIssuer is a copy of the server serving the endpoints of the tenant identity
+func (s *Server) withIssuer(tenant *identity.Identity) *Server {
+	ts := *s
+	ts.issuer = tenant
+	ts.tenants = nil
+	return &ts
+}
+
 func (s *Server) Close(ctx context.Context) error {
 	logger.Debug("Server.Close() invoked")
 
@@ -39,16 +106,32 @@ func (s *Server) Close(ctx context.Context) error {
 func (s *Server) Run() error {
 	logger.Debug("Server.Run() invoked")
 
-	logger.Infof("starting HTTP server (address: %s)", s.address)
+	s.httpServer = &http.Server{Addr: s.address, Handler: newRouter(s), IdleTimeout: s.conn.IdleTimeout}
+	s.httpServer.SetKeepAlivesEnabled(s.conn.KeepAlive)
 
-	s.httpServer = &http.Server{Addr: s.address, Handler: newRouter(s)}
-	return s.httpServer.ListenAndServe()
+	if s.conn.TLSCertFile == "" {
+		logger.Infof("starting HTTP server (address: %s)", s.address)
+		return s.httpServer.ListenAndServe()
+	}
+
+	if !s.conn.HTTP2 {
+		// a non nil empty map turns off the HTTP/2 support of the server
+		s.httpServer.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	logger.Infof("starting HTTPS server (address: %s, http2: %t)", s.address, s.conn.HTTP2)
+	return s.httpServer.ListenAndServeTLS(s.conn.TLSCertFile, s.conn.TLSKeyFile)
 }
 
 func (s *Server) getIdentity(w http.ResponseWriter, r *http.Request) {
 	logger.Debug("Server.getIdentity() invoked")
 
-	iden, err := s.issuer.GetIdentity()
+	format, err := identity.ParseHashFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		EncodeResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	iden, err := s.issuer.GetIdentity(format)
 	if err != nil {
 		logger.Errorf("Server -> issuer.GetIdentity() return err, err: %v", err)
 		EncodeResponse(w, 500, err)
@@ -57,20 +140,257 @@ func (s *Server) getIdentity(w http.ResponseWriter, r *http.Request) {
 	EncodeResponse(w, 200, iden)
 }
 
+func (s *Server) getJWKS(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getJWKS() invoked")
+
+	EncodeResponse(w, http.StatusOK, s.issuer.GetJWKS())
+}
+
+func (s *Server) getGenesis(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getGenesis() invoked")
+
+	res, err := s.issuer.GetGenesis()
+	if err != nil {
+		logger.Errorf("Server -> issuer.GetGenesis() return err, err: %v", err)
+		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't get genesis state. err: %v", err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) verifyOnChainState(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.verifyOnChainState() invoked")
+
+	res, err := s.issuer.VerifyOnChainState(r.Context())
+	if err != nil {
+		logger.Errorf("Server -> issuer.VerifyOnChainState() return err, err: %v", err)
+		EncodeResponse(w, http.StatusBadGateway, fmt.Sprintf("can't compare with the on-chain state. err: %v", err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) exportTreeSnapshot(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.exportTreeSnapshot() invoked")
+
+	var buf bytes.Buffer
+	err := s.issuer.ExportTreeSnapshot(&buf)
+	if err != nil {
+		logger.Errorf("Server -> issuer.ExportTreeSnapshot() return err, err: %v", err)
+		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't export the state snapshot. err: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="state-snapshot.json"`)
+	EncodeByteResponse(w, http.StatusOK, buf.Bytes())
+}
+
+func (s *Server) getStateTransitions(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getStateTransitions() invoked")
+
+	res, err := s.issuer.GetStateTransitionHistory()
+	if err != nil {
+		logger.Errorf("Server -> issuer.GetStateTransitionHistory() return err, err: %v", err)
+		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't get the state transitions. err: %v", err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) debugClaim(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.debugClaim() invoked")
+
+	id := chi.URLParam(r, "id")
+
+	res, err := s.issuer.DebugClaim(id)
+	if err != nil {
+		logger.Errorf("Server -> issuer.DebugClaim() return err, err: %v", err)
+		EncodeResponse(w, http.StatusBadRequest, fmt.Sprintf("can't debug claim %s. err: %v", id, err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) discardClaim(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.discardClaim() invoked")
+
+	id := chi.URLParam(r, "id")
+
+	err := s.issuer.DiscardUnpublishedClaim(id)
+	if err != nil {
+		logger.Errorf("Server -> issuer.DiscardUnpublishedClaim() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), fmt.Sprintf("can't discard claim %s. err: %v", id, err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getLocalSchema(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getLocalSchema() invoked")
+
+	name := chi.URLParam(r, "name")
+
+	res, err := s.issuer.GetLocalSchema(name)
+	if err != nil {
+		logger.Errorf("Server -> issuer.GetLocalSchema() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusInternalServerError), fmt.Sprintf("can't get schema %s. err: %v", name, err))
+		return
+	}
+
+	EncodeByteResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) getSchemas(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getSchemas() invoked")
+
+	describe := r.URL.Query().Get("describe") == "true"
+
+	res, err := s.issuer.GetSchemas(r.Context(), describe)
+	if err != nil {
+		logger.Errorf("Server -> issuer.GetSchemas() return err, err: %v", err)
+		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't get supported schemas. err: %v", err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
 func (s *Server) createClaim(w http.ResponseWriter, r *http.Request) {
-	logger.Debug("Server.createClaim() invoked")
+	log := logging.FromContext(r.Context())
+	log.Debug("Server.createClaim() invoked")
 
 	req := &models.CreateClaimRequest{}
-	if err := JsonToStruct(r, req); err != nil {
-		logger.Error("cannot unmarshal json body, err: %v", err)
-		EncodeResponse(w, http.StatusBadRequest, err)
+	if err := DecodeStrictBody(r, req); err != nil {
+		log.Errorf("cannot decode body, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), err)
 		return
 	}
+	if requestMediaType(r) == contentTypeForm {
+		if err := s.issuer.CoerceFormData(r.Context(), req); err != nil {
+			log.Errorf("Server -> issuer.CoerceFormData() return err, err: %v", err)
+			EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), fmt.Sprintf("can't type the form data. err: %v", err))
+			return
+		}
+	}
 
-	res, err := s.issuer.CreateClaim(req)
+	res, err := s.issuer.CreateClaim(r.Context(), req)
 	if err != nil {
-		logger.Errorf("Server -> issuer.CreateClaim() return err, err: %v", err)
-		EncodeResponse(w, http.StatusBadRequest, fmt.Errorf("can't parse claim id param - %v", err))
+		log.Errorf("Server -> issuer.CreateClaim() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), fmt.Errorf("can't parse claim id param - %v", err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) validateClaim(w http.ResponseWriter, r *http.Request) {
+	log := logging.FromContext(r.Context())
+	log.Debug("Server.validateClaim() invoked")
+
+	req := &models.CreateClaimRequest{}
+	if err := DecodeStrictBody(r, req); err != nil {
+		log.Errorf("cannot decode body, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), err)
+		return
+	}
+	if requestMediaType(r) == contentTypeForm {
+		if err := s.issuer.CoerceFormData(r.Context(), req); err != nil {
+			log.Errorf("Server -> issuer.CoerceFormData() return err, err: %v", err)
+			EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), fmt.Sprintf("can't type the form data. err: %v", err))
+			return
+		}
+	}
+
+	err := s.issuer.ValidateClaim(r.Context(), req)
+	if err != nil {
+		log.Errorf("Server -> issuer.ValidateClaim() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), fmt.Sprintf("claim wouldn't be issued. err: %v", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) createClaimsBatch(w http.ResponseWriter, r *http.Request) {
+	log := logging.FromContext(r.Context())
+	log.Debug("Server.createClaimsBatch() invoked")
+
+	var reqs []*models.CreateClaimRequest
+	if err := DecodeStrictBody(r, &reqs); err != nil {
+		log.Errorf("cannot decode body, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), err)
+		return
+	}
+
+	res, err := s.issuer.CreateClaims(r.Context(), reqs)
+	if err != nil {
+		log.Errorf("Server -> issuer.CreateClaims() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), fmt.Sprintf("no claim of the batch was issued. err: %v", err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) createClaimFromTemplate(w http.ResponseWriter, r *http.Request) {
+	log := logging.FromContext(r.Context())
+	log.Debug("Server.createClaimFromTemplate() invoked")
+
+	name := chi.URLParam(r, "name")
+
+	req := &models.CreateClaimFromTemplateRequest{}
+	if err := StrictJsonToStruct(r, req); err != nil {
+		log.Errorf("cannot unmarshal json body, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), err)
+		return
+	}
+
+	res, err := s.issuer.CreateClaimFromTemplate(r.Context(), name, req)
+	if err != nil {
+		log.Errorf("Server -> issuer.CreateClaimFromTemplate() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), fmt.Errorf("can't create claim from template %s - %v", name, err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) createClaimsBulk(w http.ResponseWriter, r *http.Request) {
+	log := logging.FromContext(r.Context())
+	log.Debug("Server.createClaimsBulk() invoked")
+
+	name := r.URL.Query().Get("template")
+	if name == "" {
+		EncodeResponse(w, http.StatusBadRequest, "the template query parameter is required")
+		return
+	}
+
+	rows, err := DecodeBulkRows(r)
+	if err != nil {
+		EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), fmt.Sprintf("can't decode the rows. err: %v", err))
+		return
+	}
+	if requestMediaType(r) == contentTypeCSV {
+		if err := s.issuer.CoerceTemplateFormData(r.Context(), name, rows); err != nil {
+			log.Errorf("Server -> issuer.CoerceTemplateFormData() return err, err: %v", err)
+			EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), fmt.Sprintf("can't type the rows. err: %v", err))
+			return
+		}
+	}
+
+	res, err := s.issuer.CreateClaimsFromTemplate(r.Context(), name, rows)
+	if err != nil {
+		log.Errorf("Server -> issuer.CreateClaimsFromTemplate() return err, err: %v", err)
+		if res == nil {
+			EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), fmt.Sprintf("can't issue the claims. err: %v", err))
+			return
+		}
+		EncodeResponse(w, errorStatusCode(err, http.StatusInternalServerError), res)
 		return
 	}
 
@@ -88,16 +408,109 @@ func (s *Server) getClaim(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := s.issuer.GetClaim(claimID)
+	// verification re-checks the stored signature proof and the tree entry, which is slower
+	verify := r.URL.Query().Get("verify") == "true"
+
+	res, err := s.issuer.GetClaim(claimID, verify)
 	if err != nil {
-		logger.Errorf("Server -> issuer.CreateClaim() return err, err: %v", err)
-		EncodeResponse(w, http.StatusNotFound, fmt.Errorf("can't get claim %s, err: %v", claimID, err))
+		logger.Errorf("Server -> issuer.GetClaim() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusInternalServerError), fmt.Errorf("can't get claim %s, err: %v", claimID, err))
 		return
 	}
 
 	EncodeResponse(w, 200, res)
 }
 
+func (s *Server) getProofBundle(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getProofBundle() invoked")
+
+	claimID := chi.URLParam(r, "id")
+
+	atState, err := parseStateQuery(r)
+	if err != nil {
+		EncodeResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, err := s.issuer.GetProofBundle(claimID, atState)
+	if err != nil {
+		logger.Errorf("Server -> issuer.GetProofBundle() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusNotFound), fmt.Errorf("can't get proof bundle of claim %s, err: %v", claimID, err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) getW3CCredential(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getW3CCredential() invoked")
+
+	claimID := chi.URLParam(r, "id")
+
+	res, err := s.issuer.GetW3CCredential(claimID)
+	if err != nil {
+		logger.Errorf("Server -> issuer.GetW3CCredential() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusInternalServerError), fmt.Sprintf("can't get the credential %s. err: %v", claimID, err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) getCredentialOffer(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getCredentialOffer() invoked")
+
+	claimID := chi.URLParam(r, "id")
+
+	offer, err := s.issuer.CreateCredentialOffer(claimID)
+	if err != nil {
+		logger.Errorf("Server -> issuer.CreateCredentialOffer() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusInternalServerError), fmt.Sprintf("can't offer the credential %s. err: %v", claimID, err))
+		return
+	}
+	qr, err := offer.QRPayload()
+	if err != nil {
+		logger.Errorf("Server -> offer.QRPayload() return err, err: %v", err)
+		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't encode the offer of the credential %s. err: %v", claimID, err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, &models.GetCredentialOfferResponse{
+		Offer:     (*protocol.CredentialsOfferMessage)(offer),
+		QRPayload: qr,
+	})
+}
+
+func (s *Server) getClaimStatus(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getClaimStatus() invoked")
+
+	claimID := chi.URLParam(r, "id")
+
+	res, err := s.issuer.GetClaimStatus(r.Context(), claimID)
+	if err != nil {
+		logger.Errorf("Server -> issuer.GetClaimStatus() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusInternalServerError), fmt.Errorf("can't get status of claim %s, err: %v", claimID, err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) verifyCredential(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.verifyCredential() invoked")
+
+	claimID := chi.URLParam(r, "id")
+
+	res, err := s.issuer.VerifyCredential(claimID)
+	if err != nil {
+		logger.Errorf("Server -> issuer.VerifyCredential() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusInternalServerError), fmt.Errorf("can't verify claim %s, err: %v", claimID, err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
 func (s *Server) getRevocationStatus(w http.ResponseWriter, r *http.Request) {
 	logger.Debug("Server.getRevocationStatus() invoked")
 
@@ -108,12 +521,283 @@ func (s *Server) getRevocationStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := s.issuer.GetRevocationStatus(nonce)
+	format, err := identity.ParseHashFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		EncodeResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	atState, err := parseStateQuery(r)
+	if err != nil {
+		EncodeResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, err := s.issuer.GetRevocationStatus(nonce, format, atState)
 	if err != nil {
 		logger.Errorf("Server -> issuer.GetRevocationStatus() return err, err: %v", err)
-		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't generate non revocation proof for revocation nonce: %d. err: %v", nonce, err))
+		EncodeResponse(w, errorStatusCode(err, http.StatusInternalServerError), fmt.Sprintf("can't generate non revocation proof for revocation nonce: %d. err: %v", nonce, err))
+		return
+	}
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+// parseStateQuery parses the optional state query parameter, the hex of a past state of the identity the proofs
+// are generated at. It's nil when the parameter isn't given.
+func parseStateQuery(r *http.Request) (*merkletree.Hash, error) {
+	st := r.URL.Query().Get("state")
+	if st == "" {
+		return nil, nil
+	}
+
+	h, err := merkletree.NewHashFromHex(st)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state '%s', err: %v", st, err)
+	}
+	return h, nil
+}
+
+func (s *Server) exportRevocations(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.exportRevocations() invoked")
+
+	since := r.URL.Query().Get("since")
+	entries, root, err := s.issuer.ExportRevocations(since)
+	if err != nil {
+		logger.Errorf("Server -> issuer.ExportRevocations() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusInternalServerError), fmt.Sprintf("can't export the revocations since '%s'. err: %v", since, err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, &models.ExportRevocationsResponse{RevocationTreeRoot: root, Revocations: entries})
+}
+
+func (s *Server) revokeClaim(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.revokeClaim() invoked")
+
+	nonce, err := strconv.ParseUint(chi.URLParam(r, "nonce"), 10, 64)
+	if err != nil {
+		EncodeResponse(w, http.StatusBadRequest, fmt.Sprintf("can't parse nonce param - %v", err))
+		return
+	}
+
+	err = s.issuer.RevokeClaim(nonce)
+	if err != nil {
+		logger.Errorf("Server -> issuer.RevokeClaim() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusInternalServerError), fmt.Sprintf("can't revoke nonce %d. err: %v", nonce, err))
 		return
 	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getRevocationStatuses(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getRevocationStatuses() invoked")
+
+	format, err := identity.ParseHashFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		EncodeResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req := &models.BatchRevocationStatusRequest{}
+	if err := JsonToStruct(r, req); err != nil {
+		logger.Errorf("cannot unmarshal json body, err: %v", err)
+		EncodeResponse(w, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := s.issuer.GetRevocationStatuses(req.Nonces, format)
+	if err != nil {
+		logger.Errorf("Server -> issuer.GetRevocationStatuses() return err, err: %v", err)
+		EncodeResponse(w, http.StatusBadRequest, fmt.Sprintf("can't generate non revocation proofs. err: %v", err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) verifyRevocationStatus(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.verifyRevocationStatus() invoked")
+
+	req := &models.VerifyRevocationStatusRequest{}
+	if err := JsonToStruct(r, req); err != nil {
+		logger.Errorf("cannot unmarshal json body, err: %v", err)
+		EncodeResponse(w, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := s.issuer.VerifyRevocationStatus(req)
+	if err != nil {
+		logger.Errorf("Server -> issuer.VerifyRevocationStatus() return err, err: %v", err)
+		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't verify revocation status. err: %v", err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) getEvents(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getEvents() invoked")
+
+	var since uint64
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		since, err = strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			logger.Errorf("error on parsing since offset, err: %v", err)
+			EncodeResponse(w, http.StatusBadRequest, fmt.Errorf("error on parsing since input"))
+			return
+		}
+	}
+
+	var limit int
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil {
+			logger.Errorf("error on parsing limit, err: %v", err)
+			EncodeResponse(w, http.StatusBadRequest, fmt.Errorf("error on parsing limit input"))
+			return
+		}
+	}
+
+	res, err := s.issuer.GetEvents(since, limit)
+	if err != nil {
+		logger.Errorf("Server -> issuer.GetEvents() return err, err: %v", err)
+		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't get events. err: %v", err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) listClaims(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.listClaims() invoked")
+
+	var after *uuid.UUID
+	if v := r.URL.Query().Get("after"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			logger.Errorf("error on parsing after, err: %v", err)
+			EncodeResponse(w, http.StatusBadRequest, fmt.Errorf("error on parsing after input"))
+			return
+		}
+		after = &id
+	}
+
+	var limit int
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil {
+			logger.Errorf("error on parsing limit, err: %v", err)
+			EncodeResponse(w, http.StatusBadRequest, fmt.Errorf("error on parsing limit input"))
+			return
+		}
+	}
+	withAuthClaim := r.URL.Query().Get("auth_claim") == "true"
+
+	claims, next, total, err := s.issuer.ListClaims(after, limit, withAuthClaim)
+	if err != nil {
+		logger.Errorf("Server -> issuer.ListClaims() return err, err: %v", err)
+		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't list claims. err: %v", err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, &models.ListClaimsResponse{Claims: claims, Total: total, Next: next})
+}
+
+func (s *Server) getClaimsBySubject(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getClaimsBySubject() invoked")
+
+	subject := chi.URLParam(r, "subject")
+	if subject == "" {
+		EncodeResponse(w, http.StatusBadRequest, fmt.Errorf("subject param is empty"))
+		return
+	}
+
+	res, err := s.issuer.GetClaimsBySubject(subject)
+	if err != nil {
+		logger.Errorf("Server -> issuer.GetClaimsBySubject() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusBadRequest), fmt.Sprintf("can't get claims of subject %s. err: %v", subject, err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) getReadiness(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getReadiness() invoked")
+
+	res := s.issuer.Readiness(r.Context())
+	if res.Status != models.HealthStatusOK {
+		logger.Errorf("Server -> issuer.Readiness() issuer isn't ready, checks: %+v", res.Checks)
+		EncodeResponse(w, http.StatusServiceUnavailable, res)
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+// getHealth is the liveness probe, it only tells the process serves requests
+func (s *Server) getHealth(w http.ResponseWriter, r *http.Request) {
+	EncodeResponse(w, http.StatusOK, &models.HealthResponse{Status: models.HealthStatusOK})
+}
+
+func (s *Server) getAuthProof(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getAuthProof() invoked")
+
+	res, err := s.issuer.GetAuthProof()
+	if err != nil {
+		logger.Errorf("Server -> issuer.GetAuthProof() return err, err: %v", err)
+		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't get auth proof. err: %v", err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) exportBackup(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.exportBackup() invoked")
+
+	backup, err := s.issuer.Export()
+	if err != nil {
+		logger.Errorf("Server -> issuer.Export() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusInternalServerError), fmt.Sprintf("can't export the identity. err: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="identity.bak"`)
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(backup); err != nil {
+		logger.Errorf("can't write the identity backup, err: %v", err)
+	}
+}
+
+func (s *Server) resetIdentity(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.resetIdentity() invoked")
+
+	err := s.issuer.Reset()
+	if err != nil {
+		logger.Errorf("Server -> issuer.Reset() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusInternalServerError), fmt.Sprintf("can't reset the identity. err: %v", err))
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, "identity reset")
+}
+
+func (s *Server) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Server.getAuditLog() invoked")
+
+	res, err := s.issuer.GetAuditLog()
+	if err != nil {
+		logger.Errorf("Server -> issuer.GetAuditLog() return err, err: %v", err)
+		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't get audit log. err: %v", err))
+		return
+	}
+
 	EncodeResponse(w, http.StatusOK, res)
 }
 
@@ -128,7 +812,7 @@ func (s *Server) callback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resB, err := s.issuer.CommHandler.Callback(sessionID, tokenBytes)
+	resB, err := s.issuer.CommHandler().Callback(sessionID, tokenBytes)
 	if err != nil {
 		logger.Errorf("Server.callback() return err, err: %v", err)
 		EncodeResponse(w, http.StatusInternalServerError, fmt.Errorf("can't handle callback request"))
@@ -148,7 +832,7 @@ func (s *Server) getRequestStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resB, err := s.issuer.CommHandler.GetRequestStatus(id)
+	resB, err := s.issuer.CommHandler().GetRequestStatus(id)
 	if err != nil {
 		logger.Errorf("Server -> issuer.CommHandler.GetRequestStatus() return err, err: %v", err)
 		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't get request status. err: %v", err))
@@ -174,7 +858,7 @@ func (s *Server) getAgeClaimOffer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resB, err := s.issuer.CommHandler.GetAgeClaimOffer(userId, claimId)
+	resB, err := s.issuer.CommHandler().GetAgeClaimOffer(userId, claimId)
 	if err != nil {
 		logger.Errorf("Server -> issuer.CommHandler.getAgeClaimOffer() return err, err: %v", err)
 		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't get age claim offer. err: %v", err))
@@ -187,7 +871,7 @@ func (s *Server) getAgeClaimOffer(w http.ResponseWriter, r *http.Request) {
 func (s *Server) getAuthVerificationRequest(w http.ResponseWriter, r *http.Request) {
 	logger.Debug("Server.getAuthVerificationRequest() invoked")
 
-	resB, sessionId, err := s.issuer.CommHandler.GetAuthVerificationRequest()
+	resB, sessionId, err := s.issuer.CommHandler().GetAuthVerificationRequest()
 	if err != nil {
 		logger.Errorf("Server -> issuer.CommHandler.GetAuthVerificationRequest() return err, err: %v", err)
 		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't get auth verification request. err: %v", err))
@@ -208,7 +892,7 @@ func (s *Server) getAgeVerificationRequest(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	resB, sessionId, err := s.issuer.CommHandler.GetAgeVerificationRequest(circuitType)
+	resB, sessionId, err := s.issuer.CommHandler().GetAgeVerificationRequest(circuitType)
 	if err != nil {
 		logger.Errorf("Server -> issuer.CommHandler.GetAuthVerificationRequest() return err, err: %v", err)
 		EncodeResponse(w, http.StatusInternalServerError, fmt.Sprintf("can't get auth verification request. err: %v", err))
@@ -230,7 +914,7 @@ func (s *Server) agent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := s.issuer.CmdHandler.Handle(bodyB)
+	res, err := s.issuer.CmdHandler().Handle(bodyB)
 	if err != nil {
 		logger.Errorf("Server -> commHandler.Handle() return err, err: %v", err)
 		EncodeResponse(w, http.StatusInternalServerError, "error on handle income request, err: "+err.Error())
@@ -241,17 +925,50 @@ func (s *Server) agent(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) publish(w http.ResponseWriter, r *http.Request) {
-	logger.Debug("Server.publish() invoked")
+	log := logging.FromContext(r.Context())
+	log.Debug("Server.publish() invoked")
 
-	txHex, err := s.issuer.PublishLatestState(r.Context())
+	jobID, err := s.issuer.PublishLatestState(r.Context())
 	if err != nil {
-		logger.Errorf("Server -> issuer.publish() return err, err: %v", err)
+		log.Errorf("Server -> issuer.publish() return err, err: %v", err)
+		var inProgress *identity.PublishInProgressError
+		if errors.As(err, &inProgress) {
+			EncodeResponse(w, http.StatusConflict, struct {
+				Error string `json:"error"`
+				Hex   string `json:"hex"`
+			}{Error: err.Error(), Hex: inProgress.TxHash})
+			return
+		}
 		EncodeResponse(w, http.StatusInternalServerError, "error on publishing latest state: "+err.Error())
 		return
 	}
 
-	res := struct {
-		Hex string `json:"hex"`
-	}{Hex: txHex}
+	EncodeResponse(w, http.StatusAccepted, models.PublishResponse{JobID: jobID})
+}
+
+func (s *Server) getPublishStatus(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+
+	res, err := s.issuer.PublishStatus(jobID)
+	if err != nil {
+		logger.Errorf("Server -> issuer.PublishStatus() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	EncodeResponse(w, http.StatusOK, res)
+}
+
+func (s *Server) publishDryRun(w http.ResponseWriter, r *http.Request) {
+	log := logging.FromContext(r.Context())
+	log.Debug("Server.publishDryRun() invoked")
+
+	res, err := s.issuer.BuildPublishPayload(r.Context())
+	if err != nil {
+		log.Errorf("Server -> issuer.BuildPublishPayload() return err, err: %v", err)
+		EncodeResponse(w, errorStatusCode(err, http.StatusInternalServerError), "error on building the publish payload: "+err.Error())
+		return
+	}
+
 	EncodeResponse(w, http.StatusOK, res)
 }
@@ -0,0 +1,13 @@
+package identity
+
+import (
+	logger "github.com/sirupsen/logrus"
+	"time"
+)
+
+// ArchiveClaims moves the claims that are revoked and expired for longer than the grace period out of the hot claims DB
+func (i *Identity) ArchiveClaims() (int, error) {
+	logger.Debug("ArchiveClaims() invoked")
+
+	return i.state.Claims.ArchiveClaims(time.Now().Add(-i.archiveGracePeriod), i.state.Revocations)
+}
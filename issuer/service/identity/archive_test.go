@@ -0,0 +1,49 @@
+package identity
+
+import (
+	"testing"
+	"time"
+)
+
+// TestArchiveRevokedClaim archives an expired claim revoked only in the revocation tree, the claim leaves the listing
+// and can still be fetched by id and by revocation nonce
+func TestArchiveRevokedClaim(t *testing.T) {
+	iden := newTestIdentity(t)
+	iden.archiveGracePeriod = 0
+	c := issueTestClaim(t, iden)
+	kept := issueTestClaim(t, iden)
+	err := iden.RevokeClaim(c.RevNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the claim row doesn't tell it is revoked, the revocation tree does
+	c.Revoked = false
+	c.Expiration = time.Now().Add(-time.Hour).Unix()
+	err = iden.state.Claims.SaveClaimDB(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := iden.ArchiveClaims()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("%d claims were archived, want 1", n)
+	}
+
+	claims, _, _, err := iden.ListClaims(nil, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims) != 1 || claims[0].ID != kept.ID.String() {
+		t.Errorf("the listing after the archiving has %d claims, want only %s", len(claims), kept.ID)
+	}
+	if _, err := iden.state.Claims.GetClaim(c.ID); err != nil {
+		t.Errorf("the archived claim can't be fetched: %v", err)
+	}
+	if byNonce, err := iden.state.Claims.GetClaimByRevNonce(c.RevNonce); err != nil || byNonce.ID != c.ID {
+		t.Errorf("the archived claim isn't found by its nonce: %v", err)
+	}
+}
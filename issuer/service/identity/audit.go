@@ -0,0 +1,42 @@
+package identity
+
+import (
+	logger "github.com/sirupsen/logrus"
+	"issuer/db"
+	issuer_contract "issuer/service/models"
+)
+
+// GetAuditLog returns the audit log of the identity and whether its hash chain is intact
+func (i *Identity) GetAuditLog() (*issuer_contract.GetAuditLogResponse, error) {
+	logger.Debug("GetAuditLog() invoked")
+
+	entries, err := i.state.GetAuditLog()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &issuer_contract.GetAuditLogResponse{
+		Valid:   true,
+		Entries: make([]*issuer_contract.AuditRecord, 0, len(entries)),
+	}
+	if broken := db.VerifyAuditLog(entries); broken >= 0 {
+		logger.Warnf("audit log hash chain is broken at entry %d", entries[broken].Seq)
+		res.Valid = false
+		res.BrokenAt = entries[broken].Seq
+	}
+
+	for _, e := range entries {
+		res.Entries = append(res.Entries, &issuer_contract.AuditRecord{
+			Seq:       e.Seq,
+			Event:     e.Event,
+			ClaimID:   e.ClaimID,
+			RevNonce:  e.RevNonce,
+			State:     e.State,
+			Timestamp: e.Timestamp,
+			PrevHash:  e.PrevHash,
+			Hash:      e.Hash,
+		})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,68 @@
+package identity
+
+import (
+	"fmt"
+
+	"github.com/iden3/go-schema-processor/verifiable"
+	logger "github.com/sirupsen/logrus"
+)
+
+// GetAuthProof generates the inclusion proof of the auth claim against the latest committed state, the state the
+// verifiers resolve on chain. Before the first publish it's the genesis state, after it the proof follows the
+// published states, so it stays valid as the identity evolves.
+func (i *Identity) GetAuthProof() (*verifiable.Iden3SparseMerkleProof, error) {
+	logger.Debug("GetAuthProof() invoked")
+
+	authClaim, err := i.state.Claims.GetClaim(i.authClaimID())
+	if err != nil {
+		return nil, err
+	}
+	hIndex, err := authClaim.CoreClaim.HIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	view := i.state.ReadView()
+	proof, err := view.ClaimProof(hIndex)
+	if err != nil {
+		return nil, err
+	}
+	if !proof.Existence {
+		return nil, fmt.Errorf("the auth claim isn't included in the committed claims tree")
+	}
+
+	committed := view.Committed
+	stateHash, err := committed.State()
+	if err != nil {
+		return nil, err
+	}
+	stateHex := stateHash.Hex()
+	claimsRootHex := committed.ClaimsTreeRoot.Hex()
+	revsRootHex := committed.RevocationTreeRoot.Hex()
+	rootsRootHex := committed.RootsTreeRoot.Hex()
+
+	res := &verifiable.Iden3SparseMerkleProof{
+		Type: verifiable.Iden3SparseMerkleProofType,
+		MTP:  proof,
+		IssuerData: verifiable.IssuerData{
+			ID: i.Identifier(),
+			State: verifiable.State{
+				Value:              &stateHex,
+				ClaimsTreeRoot:     &claimsRootHex,
+				RevocationTreeRoot: &revsRootHex,
+				RootOfRoots:        &rootsRootHex,
+			},
+			AuthClaim:        authClaim.CoreClaim,
+			MTP:              proof,
+			RevocationStatus: fmt.Sprintf("%s/api/v1/claims/revocations/%d", i.publicUrl, authClaim.RevNonce),
+		},
+	}
+	if committed.Info != nil {
+		blockTimestamp, blockNumber := int(committed.Info.BlockTimestamp), int(committed.Info.BlockNumber)
+		res.IssuerData.State.TxID = &committed.Info.TxId
+		res.IssuerData.State.BlockTimestamp = &blockTimestamp
+		res.IssuerData.State.BlockNumber = &blockNumber
+	}
+
+	return res, nil
+}
@@ -0,0 +1,266 @@
+package identity
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	core "github.com/iden3/go-iden3-core"
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/scrypt"
+	"issuer/db"
+	"issuer/service/cfgs"
+	"issuer/service/identity/state"
+	"issuer/service/schema"
+)
+
+// The backup of an identity is laid out as
+//
+//	magic "IBAK" | format version (1 byte) | scrypt salt (16 bytes) | AES-GCM nonce (12 bytes) | ciphertext
+//
+// The key is derived from the backup passphrase with scrypt (N=32768, r=8, p=1) and the ciphertext is the AES-256-GCM
+// sealed JSON of backupPayload, authenticated along with the magic and version. A format version bump is required
+// for any change to the layout or to backupPayload that older versions can't read; Import refuses the versions it
+// doesn't know rather than guessing.
+const (
+	backupMagic         = "IBAK"
+	backupFormatVersion = 1
+
+	backupSaltSize = 16
+	backupKeySize  = 32
+)
+
+// ErrBackupPassphrase is returned when the backup passphrase isn't set or doesn't open the backup
+var ErrBackupPassphrase = errors.New("the backup passphrase is missing or wrong")
+
+// backupPayload is the sealed content of a backup
+type backupPayload struct {
+	SecretKey    string        `json:"secretKey"`
+	Identifier   string        `json:"identifier"`
+	AuthClaimID  string        `json:"authClaimId"`
+	PublicURL    string        `json:"publicUrl"`
+	GenesisState string        `json:"genesisState"`
+	State        *state.Backup `json:"state"`
+	// LastPublishedState is empty when the identity never published
+	LastPublishedState string `json:"lastPublishedState,omitempty"`
+	// Transitions are the confirmed state transitions, oldest first
+	Transitions []*db.StateTransition `json:"transitions,omitempty"`
+}
+
+// Export seals the private key, the identifier, the auth claim id, the base url and the claims and trees of the
+// identity in a backup encrypted with the backup passphrase
+func (i *Identity) Export() ([]byte, error) {
+	logger.Debug("Export() invoked")
+
+	if i.backupPassphrase == "" {
+		return nil, errors.Wrap(ErrBackupPassphrase, "the backup_passphrase config parameter isn't set")
+	}
+
+	stateBackup, err := i.state.Backup()
+	if err != nil {
+		return nil, err
+	}
+	genesisState, err := i.state.GetGenesisState()
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &backupPayload{
+		SecretKey:   hex.EncodeToString(i.sk[:]),
+		Identifier:  i.Identifier().String(),
+		AuthClaimID: i.authClaimID().String(),
+		PublicURL:   i.publicUrl,
+		State:       stateBackup,
+	}
+	if genesisState != nil {
+		payload.GenesisState = genesisState.Hex()
+	}
+	lastPublished, err := i.state.GetLastPublishedState()
+	if err != nil {
+		return nil, err
+	}
+	if lastPublished != nil {
+		payload.LastPublishedState = lastPublished.Hex()
+	}
+	payload.Transitions, err = i.state.GetStateTransitions()
+	if err != nil {
+		return nil, err
+	}
+	plain, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(backupMagic), backupFormatVersion)
+	salt := make([]byte, backupSaltSize)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := backupCipher(i.backupPassphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	res := append(append(append([]byte{}, header...), salt...), nonce...)
+	return aead.Seal(res, nonce, plain, header), nil
+}
+
+// Import restores the identity of the backup into the empty DB and constructs it, its trees in the namespace of its
+// identifier. The claims tree is rebuilt from the restored claim rows and the revocation and roots trees from their
+// leaves, the import fails unless the rebuilt trees give the latest state of the exported identity. The identity is
+// restored in a single transaction, a failed import leaves the DB empty.
+func Import(
+	d *db.DB,
+	depths state.TreeDepths,
+	data []byte,
+	schemaBuilder *schema.Builder,
+	cfg *cfgs.IssuerConfig,
+	stateStore StateStore,
+) (*Identity, error) {
+	logger.Debug("Import() invoked")
+
+	payload, err := openBackup(data, cfg.BackupPassphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	skBytes, err := hex.DecodeString(payload.SecretKey)
+	if err != nil || len(skBytes) != len(babyjub.PrivateKey{}) {
+		return nil, fmt.Errorf("the backup holds a malformed secret key")
+	}
+	var sk babyjub.PrivateKey
+	copy(sk[:], skBytes)
+	if cfg.IdentitySecretKey != "" && cfg.IdentitySecretKey != payload.SecretKey {
+		return nil, fmt.Errorf(`the config parameter "identity_secret_key" isn't the key of the imported identity`)
+	}
+	if payload.PublicURL != cfg.PublicUrl {
+		logger.Warnf("the identity was exported with the public url %s, the credentials it issued keep pointing to it",
+			payload.PublicURL)
+	}
+
+	identifier, authClaimID, genesisState, err := payload.identity()
+	if err != nil {
+		return nil, err
+	}
+	record := &db.IdentityRecord{
+		AuthClaimID:        authClaimID.String(),
+		LastPublishedState: payload.LastPublishedState,
+		Transitions:        payload.Transitions,
+	}
+	if genesisState != nil {
+		record.GenesisState = genesisState.Hex()
+	}
+	if record.LastPublishedState == "" && len(record.Transitions) > 0 {
+		record.LastPublishedState = record.Transitions[len(record.Transitions)-1].NewState
+	}
+	if record.LastPublishedState != "" {
+		_, err = merkletree.NewHashFromHex(record.LastPublishedState)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s, err := state.NewIdentityState(d, state.TreeNamespace(identifier), depths)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Restore(identifier, record, payload.State)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("identity %s was imported", payload.Identifier)
+
+	return New(s, schemaBuilder, sk, cfg, stateStore)
+}
+
+// openBackup checks the layout and the format version of the backup and decrypts its payload
+func openBackup(data []byte, passphrase string) (*backupPayload, error) {
+	if passphrase == "" {
+		return nil, errors.Wrap(ErrBackupPassphrase, "the backup_passphrase config parameter isn't set")
+	}
+
+	headerSize := len(backupMagic) + 1
+	if len(data) < headerSize || !bytes.Equal(data[:len(backupMagic)], []byte(backupMagic)) {
+		return nil, fmt.Errorf("the data isn't an identity backup")
+	}
+	if v := data[len(backupMagic)]; v != backupFormatVersion {
+		return nil, fmt.Errorf("unsupported backup format version %d, expected %d", v, backupFormatVersion)
+	}
+	header, rest := data[:headerSize], data[headerSize:]
+	if len(rest) < backupSaltSize {
+		return nil, fmt.Errorf("the backup is truncated")
+	}
+	salt, rest := rest[:backupSaltSize], rest[backupSaltSize:]
+
+	aead, err := backupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("the backup is truncated")
+	}
+	nonce, sealed := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+
+	plain, err := aead.Open(nil, nonce, sealed, header)
+	if err != nil {
+		return nil, ErrBackupPassphrase
+	}
+
+	payload := &backupPayload{}
+	err = json.Unmarshal(plain, payload)
+	if err != nil {
+		return nil, err
+	}
+	if payload.State == nil || payload.State.Claims == nil {
+		return nil, fmt.Errorf("the backup holds no state")
+	}
+
+	return payload, nil
+}
+
+// backupCipher derives the key from the passphrase and the salt
+func backupCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, backupKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// identity parses the identity record of the backup, the genesis state is nil when it wasn't recorded
+func (p *backupPayload) identity() (*core.ID, uuid.UUID, *merkletree.Hash, error) {
+	identifier, err := core.IDFromString(p.Identifier)
+	if err != nil {
+		return nil, uuid.UUID{}, nil, err
+	}
+	authClaimID, err := uuid.Parse(p.AuthClaimID)
+	if err != nil {
+		return nil, uuid.UUID{}, nil, err
+	}
+	if p.GenesisState == "" {
+		return &identifier, authClaimID, nil, nil
+	}
+	genesisState, err := merkletree.NewHashFromHex(p.GenesisState)
+	if err != nil {
+		return nil, uuid.UUID{}, nil, err
+	}
+
+	return &identifier, authClaimID, genesisState, nil
+}
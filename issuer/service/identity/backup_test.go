@@ -0,0 +1,160 @@
+package identity
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/iden3/go-merkletree-sql"
+	"go.etcd.io/bbolt"
+	"issuer/db"
+	"issuer/service/identity/state"
+	"issuer/service/schema"
+	"testing"
+)
+
+const testBackupPassphrase = "test backup passphrase"
+
+// commitTestState applies the state transition to the latest state and commits it, the way a confirmed publish does
+func commitTestState(t *testing.T, iden *Identity) {
+	t.Helper()
+
+	ti, err := iden.prepareStateTransition(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = iden.state.RecordStateTransition(&db.StateTransition{
+		OldState:           ti.OldTreeState.State.Hex(),
+		NewState:           ti.NewState.Hex(),
+		TxID:               "0x01",
+		BlockNumber:        1,
+		ClaimsTreeRoot:     ti.NewTreeState.ClaimsRoot.Hex(),
+		RevocationTreeRoot: ti.NewTreeState.RevocationRoot.Hex(),
+		RootsTreeRoot:      ti.NewTreeState.RootOfRoots.Hex(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = iden.state.SetCommittedState(state.CommittedState{
+		Info:               &state.Info{TxId: "0x01", BlockNumber: 1},
+		ClaimsTreeRoot:     ti.NewTreeState.ClaimsRoot,
+		RevocationTreeRoot: ti.NewTreeState.RevocationRoot,
+		RootsTreeRoot:      ti.NewTreeState.RootOfRoots,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestImportCommittedState exports an identity whose trees grew past its committed state, the imported identity
+// has the same committed state and proves the committed claims against it
+func TestImportCommittedState(t *testing.T) {
+	iden := newTestIdentity(t)
+	iden.backupPassphrase = testBackupPassphrase
+	committedClaim := issueTestClaim(t, iden)
+	commitTestState(t, iden)
+	issueTestClaim(t, iden)
+	err := iden.RevokeClaim(committedClaim.RevNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := iden.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := db.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+	cfg := testConfig(t)
+	cfg.BackupPassphrase = testBackupPassphrase
+	imported, err := Import(d, state.UniformTreeDepths(state.DefaultTreeDepth), backup, schema.NewBuilder(cfg, nil), cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantCommitted, gotCommitted := iden.state.SnapshotCommittedState(), imported.state.SnapshotCommittedState()
+	want, err := wantCommitted.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := gotCommitted.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equals(want) {
+		t.Fatalf("the committed state was imported as %s, want %s", got.Hex(), want.Hex())
+	}
+
+	hIndex, err := committedClaim.CoreClaim.HIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantProof, err := iden.state.GetMTPProof(iden.Identifier(), hIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotProof, err := imported.state.GetMTPProof(imported.Identifier(), hIndex)
+	if err != nil {
+		t.Fatalf("the imported identity can't prove the committed claim: %v", err)
+	}
+	wantJSON, _ := json.Marshal(wantProof)
+	gotJSON, _ := json.Marshal(gotProof)
+	if !bytes.Equal(gotJSON, wantJSON) {
+		t.Errorf("the committed claim is proven as %s, want %s", gotJSON, wantJSON)
+	}
+}
+
+// TestRestoreRollback fails a restore half way through its transaction, none of it is written
+func TestRestoreRollback(t *testing.T) {
+	iden := newTestIdentity(t)
+	issueTestClaim(t, iden)
+	backup, err := iden.state.Backup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := db.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+	// the archive isn't empty, the archived rows are restored after the claims
+	err = d.GetConnection().Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(db.ArchiveBucketName).Put([]byte("archived"), []byte("{}"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := state.NewIdentityState(d, state.TreeNamespace(iden.Identifier()), state.UniformTreeDepths(state.DefaultTreeDepth))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Restore(iden.Identifier(), &db.IdentityRecord{AuthClaimID: iden.authClaimID().String()}, backup)
+	if err == nil {
+		t.Fatal("the restore into a DB holding archived claims succeeded")
+	}
+
+	claims, err := d.GetAllClaims()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims) != 0 {
+		t.Errorf("the failed restore left %d claims", len(claims))
+	}
+	ids, err := d.ListIdentities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("the failed restore left %d identities", len(ids))
+	}
+	reopened, err := state.NewIdentityState(d, state.TreeNamespace(iden.Identifier()), state.UniformTreeDepths(state.DefaultTreeDepth))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.Claims.Tree.Root().Equals(&merkletree.HashZero) {
+		t.Errorf("the failed restore left the claims tree at %s", reopened.Claims.Tree.Root().Hex())
+	}
+}
@@ -0,0 +1,83 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"issuer/service/logging"
+	issuer_contract "issuer/service/models"
+)
+
+// CreateClaims issues all the claims of the batch or none of them. Every request is validated before any claim is
+// added, and a claim failing while it's added removes the claims of the batch added before it, so the claims tree
+// is never left with a part of the batch. The claims land in the latest state together and the next publish
+// covers the whole batch with a single state transition.
+func (i *Identity) CreateClaims(ctx context.Context, reqs []*issuer_contract.CreateClaimRequest) ([]*issuer_contract.CreateClaimResponse, error) {
+	logging.FromContext(ctx).Debugf("CreateClaims() invoked with %d claims", len(reqs))
+
+	if len(reqs) > MaxBulkClaims {
+		return nil, fmt.Errorf("a batch can hold at most %d claims, got %d", MaxBulkClaims, len(reqs))
+	}
+
+	prepared := make([]*preparedClaim, 0, len(reqs))
+	hIndexes := make(map[string]int, len(reqs))
+	for idx, cReq := range reqs {
+		p, err := i.prepareClaim(ctx, cReq)
+		if err == nil {
+			err = i.checkNotIssued(p, hIndexes, idx)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("claim %d of the batch: %w", idx+1, err)
+		}
+		prepared = append(prepared, p)
+	}
+
+	res, idx, err := i.issueBatch(prepared)
+	if err != nil {
+		return nil, fmt.Errorf("claim %d of the batch: %w", idx+1, err)
+	}
+
+	return res, nil
+}
+
+// issueBatch adds all the prepared claims or none of them, a claim failing while it's added, or while the credentials
+// it supersedes are revoked, removes the claims added. It returns the index of the failing claim along with its error.
+func (i *Identity) issueBatch(prepared []*preparedClaim) ([]*issuer_contract.CreateClaimResponse, int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for idx, p := range prepared {
+		err := i.recheckClaim(p)
+		if err == nil {
+			err = i.addClaim(p)
+		}
+		if err != nil {
+			i.rollbackBatch(prepared[:idx])
+			return nil, idx, err
+		}
+	}
+
+	res := make([]*issuer_contract.CreateClaimResponse, 0, len(prepared))
+	for idx, p := range prepared {
+		err := i.revokeSuperseded(p)
+		if err != nil {
+			// there's no taking a revocation back, the credentials superseded by the claims before it stay revoked
+			i.rollbackBatch(prepared)
+			return nil, idx, err
+		}
+		res = append(res, p.response())
+	}
+
+	return res, 0, nil
+}
+
+// rollbackBatch discards the added claims of a batch, or of a single issuance, that failed
+func (i *Identity) rollbackBatch(added []*preparedClaim) {
+	for idx := len(added) - 1; idx >= 0; idx-- {
+		p := added[idx]
+		c := p.claimModel
+		err := i.state.DiscardClaim(c)
+		if err != nil {
+			p.log.Errorf("can't roll back claim %s of the failed batch, err: %v", c.ID, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/pkg/errors"
+	"issuer/service/logging"
+	issuer_contract "issuer/service/models"
+	"time"
+)
+
+const (
+	// BulkModeBestEffort issues every valid row of a bulk issuance
+	BulkModeBestEffort = "best_effort"
+	// BulkModeAllOrNothing issues the rows of a bulk issuance only when all of them are valid
+	BulkModeAllOrNothing = "all_or_nothing"
+)
+
+// MaxBulkClaims is the maximum number of rows of a single bulk issuance
+const MaxBulkClaims = 1000
+
+// ErrBulkRejected is returned when an all or nothing bulk issuance has invalid rows, none of its rows are issued
+var ErrBulkRejected = errors.New("the bulk issuance has invalid rows, no claim was issued")
+
+// CreateClaimsFromTemplate issues a claim from the named template for every row. All the rows are validated first,
+// in all or nothing mode a single invalid row rejects the whole bulk. The rows are issued as a batch in that mode:
+// a row failing while it's issued (e.g. on a storage error) removes the rows issued before it.
+func (i *Identity) CreateClaimsFromTemplate(ctx context.Context, name string, rows []*issuer_contract.CreateClaimFromTemplateRequest) (*issuer_contract.BulkClaimsResponse, error) {
+	logging.FromContext(ctx).Debugf("CreateClaimsFromTemplate() invoked with template %s and %d rows", name, len(rows))
+
+	if len(rows) > MaxBulkClaims {
+		return nil, fmt.Errorf("a bulk issuance can hold at most %d rows, got %d", MaxBulkClaims, len(rows))
+	}
+
+	t, ok := i.templates[name]
+	if !ok {
+		return nil, errors.Wrapf(ErrTemplateNotFound, "template '%s'", name)
+	}
+
+	res := &issuer_contract.BulkClaimsResponse{Results: make([]*issuer_contract.BulkClaimResult, len(rows))}
+	prepared := make([]*preparedClaim, len(rows))
+	hIndexes := make(map[string]int, len(rows))
+	valid := true
+
+	now := time.Now()
+	for idx, row := range rows {
+		res.Results[idx] = &issuer_contract.BulkClaimResult{Row: idx + 1}
+
+		var p *preparedClaim
+		cReq, err := expandTemplate(t, row, now)
+		if err == nil {
+			p, err = i.prepareClaim(ctx, cReq)
+		}
+		if err == nil {
+			err = i.checkNotIssued(p, hIndexes, idx)
+		}
+		if err != nil {
+			res.Results[idx].Error = err.Error()
+			valid = false
+			continue
+		}
+		prepared[idx] = p
+	}
+
+	if i.bulkMode == BulkModeAllOrNothing {
+		if !valid {
+			return res, ErrBulkRejected
+		}
+		return i.issueBulkBatch(prepared, res)
+	}
+
+	for idx, p := range prepared {
+		if p == nil {
+			continue
+		}
+
+		claimRes, err := i.issueClaim(p)
+		if err != nil {
+			res.Results[idx].Error = err.Error()
+			continue
+		}
+		res.Results[idx].ID = claimRes.ID
+		res.Issued++
+	}
+
+	return res, nil
+}
+
+// issueBulkBatch issues the rows of an all or nothing bulk, all of them valid, as a batch
+func (i *Identity) issueBulkBatch(prepared []*preparedClaim, res *issuer_contract.BulkClaimsResponse) (*issuer_contract.BulkClaimsResponse, error) {
+	claimsRes, idx, err := i.issueBatch(prepared)
+	if err != nil {
+		res.Results[idx].Error = err.Error()
+		return res, fmt.Errorf("row %d: %w, no claim was issued", idx+1, err)
+	}
+
+	for idx, claimRes := range claimsRes {
+		res.Results[idx].ID = claimRes.ID
+	}
+	res.Issued = len(claimsRes)
+	return res, nil
+}
+
+// checkNotIssued rejects a claim whose index is already in the claims tree or taken by a previous row of the bulk
+func (i *Identity) checkNotIssued(p *preparedClaim, hIndexes map[string]int, idx int) error {
+	if prev, ok := hIndexes[p.claimModel.HIndex]; ok {
+		return fmt.Errorf("the claim has the same index as the claim of row %d", prev+1)
+	}
+	hIndexes[p.claimModel.HIndex] = idx
+
+	hIndex, err := p.coreClaim.HIndex()
+	if err != nil {
+		return err
+	}
+	_, _, _, err = i.state.Claims.Tree.Get(context.Background(), hIndex)
+	if err == nil {
+		return errors.New("a claim with the same index is already issued")
+	}
+	if !errors.Is(err, merkletree.ErrKeyNotFound) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	issuer_contract "issuer/service/models"
+	"strings"
+)
+
+// ErrInvalidClaimRequest is returned when a claim request misses a field it requires
+var ErrInvalidClaimRequest = errors.New("invalid claim request")
+
+// validateClaimRequest checks the request has the fields required to issue the claim, before its schema is loaded.
+// All the missing fields are listed in the error.
+func validateClaimRequest(cReq *issuer_contract.CreateClaimRequest) error {
+	if cReq == nil {
+		return errors.Wrap(ErrInvalidClaimRequest, "the request is empty")
+	}
+
+	var missing []string
+	if cReq.Schema == nil || cReq.Schema.URL == "" {
+		missing = append(missing, "schema.url")
+	}
+	if cReq.Schema == nil || cReq.Schema.Type == "" {
+		missing = append(missing, "schema.type")
+	}
+	if data := bytes.TrimSpace(cReq.Data); len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		missing = append(missing, "data")
+	}
+
+	if len(missing) > 0 {
+		return errors.Wrapf(ErrInvalidClaimRequest, "missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// CoerceFormData types the claim data of a request sent in a format without types, e.g. a form, after the fields its
+// schema declares. A request missing its schema or data is left as is, CreateClaim reports what it misses.
+func (i *Identity) CoerceFormData(ctx context.Context, cReq *issuer_contract.CreateClaimRequest) error {
+	if validateClaimRequest(cReq) != nil {
+		return nil
+	}
+
+	data, err := i.schemaBuilder.CoerceData(ctx, i.schemaBuilder.ResolveURL(cReq.Schema.URL), cReq.Schema.Type, cReq.Data)
+	if err != nil {
+		return err
+	}
+	cReq.Data = data
+	return nil
+}
+
+// CoerceTemplateFormData types the claim data of the rows sent in a format without types, e.g. a csv, after the fields
+// the schema of the named template declares. The rows of an unknown template are left as they are.
+func (i *Identity) CoerceTemplateFormData(ctx context.Context, name string, rows []*issuer_contract.CreateClaimFromTemplateRequest) error {
+	t, ok := i.templates[name]
+	if !ok {
+		return nil
+	}
+
+	schemaURL := i.schemaBuilder.ResolveURL(t.SchemaURL)
+	for n, row := range rows {
+		data, err := i.schemaBuilder.CoerceData(ctx, schemaURL, t.SchemaType, row.Data)
+		if err != nil {
+			return errors.Wrapf(err, "row %d", n+1)
+		}
+		row.Data = data
+	}
+	return nil
+}
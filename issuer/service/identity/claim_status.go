@@ -0,0 +1,73 @@
+package identity
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"issuer/db"
+	issuer_contract "issuer/service/models"
+	"math/big"
+	"time"
+)
+
+// GetClaimStatus combines the revocation status of the claim in the committed state, its expiration and
+// the freshness of the on-chain state of the issuer into a single status
+func (i *Identity) GetClaimStatus(ctx context.Context, id string) (*issuer_contract.GetClaimStatusResponse, error) {
+	logger.Debug("GetClaimStatus() invoked")
+
+	claimID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors.Wrapf(ErrClaimNotFound, "invalid claim id '%s', %v", id, err)
+	}
+
+	claimModel, err := i.state.Claims.GetClaim(claimID)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		return nil, errors.Wrapf(ErrClaimNotFound, "claim %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	committed := i.state.SnapshotCommittedState()
+	revocationProof, err := i.state.Revocations.GenerateRevocationProof(
+		new(big.Int).SetUint64(claimModel.RevNonce), committed.RevocationTreeRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &issuer_contract.GetClaimStatusResponse{
+		ID:              claimModel.ID.String(),
+		Revoked:         revocationProof.Existence,
+		RevocationProof: revocationProof,
+		Expiration:      claimModel.Expiration,
+		Expired:         claimModel.Expiration != 0 && time.Now().Unix() >= claimModel.Expiration,
+	}
+	res.Valid = !res.Revoked && !res.Expired
+
+	committedState, err := committed.State()
+	if err != nil {
+		return nil, err
+	}
+	res.Issuer.State = committedState.Hex()
+	res.Issuer.RevocationTreeRoot = committed.RevocationTreeRoot.Hex()
+
+	latestState, err := i.state.GetStateHash()
+	if err != nil {
+		return nil, err
+	}
+	if i.stateStore == nil {
+		// without a blockchain the on-chain state is left out
+		return res, nil
+	}
+	onChain, err := i.stateStore.GetLatestState(ctx, i.Identifier())
+	if err != nil {
+		return nil, err
+	}
+	if onChain != nil {
+		res.Issuer.OnChainState = onChain.State.Hex()
+		res.Issuer.Published = onChain.State.Equals(latestState)
+	}
+
+	return res, nil
+}
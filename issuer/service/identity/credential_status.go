@@ -0,0 +1,35 @@
+package identity
+
+import (
+	"github.com/iden3/go-schema-processor/verifiable"
+	"github.com/pkg/errors"
+	"issuer/service/claim"
+)
+
+// ErrUnsupportedCredentialStatus is returned when the claim request asks for an unknown credential status type, or
+// for the reverse hash service status while no reverse hash service is configured
+var ErrUnsupportedCredentialStatus = errors.New("unsupported credential status type")
+
+// credentialStatus is the type of the credential status of a claim and the url it's checked on
+type credentialStatus struct {
+	sType   verifiable.CredentialStatusType
+	urlBase string
+}
+
+// resolveCredentialStatus picks the credential status of the requested type: the revocation endpoint of the issuer
+// for SparseMerkleTreeProof (the default), or the reverse hash service for Iden3ReverseSparseMerkleTreeProof
+func (i *Identity) resolveCredentialStatus(statusType string) (credentialStatus, error) {
+	switch verifiable.CredentialStatusType(statusType) {
+	case "", verifiable.SparseMerkleTreeProof:
+		return credentialStatus{sType: verifiable.SparseMerkleTreeProof, urlBase: i.publicUrl}, nil
+	case claim.Iden3ReverseSparseMerkleTreeProof:
+		if i.reverseHashServiceUrl == "" {
+			return credentialStatus{}, errors.Wrapf(ErrUnsupportedCredentialStatus,
+				"'%s', the reverse_hash_service_url config parameter isn't set", statusType)
+		}
+		return credentialStatus{sType: claim.Iden3ReverseSparseMerkleTreeProof, urlBase: i.reverseHashServiceUrl}, nil
+	default:
+		return credentialStatus{}, errors.Wrapf(ErrUnsupportedCredentialStatus, "'%s', expected %s or %s",
+			statusType, verifiable.SparseMerkleTreeProof, claim.Iden3ReverseSparseMerkleTreeProof)
+	}
+}
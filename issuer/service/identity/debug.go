@@ -0,0 +1,100 @@
+package identity
+
+import (
+	"github.com/google/uuid"
+	"github.com/iden3/go-merkletree-sql"
+	logger "github.com/sirupsen/logrus"
+	"issuer/service/claim"
+	"issuer/service/identity/state"
+	issuer_contract "issuer/service/models"
+)
+
+// DebugClaim returns the stored claim, the auth claim, the latest and committed roots of the trees and the proofs of
+// the claim in both, all taken at the same point in time
+func (i *Identity) DebugClaim(id string) (*issuer_contract.DebugClaimResponse, error) {
+	logger.Debug("DebugClaim() invoked")
+
+	claimID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+
+	claimModel, err := i.state.Claims.GetClaim(claimID)
+	if err != nil {
+		return nil, err
+	}
+	authClaimModel, err := i.state.Claims.GetClaim(i.authClaimID())
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := i.state.DebugClaim(claimModel.CoreClaim, claimModel.RevNonce)
+	if err != nil {
+		return nil, err
+	}
+
+	committedState, err := d.Committed.State()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &issuer_contract.DebugClaimResponse{
+		Identifier: i.Identifier().String(),
+		Latest: issuer_contract.DebugTreeState{
+			State:              d.LatestState.Hex(),
+			ClaimsTreeRoot:     d.LatestClaimsRoot.Hex(),
+			RevocationTreeRoot: d.LatestRevocationRoot.Hex(),
+			RootOfRoots:        d.LatestRootsRoot.Hex(),
+		},
+		Committed:                debugTreeState(d.Committed, committedState),
+		AuthClaim:                debugClaim(authClaimModel),
+		Claim:                    debugClaim(claimModel),
+		InclusionProof:           d.InclusionProof,
+		RevocationProof:          d.RevocationProof,
+		CommittedInclusionProof:  d.CommittedInclusionProof,
+		CommittedRevocationProof: d.CommittedRevocationProof,
+	}
+
+	return res, nil
+}
+
+func debugTreeState(cs state.CommittedState, stateHash *merkletree.Hash) issuer_contract.DebugTreeState {
+	ts := issuer_contract.DebugTreeState{
+		State:              stateHash.Hex(),
+		ClaimsTreeRoot:     cs.ClaimsTreeRoot.Hex(),
+		RevocationTreeRoot: cs.RevocationTreeRoot.Hex(),
+		RootOfRoots:        cs.RootsTreeRoot.Hex(),
+	}
+	if cs.Info != nil {
+		ts.TxID = cs.Info.TxId
+		ts.BlockNumber = cs.Info.BlockNumber
+		ts.BlockTimestamp = cs.Info.BlockTimestamp
+	}
+	return ts
+}
+
+func debugClaim(c *claim.Claim) issuer_contract.DebugClaim {
+	slots := c.CoreClaim.RawSlotsAsInts()
+	entry := make([]string, len(slots))
+	for idx, s := range slots {
+		entry[idx] = s.String()
+	}
+
+	return issuer_contract.DebugClaim{
+		ID:              c.ID.String(),
+		SchemaURL:       c.SchemaURL,
+		SchemaType:      c.SchemaType,
+		SchemaHash:      c.SchemaHash,
+		OtherIdentifier: c.OtherIdentifier,
+		Expiration:      c.Expiration,
+		Revoked:         c.Revoked,
+		Version:         c.Version,
+		RevNonce:        c.RevNonce,
+		HIndex:          c.HIndex,
+		Status:          c.Status,
+		Entry:           entry,
+		Data:            c.Data,
+		MTPProof:        c.MTPProof,
+		SignatureProof:  c.SignatureProof,
+	}
+}
@@ -0,0 +1,63 @@
+package identity
+
+import (
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+// ErrClaimPublished is returned when discarding a claim that a published state already holds, it can only be revoked
+var ErrClaimPublished = errors.New("the claim is in a published state, revoke it instead")
+
+// DiscardUnpublishedClaim removes a claim issued by mistake from the claims tree and the DB, leaving no revocation
+// behind. Only the claims that no published state holds can be discarded, and not while a publish is in flight
+// since its transaction may already hold the claim.
+func (i *Identity) DiscardUnpublishedClaim(id string) error {
+	logger.Debugf("DiscardUnpublishedClaim() invoked with claim %s", id)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	claimID, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+
+	err = i.publishGate.tryEnter()
+	if err != nil {
+		return err
+	}
+	defer i.publishGate.leave()
+
+	claimModel, err := i.state.Claims.GetClaim(claimID)
+	if err != nil {
+		return err
+	}
+	if claimModel.ID == i.authClaimID() {
+		return errors.New("the auth claim of the identity can't be discarded")
+	}
+	if claimModel.SignatureOnly {
+		// the credential is valid as soon as it's signed, there is no publish to get ahead of
+		return errors.Wrapf(ErrClaimPublished, "signature-only claim %s", id)
+	}
+
+	hIndex, err := claimModel.CoreClaim.HIndex()
+	if err != nil {
+		return err
+	}
+	proof, err := i.state.ReadView().ClaimProof(hIndex)
+	if err != nil {
+		return err
+	}
+	if proof.Existence {
+		return errors.Wrapf(ErrClaimPublished, "claim %s", id)
+	}
+
+	err = i.state.DiscardClaim(claimModel)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("claim %s was discarded before being published", id)
+	return nil
+}
@@ -0,0 +1,49 @@
+package identity
+
+import (
+	logger "github.com/sirupsen/logrus"
+	issuer_contract "issuer/service/models"
+)
+
+const (
+	// DefaultEventsLimit is the number of events returned when the consumer doesn't ask for a number
+	DefaultEventsLimit = 100
+	// MaxEventsLimit is the maximum number of events returned at once
+	MaxEventsLimit = 1000
+)
+
+// GetEvents returns the issuance and revocation events after the since offset, 0 returns the stream from its start
+func (i *Identity) GetEvents(since uint64, limit int) (*issuer_contract.GetEventsResponse, error) {
+	logger.Debugf("GetEvents() invoked with since %d", since)
+
+	if limit <= 0 {
+		limit = DefaultEventsLimit
+	}
+	if limit > MaxEventsLimit {
+		limit = MaxEventsLimit
+	}
+
+	events, err := i.state.GetEvents(since, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &issuer_contract.GetEventsResponse{
+		Events:     make([]*issuer_contract.EventRecord, 0, len(events)),
+		NextOffset: since,
+	}
+	for _, e := range events {
+		res.Events = append(res.Events, &issuer_contract.EventRecord{
+			Offset:     e.Offset,
+			Type:       e.Type,
+			ClaimID:    e.ClaimID,
+			SchemaType: e.SchemaType,
+			RevNonce:   e.RevNonce,
+			Timestamp:  e.Timestamp,
+			TxID:       e.TxID,
+		})
+		res.NextOffset = e.Offset
+	}
+
+	return res, nil
+}
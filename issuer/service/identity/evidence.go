@@ -0,0 +1,49 @@
+package identity
+
+import (
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"issuer/db"
+)
+
+var (
+	ErrEvidenceNotFound = errors.New("referenced credential doesn't exist")
+	ErrEvidenceRevoked  = errors.New("referenced credential is revoked")
+)
+
+// resolveEvidence checks that the credential referenced by a new claim was issued by this identity and
+// is still valid, and returns its id. An empty reference returns nil, the claim doesn't reference anything.
+func (i *Identity) resolveEvidence(ref string) (*uuid.UUID, error) {
+	logger.Debug("resolveEvidence() invoked")
+
+	if ref == "" {
+		return nil, nil
+	}
+
+	id, err := uuid.Parse(ref)
+	if err != nil {
+		return nil, errors.Wrapf(ErrEvidenceNotFound, "invalid credential id '%s'", ref)
+	}
+
+	c, err := i.state.Claims.GetClaim(id)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		return nil, errors.Wrapf(ErrEvidenceNotFound, "credential id '%s'", ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Revoked {
+		return nil, errors.Wrapf(ErrEvidenceRevoked, "credential id '%s'", ref)
+	}
+	revoked, err := i.state.Revocations.IsRevoked(c.RevNonce)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errors.Wrapf(ErrEvidenceRevoked, "credential id '%s'", ref)
+	}
+
+	return &id, nil
+}
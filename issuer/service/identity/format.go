@@ -0,0 +1,44 @@
+package identity
+
+import (
+	"fmt"
+	"github.com/iden3/go-merkletree-sql"
+)
+
+// HashFormat is the encoding of the state and root values in the responses
+type HashFormat string
+
+const (
+	// HashFormatHex encodes the values as the hex of their little-endian bytes, the default
+	HashFormatHex HashFormat = "hex"
+	// HashFormatDec encodes the values as the decimal string of their field element
+	HashFormatDec HashFormat = "dec"
+)
+
+// ParseHashFormat parses the requested format, an empty format is the default hex format
+func ParseHashFormat(s string) (HashFormat, error) {
+	switch HashFormat(s) {
+	case "", HashFormatHex:
+		return HashFormatHex, nil
+	case HashFormatDec:
+		return HashFormatDec, nil
+	default:
+		return "", fmt.Errorf("unsupported format '%s', supported formats are '%s' and '%s'", s, HashFormatHex, HashFormatDec)
+	}
+}
+
+// Format encodes the hash in the format
+func (f HashFormat) Format(h *merkletree.Hash) string {
+	if f == HashFormatDec {
+		return h.BigInt().String()
+	}
+	return h.Hex()
+}
+
+// Parse decodes a hash encoded in the format
+func (f HashFormat) Parse(s string) (*merkletree.Hash, error) {
+	if f == HashFormatDec {
+		return merkletree.NewHashFromString(s)
+	}
+	return merkletree.NewHashFromHex(s)
+}
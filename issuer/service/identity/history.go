@@ -0,0 +1,39 @@
+package identity
+
+import (
+	logger "github.com/sirupsen/logrus"
+)
+
+// StateTransitionRecord is a state transition of the identity confirmed on chain
+type StateTransitionRecord struct {
+	OldState    string `codec:"oldState"`
+	NewState    string `codec:"newState"`
+	TxID        string `codec:"txId"`
+	BlockNumber uint64 `codec:"blockNumber"`
+	// Timestamp is the time of the block the transition was mined in, in unix seconds
+	Timestamp int64 `codec:"timestamp"`
+}
+
+// GetStateTransitionHistory returns the confirmed state transitions of the identity, oldest first. A credential is
+// provable with an MTP proof from the first state including its claim.
+func (i *Identity) GetStateTransitionHistory() ([]StateTransitionRecord, error) {
+	logger.Debug("GetStateTransitionHistory() invoked")
+
+	transitions, err := i.state.GetStateTransitions()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]StateTransitionRecord, 0, len(transitions))
+	for _, t := range transitions {
+		res = append(res, StateTransitionRecord{
+			OldState:    t.OldState,
+			NewState:    t.NewState,
+			TxID:        t.TxID,
+			BlockNumber: t.BlockNumber,
+			Timestamp:   t.Timestamp,
+		})
+	}
+
+	return res, nil
+}
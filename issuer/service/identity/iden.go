@@ -4,36 +4,80 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/google/uuid"
 	core "github.com/iden3/go-iden3-core"
 	"github.com/iden3/go-iden3-crypto/babyjub"
 	"github.com/iden3/go-iden3-crypto/utils"
+	"github.com/iden3/go-merkletree-sql"
 	"github.com/iden3/go-schema-processor/verifiable"
 	"github.com/pkg/errors"
 	logger "github.com/sirupsen/logrus"
+	"issuer/db"
 	"issuer/service/cfgs"
 	"issuer/service/claim"
 	"issuer/service/command"
 	"issuer/service/communication"
 	"issuer/service/identity/state"
+	"issuer/service/logging"
+	"issuer/service/metrics"
 	issuer_contract "issuer/service/models"
 	"issuer/service/schema"
 	"math/big"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Identity struct {
 	sk           babyjub.PrivateKey
-	Identifier   *core.ID
-	authClaimId  *uuid.UUID
-	authClaim    *core.Claim
 	publicUrl    string
 	circuitsPath string
+	schemas      []cfgs.SchemaConfig
+	templates    map[string]cfgs.ClaimTemplate
+	// singleActive is the single active credential policy per schema type
+	singleActive map[string]string
+
+	archiveGracePeriod time.Duration
+	maxIssuanceSkew    time.Duration
+	strictIssuance     bool
+	subjectBlinding    bool
+	bulkMode           string
+	subjectNetworks    subjectNetworks
+	transitionInputs   transitionInputsCache
+	publishGate        *publishGate
+	proofUpgrades      proofUpgrades
+
+	revocationBatchWorkers int
+	backupPassphrase       string
+	// revNonces generates the revocation nonces of the claims requested without one
+	revNonces func() (uint64, error)
+
+	// reverseHashServiceUrl backs the Iden3ReverseSparseMerkleTreeProof credential status, it isn't offered when empty
+	reverseHashServiceUrl string
+
+	// blockchain and network are the DID network of the identity
+	blockchain string
+	network    string
+
+	// mu serializes the operations changing the trees: issuing, revoking and discarding claims and preparing a state
+	// transition, so none of them sees the trees half way through another. The reads don't take it.
+	mu sync.Mutex
+
+	// idMu guards the identifier, the auth claim and the handlers serving them, Reset swaps them all while the
+	// requests are read through the accessors
+	idMu        sync.RWMutex
+	identifier  *core.ID
+	authClaimId *uuid.UUID
+	authClaim   *core.Claim
+	cmdHandler  *command.Handler
+	commHandler *communication.Handler
 
 	state         *state.IdentityState
-	CmdHandler    *command.Handler
-	CommHandler   *communication.Handler
 	schemaBuilder *schema.Builder
 	stateStore    StateStore
+	// publishTimeout bounds the calls to the blockchain, e.g. sending a state transition
+	publishTimeout time.Duration
 }
 
 func New(
@@ -42,6 +86,53 @@ func New(
 	sk babyjub.PrivateKey,
 	cfg *cfgs.IssuerConfig,
 	stateStore StateStore,
+) (*Identity, error) {
+	return newIdentity(s, schemaBuilder, sk, cfg, stateStore, nil)
+}
+
+// Open loads the single identity saved in the DB, or sets one up with the key when the DB holds none. The trees of the
+// identity are stored in the namespace of its identifier, a new identity's is derived from its genesis auth claim.
+func Open(
+	db *db.DB,
+	schemaBuilder *schema.Builder,
+	sk babyjub.PrivateKey,
+	cfg *cfgs.IssuerConfig,
+	stateStore StateStore,
+	depths state.TreeDepths,
+) (*Identity, error) {
+	s, err := state.OpenIdentityState(db, depths)
+	if err != nil {
+		return nil, err
+	}
+	if s != nil {
+		return New(s, schemaBuilder, sk, cfg, stateStore)
+	}
+
+	authClaim, err := state.NewAuthClaim(sk.Public())
+	if err != nil {
+		return nil, err
+	}
+	identifier, err := state.GenesisIdentifier(authClaim, depths.Claims, DIDType(cfg.Blockchain, cfg.Network))
+	if err != nil {
+		return nil, err
+	}
+	s, err = state.NewIdentityState(db, state.TreeNamespace(identifier), depths)
+	if err != nil {
+		return nil, err
+	}
+
+	return newIdentity(s, schemaBuilder, sk, cfg, stateStore, authClaim)
+}
+
+// newIdentity loads the identity saved in the state, or sets one up with the given auth claim when the state is
+// empty. A nil auth claim is created from the key.
+func newIdentity(
+	s *state.IdentityState,
+	schemaBuilder *schema.Builder,
+	sk babyjub.PrivateKey,
+	cfg *cfgs.IssuerConfig,
+	stateStore StateStore,
+	authClaim *core.Claim,
 ) (*Identity, error) {
 	logger.Debug("construct the issuer's identity")
 
@@ -52,7 +143,38 @@ func New(
 		sk:           sk,
 		publicUrl:    cfg.PublicUrl,
 		circuitsPath: cfg.CircuitsDir,
+		schemas:      cfg.Schemas,
+		templates:    make(map[string]cfgs.ClaimTemplate, len(cfg.Templates)),
+		singleActive: make(map[string]string),
 		stateStore:   stateStore,
+
+		archiveGracePeriod: cfg.ClaimArchiveGracePeriod,
+		maxIssuanceSkew:    cfg.ClaimMaxIssuanceSkew,
+		publishTimeout:     cfg.PublishTimeout,
+		strictIssuance:     cfg.StrictIssuance,
+		subjectBlinding:    cfg.SubjectBlinding,
+		bulkMode:           cfg.BulkIssuanceMode,
+		subjectNetworks:    newSubjectNetworks(cfg),
+		publishGate:        newPublishGate(cfg.PublishMode),
+		proofUpgrades:      newProofUpgrades(cfg),
+
+		revocationBatchWorkers: cfg.RevocationBatchWorkers,
+		backupPassphrase:       cfg.BackupPassphrase,
+		revNonces:              newRevNonceGenerator(cfg.RevNonceBits),
+
+		reverseHashServiceUrl: strings.TrimSuffix(cfg.ReverseHashServiceUrl, "/"),
+
+		blockchain: cfg.Blockchain,
+		network:    cfg.Network,
+	}
+
+	for _, t := range cfg.Templates {
+		iden.templates[t.Name] = t
+	}
+	for _, sc := range cfg.Schemas {
+		if sc.SingleActive != "" {
+			iden.singleActive[sc.Type] = sc.SingleActive
+		}
 	}
 
 	id, authClaimId, err := iden.state.GetIdentityFromDB()
@@ -63,15 +185,13 @@ func New(
 	if id != nil && len(id) > 0 { // case: identity found -> load identity
 		logger.Debug("loading existing identity from DB")
 
-		iden.Identifier = id
+		iden.identifier = id
 		iden.authClaimId = authClaimId
-		iden.state.CommittedState = state.CommittedState{
-			IsLatestStateGenesis: iden.state.IsGenesis(),
-			RootsTreeRoot:        iden.state.Roots.Tree.Root(),
-			ClaimsTreeRoot:       iden.state.Claims.Tree.Root(),
-			RevocationTreeRoot:   iden.state.Revocations.Tree.Root(),
+		err = iden.restoreCommittedState()
+		if err != nil {
+			return nil, err
 		}
-		ac, err := iden.state.Claims.GetClaim([]byte(authClaimId.String()))
+		ac, err := iden.state.Claims.GetClaim(*authClaimId)
 		if err != nil {
 			return nil, err
 		}
@@ -79,40 +199,85 @@ func New(
 	} else { // case: identity not found -> init new identity
 		logger.Debug("creating new identity (didnt find pre-existing identity)")
 
-		err = iden.init()
+		err = iden.init(authClaim)
 		if err != nil {
 			return nil, fmt.Errorf("error on identitiy initialization, %v", err)
 		}
 	}
 
-	iden.CommHandler = communication.NewCommunicationHandler(iden.Identifier.String(), cfg)
-	iden.CmdHandler = command.NewHandler(iden.Identifier, iden.state, cfg.CircuitsDir)
+	iden.commHandler = communication.NewCommunicationHandler(iden.identifier.String(), cfg)
+	iden.cmdHandler = command.NewHandler(iden.identifier, iden.state, cfg.CircuitsDir)
 
-	logger.Debugf("finished construct issuer's identity (identifier: %s)", iden.Identifier.String())
+	logger.Debugf("finished construct issuer's identity (identifier: %s)", iden.identifier.String())
 	return iden, nil
 }
 
-func (i *Identity) init() error {
+// Identifier is the identifier the identity issues as
+func (i *Identity) Identifier() *core.ID {
+	i.idMu.RLock()
+	defer i.idMu.RUnlock()
+	return i.identifier
+}
+
+// CmdHandler handles the commands sent to the identity
+func (i *Identity) CmdHandler() *command.Handler {
+	i.idMu.RLock()
+	defer i.idMu.RUnlock()
+	return i.cmdHandler
+}
+
+// CommHandler handles the communication protocol messages of the identity
+func (i *Identity) CommHandler() *communication.Handler {
+	i.idMu.RLock()
+	defer i.idMu.RUnlock()
+	return i.commHandler
+}
+
+func (i *Identity) authClaimID() uuid.UUID {
+	i.idMu.RLock()
+	defer i.idMu.RUnlock()
+	return *i.authClaimId
+}
+
+func (i *Identity) authCoreClaim() *core.Claim {
+	i.idMu.RLock()
+	defer i.idMu.RUnlock()
+	return i.authClaim
+}
+
+// init sets up the genesis state with the auth claim, a nil auth claim is created from the key. It sets the
+// identifier and the auth claim directly, so Reset calls it holding idMu.
+func (i *Identity) init(authClaim *core.Claim) error {
 	logger.Trace("Identity.init() invoked")
 	logger.Debug("setup genesis state")
-	identifier, authClaim, err := i.state.SetupGenesisState(i.sk.Public())
+	var err error
+	if authClaim == nil {
+		authClaim, err = state.NewAuthClaim(i.sk.Public())
+		if err != nil {
+			return err
+		}
+	}
+	identifier, err := i.state.SetupGenesisStateFromAuthClaim(authClaim, DIDType(i.blockchain, i.network))
 	if err != nil {
 		return err
 	}
 
 	i.authClaim = authClaim
-	i.state.CommittedState = state.CommittedState{
+	err = i.state.SetCommittedState(state.CommittedState{
 		IsLatestStateGenesis: true,
 		ClaimsTreeRoot:       i.state.Claims.Tree.Root(),
 		RevocationTreeRoot:   i.state.Revocations.Tree.Root(),
 		RootsTreeRoot:        i.state.Roots.Tree.Root(),
+	})
+	if err != nil {
+		return err
 	}
 
-	i.Identifier = identifier
-	logger.Tracef("identity identifier: %v", i.Identifier)
+	i.identifier = identifier
+	logger.Tracef("identity identifier: %v", identifier)
 
 	logger.Debug("generating auth claim proof")
-	proof, err := i.generateProof(authClaim)
+	proof, err := i.generateProof(identifier, authClaim)
 	if err != nil {
 		return err
 	}
@@ -131,10 +296,13 @@ func (i *Identity) init() error {
 	}
 
 	authClaimModel.Data = marshalledClaimData
-	authClaimModel.Issuer = i.Identifier.String()
+	authClaimModel.Issuer = identifier.String()
 	authClaimModel.MTPProof = proof
-	authClaimModel.Identifier = i.Identifier.String()
-	authClaimModel.ID = uuid.New()
+	authClaimModel.Identifier = identifier.String()
+	authClaimModel.ID, err = claim.CredentialID(authClaim)
+	if err != nil {
+		return err
+	}
 
 	logger.Debugf("adding auth claim to db, claim-id: %x", authClaimModel.ID.String())
 	err = i.state.AddClaimToDB(authClaimModel)
@@ -143,10 +311,16 @@ func (i *Identity) init() error {
 	}
 	i.authClaimId = &authClaimModel.ID
 
-	return i.state.SaveIdentity(identifier, authClaimModel.ID)
+	committed := i.state.SnapshotCommittedState()
+	genesisState, err := committed.State()
+	if err != nil {
+		return err
+	}
+
+	return i.state.SaveIdentity(identifier, authClaimModel.ID, genesisState)
 }
 
-func (i *Identity) generateProof(claim *core.Claim) ([]byte, error) {
+func (i *Identity) generateProof(id *core.ID, claim *core.Claim) ([]byte, error) {
 	logger.Debug("identity generating proof of inclusion (of a claim)")
 
 	hIndex, err := claim.HIndex()
@@ -167,7 +341,7 @@ func (i *Identity) generateProof(claim *core.Claim) ([]byte, error) {
 	stateHashHex := stateHash.Hex()
 	claimsRootHex := i.state.Claims.Tree.Root().Hex()
 	mtProof.IssuerData = verifiable.IssuerData{
-		ID: i.Identifier,
+		ID: id,
 		State: verifiable.State{
 			Value:          &stateHashHex,
 			ClaimsTreeRoot: &claimsRootHex,
@@ -183,71 +357,314 @@ func (i *Identity) generateProof(claim *core.Claim) ([]byte, error) {
 	return proofB, nil
 }
 
-func (i *Identity) CreateClaim(cReq *issuer_contract.CreateClaimRequest) (*issuer_contract.CreateClaimResponse, error) {
-	logger.Debug("CreateClaim() invoked")
+func (i *Identity) CreateClaim(ctx context.Context, cReq *issuer_contract.CreateClaimRequest) (*issuer_contract.CreateClaimResponse, error) {
+	logging.FromContext(ctx).Debug("CreateClaim() invoked")
+
+	p, err := i.prepareClaim(ctx, cReq)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.issueClaim(p)
+}
+
+// ValidateClaim runs the checks of CreateClaim on the request, parsing its data against the schema and generating its
+// core claim, without adding the claim. It returns the error CreateClaim would, the trees and the DB are left as they are.
+func (i *Identity) ValidateClaim(ctx context.Context, cReq *issuer_contract.CreateClaimRequest) error {
+	logging.FromContext(ctx).Debug("ValidateClaim() invoked")
+
+	_, err := i.prepareClaim(ctx, cReq)
+	return err
+}
+
+// preparedClaim is a validated claim request along with the claim generated from it, ready to be issued
+type preparedClaim struct {
+	cReq       *issuer_contract.CreateClaimRequest
+	coreClaim  *core.Claim
+	claimModel *claim.Claim
+	evidence   *uuid.UUID
+	superseded []*claim.Claim
+	status     credentialStatus
+	// signatureOnly claims skip the claims tree
+	signatureOnly bool
+	// subjectID is the subject the claim is issued to, empty for a claim without subject. subject is its identifier
+	// as the claims of the subject are looked up with, the one of the claim model.
+	subjectID string
+	subject   string
+	// derivedVersion is set when the version follows the claims of the subject rather than the request
+	derivedVersion bool
+	// log is the logger of the request the claim is issued for
+	log *logger.Entry
+}
+
+// prepareClaim validates the request and generates its claim, without changing the state
+func (i *Identity) prepareClaim(ctx context.Context, cReq *issuer_contract.CreateClaimRequest) (*preparedClaim, error) {
+	log := logging.FromContext(ctx)
+
+	err := validateClaimRequest(cReq)
+	if err != nil {
+		return nil, err
+	}
+	cReq.Schema.URL = i.schemaBuilder.ResolveURL(cReq.Schema.URL)
+
+	err = i.validateClaimDates(cReq, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	signatureOnly, err := isSignatureOnly(cReq.ProofType)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := i.resolveCredentialStatus(cReq.CredentialStatusType)
+	if err != nil {
+		return nil, err
+	}
+
+	evidence, err := i.resolveEvidence(cReq.Evidence)
+	if err != nil {
+		return nil, err
+	}
+
+	subjectID := ""
+	if cReq.Identifier != "" {
+		subjectID, err = i.subjectNetworks.resolveSubject(cReq.Identifier)
+		if err != nil {
+			return nil, err
+		}
+	}
+	position, err := subjectPosition(cReq.SubjectPosition, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	revNonce, err := i.revNonce(cReq.RevNonce)
+	if err != nil {
+		return nil, err
+	}
 
-	logger.Tracef("process schema - url: %s", cReq.Schema.URL)
-	slots, encodedSchema, err := i.schemaBuilder.Process(cReq.Schema.URL, cReq.Schema.Type, cReq.Data)
+	log.Tracef("process schema - url: %s", cReq.Schema.URL)
+	slots, encodedSchema, err := i.schemaBuilder.Process(ctx, cReq.Schema.URL, cReq.Schema.Type, cReq.Data, cReq.Schema.ExpectedSchemaHash)
 	if err != nil {
 		return nil, err
 	}
 
+	var version uint32
+	derivedVersion := false
+	switch {
+	case cReq.Version != nil:
+		version = *cReq.Version
+	case subjectID != "":
+		derivedVersion = true
+		version, err = i.nextVersion(subjectID, cReq.Schema.Type)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var subjectSalt *big.Int
+	if i.subjectBlinding && subjectID != "" {
+		subjectSalt, err = claim.NewSubjectSalt()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	claimReq := &claim.CoreClaimData{
 		EncodedSchema:   encodedSchema,
 		Slots:           *slots,
-		SubjectID:       cReq.Identifier,
+		SubjectID:       subjectID,
 		Expiration:      cReq.Expiration,
-		Version:         cReq.Version,
-		Nonce:           cReq.RevNonce,
-		SubjectPosition: cReq.SubjectPosition,
+		Version:         version,
+		Nonce:           &revNonce,
+		SubjectPosition: position,
+		SubjectSalt:     subjectSalt,
 	}
 
-	logger.Debug("generating core-claim from the request")
+	log.Debug("generating core-claim from the request")
 	coreClaim, err := claim.GenerateCoreClaim(claimReq)
 	if err != nil {
 		return nil, err
 	}
 
-	hi, hv, err := coreClaim.HiHv()
+	claimModel, err := claim.CoreClaimToClaimModel(coreClaim, cReq.Schema.URL, cReq.Schema.Type)
 	if err != nil {
 		return nil, err
 	}
+	claimModel.IssuanceDate = cReq.IssuanceDate
+	if claimModel.IssuanceDate == 0 {
+		claimModel.IssuanceDate = time.Now().Unix()
+	}
+	if subjectSalt != nil {
+		// the model took the blinded id from the core claim, it keeps the subject the claim is issued to
+		subject, err := core.IDFromString(subjectID)
+		if err != nil {
+			return nil, err
+		}
+		claimModel.OtherIdentifier = subject.String()
+		claimModel.SubjectSalt = subjectSalt.String()
+	}
 
-	err = i.state.Claims.Tree.Add(context.TODO(), hi, hv)
+	subject := ""
+	if subjectID != "" {
+		subject = claimModel.OtherIdentifier
+	}
+	superseded, err := i.checkSingleActive(subject, cReq.Schema.Type)
 	if err != nil {
 		return nil, err
 	}
 
-	claimModel, err := claim.CoreClaimToClaimModel(coreClaim, cReq.Schema.URL, cReq.Schema.Type)
+	return &preparedClaim{
+		cReq:       cReq,
+		coreClaim:  coreClaim,
+		claimModel: claimModel,
+		evidence:   evidence,
+		superseded: superseded,
+		status:     status,
+
+		signatureOnly:  signatureOnly,
+		subjectID:      subjectID,
+		subject:        subject,
+		derivedVersion: derivedVersion,
+		log:            log,
+	}, nil
+}
+
+// recheckClaim repeats, under mu, the checks of prepareClaim that depend on the claims issued so far: a claim issued
+// since the claim was prepared may have taken its revocation nonce or its version, or be an active credential of its
+// type. A generated nonce and a derived version are picked again then, and the claim is generated again with them.
+func (i *Identity) recheckClaim(p *preparedClaim) error {
+	nonce, version := p.claimModel.RevNonce, p.claimModel.Version
+
+	used, err := i.isRevNonceUsed(nonce)
+	if err != nil {
+		return err
+	}
+	if used {
+		// a requested nonce is rejected, a generated one is replaced
+		nonce, err = i.revNonce(p.cReq.RevNonce)
+		if err != nil {
+			return err
+		}
+	}
+	if p.derivedVersion {
+		version, err = i.nextVersion(p.subjectID, p.cReq.Schema.Type)
+		if err != nil {
+			return err
+		}
+	}
+
+	if nonce != p.claimModel.RevNonce || version != p.claimModel.Version {
+		p.log.Debugf("claim prepared with nonce %d and version %d is issued with nonce %d and version %d",
+			p.claimModel.RevNonce, p.claimModel.Version, nonce, version)
+		p.coreClaim.SetRevocationNonce(nonce)
+		p.coreClaim.SetVersion(version)
+		claimModel, err := claim.CoreClaimToClaimModel(p.coreClaim, p.cReq.Schema.URL, p.cReq.Schema.Type)
+		if err != nil {
+			return err
+		}
+		claimModel.IssuanceDate = p.claimModel.IssuanceDate
+		claimModel.OtherIdentifier, claimModel.SubjectSalt = p.claimModel.OtherIdentifier, p.claimModel.SubjectSalt
+		p.claimModel = claimModel
+	}
+
+	p.superseded, err = i.checkSingleActive(p.subject, p.cReq.Schema.Type)
+	return err
+}
+
+// issueClaim adds the prepared claim and revokes the credentials it supersedes. The single active check is run again
+// under the lock, and the claim is removed again when a superseded credential can't be revoked.
+func (i *Identity) issueClaim(p *preparedClaim) (*issuer_contract.CreateClaimResponse, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	err := i.recheckClaim(p)
+	if err != nil {
+		return nil, err
+	}
+	err = i.addClaim(p)
 	if err != nil {
 		return nil, err
 	}
 
-	// set credential status
-	issuerIDString := i.Identifier.String()
-	cs, err := claim.CreateCredentialStatus(i.publicUrl, verifiable.SparseMerkleTreeProof, claimModel.RevNonce)
+	err = i.revokeSuperseded(p)
 	if err != nil {
+		i.rollbackBatch([]*preparedClaim{p})
 		return nil, err
 	}
 
+	return p.response(), nil
+}
+
+// response is the create-claim response of the issued claim
+func (p *preparedClaim) response() *issuer_contract.CreateClaimResponse {
+	return &issuer_contract.CreateClaimResponse{
+		ID:         p.claimModel.ID.String(),
+		SchemaHash: p.claimModel.SchemaHash,
+	}
+}
+
+// addClaim adds the prepared claim to the claims tree, unless it's signature-only, signs it and saves it along with
+// its audit. The tree and the DB can't share a transaction, so when a step after the tree insert fails the claim is
+// taken out of the tree again, keeping the state hash in step with the saved claims.
+func (i *Identity) addClaim(p *preparedClaim) error {
+	if !p.signatureOnly {
+		err := i.state.AddClaimToTree(p.coreClaim)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := i.saveClaim(p)
+	if err != nil {
+		i.rollbackClaim(p)
+		return err
+	}
+	metrics.ClaimsIssued.Inc()
+
+	return nil
+}
+
+// rollbackClaim takes a claim whose issuance failed out of the claims tree, the failed save left nothing in the DB
+func (i *Identity) rollbackClaim(p *preparedClaim) {
+	if p.signatureOnly {
+		return
+	}
+	err := i.state.RemoveClaimFromTree(p.coreClaim)
+	if err != nil {
+		p.log.Errorf("can't roll back claim %s, err: %v", p.claimModel.ID, err)
+	}
+}
+
+// saveClaim signs the claim added to the tree and saves it to the DB
+func (i *Identity) saveClaim(p *preparedClaim) error {
+	cReq, coreClaim, claimModel := p.cReq, p.coreClaim, p.claimModel
+
+	// set credential status
+	issuerIDString := i.Identifier().String()
+	cs, err := claim.CreateCredentialStatus(p.status.urlBase, p.status.sType, claimModel.RevNonce)
+	if err != nil {
+		return err
+	}
+
 	claimModel.CredentialStatus = cs
-	logger.Trace("finished creating the claim object from the user request")
+	p.log.Trace("finished creating the claim object from the user request")
 
-	logger.Debug("signing claim entry")
+	p.log.Debug("signing claim entry")
 	newClaimSig, err := claim.SignClaimEntry(coreClaim, i.sign)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	authClaim, err := i.state.Claims.GetClaim([]byte(i.authClaimId.String()))
+	authClaim, err := i.state.Claims.GetClaim(i.authClaimID())
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	logger.Debug("construct sig proof")
+	p.log.Debug("construct sig proof")
 	sigProof, err := claim.ConstructSigProof(authClaim, newClaimSig)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	sigProof.IssuerData.RevocationStatus = fmt.Sprintf("%s/api/v1/claims/revocations/%d", i.publicUrl, authClaim.RevNonce)
@@ -255,62 +672,188 @@ func (i *Identity) CreateClaim(cReq *issuer_contract.CreateClaimRequest) (*issue
 	// Save
 	claimModel.Identifier = issuerIDString
 	claimModel.Issuer = issuerIDString
-	claimModel.ID = uuid.New()
+	claimModel.ID, err = claim.CredentialID(coreClaim)
+	if err != nil {
+		return err
+	}
 	jsonSignatureProof, err := json.Marshal(sigProof)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	claimModel.SignatureProof = jsonSignatureProof
 	claimModel.Data = cReq.Data
+	claimModel.Evidence = p.evidence
+	claimModel.SignatureOnly = p.signatureOnly
 
-	logger.Debug("adding claim to the claims DB")
-	err = i.state.AddClaimToDB(claimModel)
-	if err != nil {
-		return nil, err
+	if i.strictIssuance {
+		err = i.verifyIssuedClaim(claimModel, sigProof)
+		if err != nil {
+			p.log.Errorf("claim %s failed its self verification, err: %v", claimModel.ID, err)
+			return err
+		}
 	}
 
-	return &issuer_contract.CreateClaimResponse{ID: claimModel.ID.String()}, nil
+	p.log.Debug("adding claim to the claims DB")
+	return i.state.AddIssuedClaimToDB(claimModel)
 }
 
-func (i *Identity) GetClaim(id string) (*issuer_contract.GetClaimResponse, error) {
+// revokeSuperseded revokes the credentials the issued claim supersedes
+func (i *Identity) revokeSuperseded(p *preparedClaim) error {
+	for _, c := range p.superseded {
+		err := i.revokeClaim(c)
+		if err != nil {
+			return fmt.Errorf("superseded credential %s of claim %s wasn't revoked: %w", c.ID, p.claimModel.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// GetClaim returns the credential of the claim. With verify, the stored claim is checked first: its signature proof
+// must verify against the auth claim of the issuer and the claim must be in the claims tree, ErrStoredClaimInvalid is
+// returned otherwise.
+func (i *Identity) GetClaim(id string, verify bool) (*issuer_contract.GetClaimResponse, error) {
 	logger.Debug("GetClaim() invoked")
 
 	claimID, err := uuid.Parse(id)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapf(ErrClaimNotFound, "invalid claim id '%s', %v", id, err)
 	}
 
-	claimModel, err := i.state.Claims.GetClaim([]byte(claimID.String()))
+	claimModel, err := i.state.Claims.GetClaim(claimID)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		return nil, errors.Wrapf(ErrClaimNotFound, "claim %s", id)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if !i.state.CommittedState.IsLatestStateGenesis {
-		claimIdx, err := claimModel.CoreClaim.HIndex()
+	if verify {
+		err = i.verifyStoredClaim(claimModel)
 		if err != nil {
+			logger.Errorf("claim %s read from the DB doesn't verify, err: %v", id, err)
 			return nil, err
 		}
-		mtp, err := i.state.GetMTPProof(i.Identifier, claimIdx)
-		if err != nil {
-			return nil, err
-		}
-		claimModel.MTPProof, err = json.Marshal(mtp)
+	}
+
+	return i.claimResponse(claimModel)
+}
+
+// claimResponse converts the claim to its credential, with the MTP proof once a state is published
+func (i *Identity) claimResponse(claimModel *claim.Claim) (*issuer_contract.GetClaimResponse, error) {
+	err := i.attachMTPProof(claimModel)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := claim.ClaimModelToIden3Credential(claimModel)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &issuer_contract.GetClaimResponse{Iden3Credential: c}
+	if claimModel.Expiration != 0 {
+		expiresAt := time.Unix(claimModel.Expiration, 0).UTC()
+		res.ExpiresAt = &expiresAt
+		res.Expired = !time.Now().Before(expiresAt)
+	}
+
+	return res, nil
+}
+
+// attachMTPProof sets the MTP proof of the claim against the committed state, once a state is published. Signature-only
+// claims have none.
+func (i *Identity) attachMTPProof(claimModel *claim.Claim) error {
+	if i.state.SnapshotCommittedState().IsLatestStateGenesis || claimModel.SignatureOnly {
+		return nil
+	}
+
+	claimIdx, err := claimModel.CoreClaim.HIndex()
+	if err != nil {
+		return err
+	}
+	mtp, err := i.state.GetMTPProof(i.Identifier(), claimIdx)
+	if err != nil {
+		return err
+	}
+	claimModel.MTPProof, err = json.Marshal(mtp)
+	return err
+}
+
+// GetProofBundle assembles the inclusion proof of the claim in the claims tree and the proof of its revocation
+// nonce in the revocation tree, both against the latest committed state, together with the roots and the state hash.
+// With an atState, the proofs are generated at that past state of the identity instead, e.g. the one a credential
+// was issued at.
+func (i *Identity) GetProofBundle(id string, atState *merkletree.Hash) (*issuer_contract.GetProofBundleResponse, error) {
+	logger.Debug("GetProofBundle() invoked")
+
+	claimID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+
+	claimModel, err := i.state.Claims.GetClaim(claimID)
+	if err != nil {
+		return nil, err
+	}
+	if claimModel.SignatureOnly {
+		return nil, fmt.Errorf("claim %s is a signature-only credential, it has no inclusion proof", id)
+	}
+
+	committed := i.state.SnapshotCommittedState()
+	if atState != nil {
+		committed, err = i.state.StateRoots(atState)
 		if err != nil {
 			return nil, err
 		}
 	}
+	stateHash, err := committed.State()
+	if err != nil {
+		return nil, err
+	}
 
-	c, err := claim.ClaimModelToIden3Credential(claimModel)
+	hi, hv, err := claimModel.CoreClaim.HiHv()
 	if err != nil {
 		return nil, err
 	}
 
-	res := issuer_contract.GetClaimResponse(c)
+	inclusionProof, _, err := i.state.Claims.Tree.GenerateProof(context.Background(), hi, committed.ClaimsTreeRoot)
+	if err != nil {
+		return nil, err
+	}
+	if !inclusionProof.Existence {
+		return nil, fmt.Errorf("claim %s is not included in the state %s", id, stateHash.Hex())
+	}
+
+	revocationProof, err := i.state.Revocations.GenerateRevocationProof(
+		new(big.Int).SetUint64(claimModel.RevNonce), committed.RevocationTreeRoot)
+	if err != nil {
+		return nil, err
+	}
 
-	return &res, nil
+	res := &issuer_contract.GetProofBundleResponse{
+		InclusionProof:  inclusionProof,
+		RevocationProof: revocationProof,
+	}
+	res.Issuer.ID = i.Identifier().String()
+	res.Issuer.State = stateHash.Hex()
+	res.Issuer.ClaimsTreeRoot = committed.ClaimsTreeRoot.Hex()
+	res.Issuer.RevocationTreeRoot = committed.RevocationTreeRoot.Hex()
+	res.Issuer.RootOfRoots = committed.RootsTreeRoot.Hex()
+	if committed.Info != nil {
+		res.Issuer.TxID = committed.Info.TxId
+		res.Issuer.BlockNumber = committed.Info.BlockNumber
+		res.Issuer.BlockTimestamp = committed.Info.BlockTimestamp
+	}
+	res.Claim.ID = claimModel.ID.String()
+	res.Claim.HIndex = hi.String()
+	res.Claim.HValue = hv.String()
+	res.Claim.RevNonce = claimModel.RevNonce
+
+	return res, nil
 }
 
-func (i *Identity) GetIdentity() (*issuer_contract.GetIdentityResponse, error) {
+func (i *Identity) GetIdentity(format HashFormat) (*issuer_contract.GetIdentityResponse, error) {
 	logger.Debug("GetIdentity() invoked")
 
 	stateHash, err := i.state.GetStateHash()
@@ -318,88 +861,269 @@ func (i *Identity) GetIdentity() (*issuer_contract.GetIdentityResponse, error) {
 		return nil, err
 	}
 
+	identifier := i.Identifier()
 	res := &issuer_contract.GetIdentityResponse{
-		Identifier: i.Identifier.String(),
+		Identifier: identifier.String(),
+		DID:        DID(identifier, i.blockchain, i.network),
 		State: &issuer_contract.IdentityState{
-			Identifier:         i.Identifier.String(),
-			State:              stateHash.Hex(),
-			ClaimsTreeRoot:     i.state.Claims.Tree.Root().Hex(),
-			RevocationTreeRoot: i.state.Revocations.Tree.Root().Hex(),
-			RootOfRoots:        i.state.Roots.Tree.Root().Hex(),
+			Identifier:         identifier.String(),
+			State:              format.Format(stateHash),
+			ClaimsTreeRoot:     format.Format(i.state.Claims.Tree.Root()),
+			RevocationTreeRoot: format.Format(i.state.Revocations.Tree.Root()),
+			RootOfRoots:        format.Format(i.state.Roots.Tree.Root()),
 		},
 	}
 
 	return res, nil
 }
 
-func (i *Identity) GetRevocationStatus(nonce uint64) (*issuer_contract.GetRevocationStatusResponse, error) {
-	logger.Debug("GetRevocationStatus() invoked")
+// GetSchemas returns the catalog of credential types the issuer is configured to issue.
+// If describe is set, the fields of every credential type are resolved from its schema.
+func (i *Identity) GetSchemas(ctx context.Context, describe bool) (*issuer_contract.GetSchemasResponse, error) {
+	logger.Debug("GetSchemas() invoked")
+
+	res := &issuer_contract.GetSchemasResponse{
+		Schemas: make([]*issuer_contract.SupportedSchema, 0, len(i.schemas)),
+	}
+	for _, s := range i.schemas {
+		supported := &issuer_contract.SupportedSchema{
+			URL:         i.schemaBuilder.ResolveURL(s.URL),
+			Type:        s.Type,
+			DisplayName: s.DisplayName,
+		}
 
-	rID := new(big.Int).SetUint64(nonce)
+		if describe {
+			fields, err := i.schemaBuilder.Describe(ctx, supported.URL, s.Type)
+			if err != nil {
+				return nil, fmt.Errorf("can't describe schema %s, err: %v", s.URL, err)
+			}
+			for _, f := range fields {
+				supported.Fields = append(supported.Fields, &issuer_contract.SchemaField{
+					Name: f.Name,
+					ID:   f.ID,
+					Type: f.Type,
+				})
+			}
+		}
 
-	res := &issuer_contract.GetRevocationStatusResponse{}
-	mtp, err := i.state.Revocations.GenerateRevocationProof(rID, i.state.CommittedState.RevocationTreeRoot)
+		res.Schemas = append(res.Schemas, supported)
+	}
+
+	return res, nil
+}
+
+// Readiness reports whether the issuer can serve its requests: the DB has to be open and, when the issuer publishes
+// its states, the blockchain node has to be reachable
+func (i *Identity) Readiness(ctx context.Context) *issuer_contract.HealthResponse {
+	logger.Debug("Readiness() invoked")
+
+	res := &issuer_contract.HealthResponse{Status: issuer_contract.HealthStatusOK}
+	check := func(name string, err error) {
+		dep := &issuer_contract.DependencyStatus{Name: name, Status: issuer_contract.HealthStatusOK}
+		if err != nil {
+			dep.Status = issuer_contract.HealthStatusUnavailable
+			dep.Error = err.Error()
+			res.Status = issuer_contract.HealthStatusUnavailable
+		}
+		res.Checks = append(res.Checks, dep)
+	}
+
+	check("db", i.state.Ping())
+	if i.stateStore != nil {
+		check("blockchain", i.stateStore.Ping(ctx))
+	}
+
+	return res
+}
+
+// GetGenesis returns the genesis state the identifier was derived from and whether the identity has published any
+// state transition since
+func (i *Identity) GetGenesis() (*issuer_contract.GetGenesisResponse, error) {
+	logger.Debug("GetGenesis() invoked")
+
+	genesisState, err := i.state.GetGenesisState()
 	if err != nil {
 		return nil, err
 	}
+	if genesisState == nil {
+		return nil, errors.New("genesis state of the identity wasn't recorded")
+	}
+
+	return &issuer_contract.GetGenesisResponse{
+		Identifier:   i.Identifier().String(),
+		GenesisState: genesisState.Hex(),
+		Published:    !i.state.SnapshotCommittedState().IsLatestStateGenesis,
+	}, nil
+}
+
+// GetRevocationStatus generates the proof of the nonce in the revocation tree of the latest committed state, or of
+// the given past state of the identity
+func (i *Identity) GetRevocationStatus(nonce uint64, format HashFormat, atState *merkletree.Hash) (*issuer_contract.GetRevocationStatusResponse, error) {
+	logger.Debug("GetRevocationStatus() invoked")
+
+	var (
+		committed state.CommittedState
+		mtp       *merkletree.Proof
+		err       error
+	)
+	if atState == nil {
+		view := i.state.ReadView()
+		committed = view.Committed
+		mtp, err = view.RevocationProof(nonce)
+	} else {
+		committed, err = i.state.StateRoots(atState)
+		if err != nil {
+			return nil, err
+		}
+		mtp, err = i.state.Revocations.GenerateRevocationProof(new(big.Int).SetUint64(nonce), committed.RevocationTreeRoot)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &issuer_contract.GetRevocationStatusResponse{}
 	res.MTP = mtp
-	res.Issuer.RevocationTreeRoot = i.state.CommittedState.RevocationTreeRoot.Hex()
-	res.Issuer.RootOfRoots = i.state.CommittedState.RootsTreeRoot.Hex()
-	res.Issuer.ClaimsTreeRoot = i.state.CommittedState.ClaimsTreeRoot.Hex()
+	res.Issuer.RevocationTreeRoot = format.Format(committed.RevocationTreeRoot)
+	res.Issuer.RootOfRoots = format.Format(committed.RootsTreeRoot)
+	res.Issuer.ClaimsTreeRoot = format.Format(committed.ClaimsTreeRoot)
 
-	stateHash, err := i.state.CommittedState.State()
+	stateHash, err := committed.State()
 	if err != nil {
 		return nil, err
 	}
-	res.Issuer.State = stateHash.Hex()
+	res.Issuer.State = format.Format(stateHash)
 
 	return res, nil
 }
 
+// PublishLatestState proves the transition to the latest state and queues it to be sent, it returns the id of the
+// job the transition is sent with. The next publish waits for the transaction to be confirmed or to fail.
 func (i *Identity) PublishLatestState(ctx context.Context) (string, error) {
-	logger.Debug("PublishLatestState() invoked")
+	log := logging.FromContext(ctx)
+	log.Debug("PublishLatestState() invoked")
 
-	publisher := Publisher{
-		i:            i,
-		circuitsPath: i.circuitsPath,
-		stateStore:   i.stateStore,
+	if i.stateStore == nil {
+		return "", ErrPublishingDisabled
 	}
-	inputs, err := publisher.PrepareInputs()
+
+	err := i.publishGate.enter(ctx)
 	if err != nil {
 		return "", err
 	}
-	proof, err := publisher.GenerateProof(ctx, inputs)
+
+	publisher, ti, err := i.prepareTransition(ctx, true)
 	if err != nil {
+		i.publishGate.leave()
 		return "", err
 	}
 
-	latestState, err := i.state.CommittedState.State()
+	// the gate is left once the transaction is confirmed, the next transition starts from the confirmed state
+	publisher.onSent = func(txHex string) {
+		i.publishGate.sent(txHex)
+		log.Info("transaction for change state:", txHex)
+	}
+	publisher.onDone = i.publishGate.leave
+	jobID, err := publisher.Enqueue(ctx, ti)
 	if err != nil {
+		i.publishGate.leave()
 		return "", err
 	}
-	newState, err := i.state.GetStateHash()
+	log.Info("queued the state transition, job: ", jobID)
+
+	return jobID, nil
+}
+
+// PublishStatus returns the status of a job of PublishLatestState
+func (i *Identity) PublishStatus(jobID string) (*issuer_contract.PublishStatusResponse, error) {
+	logger.Debugf("PublishStatus() invoked with job %s", jobID)
+
+	if i.stateStore == nil {
+		return nil, ErrPublishingDisabled
+	}
+
+	status, err := i.stateStore.PublishStatus(jobID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if latestState.Equals(newState) {
-		return "", errors.New("nothing to update")
+	return &issuer_contract.PublishStatusResponse{
+		JobID:  jobID,
+		State:  string(status.State),
+		TxHash: status.TxHash,
+		Error:  status.Error,
+	}, nil
+}
+
+// BuildPublishPayload proves the transition to the latest state like PublishLatestState does, but instead of
+// sending the transaction it returns the ABI encoded transitState call data, for submitting it with other tooling
+func (i *Identity) BuildPublishPayload(ctx context.Context) (*issuer_contract.PublishPayloadResponse, error) {
+	logging.FromContext(ctx).Debug("BuildPublishPayload() invoked")
+
+	if i.stateStore == nil {
+		return nil, ErrPublishingDisabled
 	}
 
-	ti := &TransitionInfoRequest{
-		Identifier:        i.Identifier,
-		LatestState:       latestState,
-		NewState:          newState,
-		IsOldStateGenesis: i.state.CommittedState.IsLatestStateGenesis,
-		Proof:             proof.Proof,
+	err := i.publishGate.enter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer i.publishGate.leave()
+
+	// a dry run, the roots tree isn't changed
+	_, ti, err := i.prepareTransition(ctx, false)
+	if err != nil {
+		return nil, err
 	}
-	txHex, err := publisher.UpdateState(ctx, ti)
+
+	payload, err := i.stateStore.BuildStatePayload(ti)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	logger.Info("transaction for change state:", txHex)
 
-	return txHex, nil
+	return &issuer_contract.PublishPayloadResponse{
+		Identifier:        i.Identifier().String(),
+		LatestState:       ti.LatestState.Hex(),
+		NewState:          ti.NewState.Hex(),
+		IsOldStateGenesis: ti.IsOldStateGenesis,
+		Payload:           hexutil.Encode(payload),
+	}, nil
+}
+
+// Close waits for the publish in flight to be confirmed and its committed state to be saved, and keeps new publishes
+// from starting, so the DB can be closed after it
+func (i *Identity) Close(ctx context.Context) error {
+	logger.Debug("Identity.Close() invoked")
+
+	return i.publishGate.drain(ctx)
+}
+
+// prepareTransition generates the proof of the transition from the committed state to the latest state, apply is
+// unset for a dry run which leaves the roots tree as it is
+func (i *Identity) prepareTransition(ctx context.Context, apply bool) (*Publisher, *TransitionInfoRequest, error) {
+	publisher := &Publisher{
+		i:            i,
+		circuitsPath: i.circuitsPath,
+		stateStore:   i.stateStore,
+	}
+	// the states are the proven ones, claims issued while the proof is generated wait for the next transition
+	inputs, err := i.prepareStateTransition(apply)
+	if err != nil {
+		return nil, nil, err
+	}
+	proof, err := publisher.GenerateProof(ctx, inputs.JSON)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	newTreeState := inputs.NewTreeState
+	return publisher, &TransitionInfoRequest{
+		Identifier:        i.Identifier(),
+		LatestState:       inputs.OldTreeState.State,
+		NewState:          inputs.NewState,
+		IsOldStateGenesis: inputs.IsOldStateGenesis,
+		Proof:             proof.Proof,
+		newTreeState:      &newTreeState,
+	}, nil
 }
 
 func (i *Identity) sign(z *big.Int) ([]byte, error) {
@@ -410,3 +1134,16 @@ func (i *Identity) sign(z *big.Int) ([]byte, error) {
 	sig := i.sk.SignPoseidon(z).Compress()
 	return sig[:], nil
 }
+
+// GetLocalSchema returns the document of a schema the issuer hosts
+func (i *Identity) GetLocalSchema(name string) ([]byte, error) {
+	logger.Debugf("GetLocalSchema() invoked with name %s", name)
+
+	local := i.schemaBuilder.LocalSchemas()
+	if local == nil {
+		return nil, fmt.Errorf("%w: the issuer doesn't host schemas", schema.ErrLocalSchemaNotFound)
+	}
+
+	b, _, err := local.Read(name)
+	return b, err
+}
@@ -0,0 +1,455 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	core "github.com/iden3/go-iden3-core"
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/go-merkletree-sql/db/memory"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.etcd.io/bbolt"
+	"issuer/db"
+	"issuer/service/cfgs"
+	"issuer/service/claim"
+	"issuer/service/identity/state"
+	"issuer/service/metrics"
+	issuer_contract "issuer/service/models"
+	"issuer/service/schema"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// testSchema is a JSON schema the test claims are issued with, its fields are in the index slots
+const testSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "type": "object",
+  "properties": {
+    "index": {"type": "object", "default": ["birthday", "documentType"]},
+    "value": {"type": "object", "default": []},
+    "birthday": {"type": "integer"},
+    "documentType": {"type": "integer"}
+  }
+}`
+
+// newTestIdentity opens an identity with a new key in an in-memory DB. It hosts testSchema as test.json and has no
+// blockchain to publish with.
+func newTestIdentity(t *testing.T) *Identity {
+	t.Helper()
+
+	iden, _ := openTestIdentity(t)
+	return iden
+}
+
+// openTestIdentity opens an identity like newTestIdentity does, along with its DB
+func openTestIdentity(t *testing.T) (*Identity, *db.DB) {
+	t.Helper()
+
+	d, err := db.NewInMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+
+	cfg := testConfig(t)
+	iden, err := Open(d, schema.NewBuilder(cfg, nil), babyjub.NewRandPrivKey(), cfg, nil, state.UniformTreeDepths(state.DefaultTreeDepth))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return iden, d
+}
+
+// testConfig is the config of the test identities, hosting testSchema as test.json
+func testConfig(t *testing.T) *cfgs.IssuerConfig {
+	t.Helper()
+
+	schemasDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(schemasDir, "test.json"), []byte(testSchema), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &cfgs.IssuerConfig{
+		PublicUrl:    "http://localhost:8001",
+		SchemasDir:   schemasDir,
+		RevNonceBits: 32,
+		PublishMode:  "queue",
+		Blockchain:   "polygon",
+		Network:      "test",
+	}
+}
+
+// testSubject returns the identifier of a new identity to issue the test claims to
+func testSubject(t *testing.T) string {
+	t.Helper()
+
+	sk := babyjub.NewRandPrivKey()
+	authClaim, err := state.NewAuthClaim(sk.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := state.GenesisIdentifier(authClaim, state.DefaultTreeDepth, DIDType("polygon", "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id.String()
+}
+
+// testClaimRequest is the request of a claim of testSchema about the birthday of the subject
+func testClaimRequest(subject string, birthday int) *issuer_contract.CreateClaimRequest {
+	data, _ := json.Marshal(map[string]int{"birthday": birthday, "documentType": 1})
+	return &issuer_contract.CreateClaimRequest{
+		Schema:     &issuer_contract.Schema{URL: "test.json", Type: "TestCredential"},
+		Data:       data,
+		Identifier: subject,
+	}
+}
+
+// TestCreateClaimGetClaim checks the id CreateClaim returns, once through the JSON of the response, gets the claim
+func TestCreateClaimGetClaim(t *testing.T) {
+	iden := newTestIdentity(t)
+	subject := testSubject(t)
+
+	res, err := iden.CreateClaim(context.Background(), testClaimRequest(subject, 19960424))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &issuer_contract.CreateClaimResponse{}
+	err = json.Unmarshal(b, decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := iden.GetClaim(decoded.ID, false)
+	if err != nil {
+		t.Fatalf("GetClaim(%q): %v", decoded.ID, err)
+	}
+	if got.ID != res.ID {
+		t.Errorf("got the credential %s, want %s", got.ID, res.ID)
+	}
+	if got.CredentialSubject["id"] != subject {
+		t.Errorf("got the subject %v, want %s", got.CredentialSubject["id"], subject)
+	}
+	if got.CredentialSubject["birthday"] != float64(19960424) {
+		t.Errorf("got the birthday %v, want 19960424", got.CredentialSubject["birthday"])
+	}
+}
+
+// TestIssueClaimConcurrent issues the same claim to a subject from many requests at once, all prepared before any is
+// issued. Each claim must get its own version and revocation nonce, and the state must hold exactly the claims issued.
+func TestIssueClaimConcurrent(t *testing.T) {
+	iden := newTestIdentity(t)
+	subject := testSubject(t)
+	// the nonce follows the claims of the subject, so the claims prepared together are given the same nonce
+	iden.revNonces = func() (uint64, error) {
+		claims, err := iden.state.GetClaimsBySubject(subject)
+		return uint64(len(claims)) + 1000, err
+	}
+
+	const n = 32
+	prepared := make([]*preparedClaim, n)
+	for k := range prepared {
+		p, err := iden.prepareClaim(context.Background(), testClaimRequest(subject, 19960424))
+		if err != nil {
+			t.Fatal(err)
+		}
+		prepared[k] = p
+	}
+
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for k, p := range prepared {
+		wg.Add(1)
+		go func(k int, p *preparedClaim) {
+			defer wg.Done()
+			_, errs[k] = iden.issueClaim(p)
+		}(k, p)
+	}
+	wg.Wait()
+	for k, err := range errs {
+		if err != nil {
+			t.Fatalf("claim %d: %v", k, err)
+		}
+	}
+
+	claims, err := iden.state.GetClaimsBySubject(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims) != n {
+		t.Fatalf("got %d claims of the subject, want %d", len(claims), n)
+	}
+
+	// the state hash is the one of a claims tree holding the auth claim and the claims issued
+	ctx := context.Background()
+	tree, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), state.DefaultTreeDepth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := make(map[uint32]bool, n)
+	nonces := make(map[uint64]bool, n)
+	for _, c := range append(claims, &claim.Claim{CoreClaim: iden.authCoreClaim()}) {
+		if c.Identifier != "" {
+			versions[c.Version] = true
+			nonces[c.RevNonce] = true
+		}
+		hi, hv, err := c.CoreClaim.HiHv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tree.Add(ctx, hi, hv)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(versions) != n || len(nonces) != n {
+		t.Errorf("got %d versions and %d nonces for %d claims, want them all distinct", len(versions), len(nonces), n)
+	}
+
+	want, err := merkletree.HashElems(tree.Root().BigInt(), merkletree.HashZero.BigInt(), merkletree.HashZero.BigInt())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := iden.state.GetStateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equals(want) {
+		t.Errorf("got the state %s, want %s", got.Hex(), want.Hex())
+	}
+}
+
+// TestAddClaimRollback fails the DB write that follows the tree insert of a claim. The claim must be taken out of the
+// tree again and neither the claim nor its event saved, leaving the state as it was.
+func TestAddClaimRollback(t *testing.T) {
+	iden, d := openTestIdentity(t)
+	subject := testSubject(t)
+
+	before, err := iden.state.GetStateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the audit log ends with an entry that can't be decoded, the entry of the claim can't be chained to it
+	err = d.GetConnection().Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(db.AuditBucketName).Put(bytes.Repeat([]byte{0xff}, 8), []byte("not an entry"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := iden.CreateClaim(context.Background(), testClaimRequest(subject, 19960424))
+	if err == nil {
+		t.Fatalf("claim %s was issued with a broken audit log", res.ID)
+	}
+
+	after, err := iden.state.GetStateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.Equals(before) {
+		t.Errorf("got the state %s after the failed claim, want %s", after.Hex(), before.Hex())
+	}
+	claims, err := iden.state.GetClaimsBySubject(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims) != 0 {
+		t.Errorf("got %d claims of the subject after the failed claim, want none", len(claims))
+	}
+	events, err := d.GetEvents(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Errorf("got %d events after the failed claim, want none", len(events))
+	}
+}
+
+// TestResetConcurrentReads resets the identity while the requests read its identifier and handlers, the identity
+// comes back with a new identifier and the handlers swapped along with it
+func TestResetConcurrentReads(t *testing.T) {
+	iden := newTestIdentity(t)
+	before, comm, cmd := iden.Identifier(), iden.CommHandler(), iden.CmdHandler()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for k := 0; k < 4; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					_ = iden.Identifier().String()
+					_ = iden.CommHandler()
+					_ = iden.CmdHandler()
+					_ = iden.authClaimID()
+				}
+			}
+		}()
+	}
+
+	err := iden.Reset()
+	close(done)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if iden.Identifier().Equals(before) {
+		t.Error("the identity kept its identifier over the reset")
+	}
+	if iden.CommHandler() == comm || iden.CmdHandler() == cmd {
+		t.Error("the handlers weren't swapped along with the identifier")
+	}
+}
+
+// TestSubjectBlinding issues two claims to a subject with the subject blinding and the strict issuance on: the claims
+// hold different blinded ids, the claim models keep the subject, and the holder can open the blinded id with the salt
+// of the credential
+func TestSubjectBlinding(t *testing.T) {
+	iden := newTestIdentity(t)
+	iden.subjectBlinding = true
+	iden.strictIssuance = true
+	subject := testSubject(t)
+
+	blinded := map[string]bool{}
+	for _, birthday := range []int{19960424, 19960425} {
+		res, err := iden.CreateClaim(context.Background(), testClaimRequest(subject, birthday))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := iden.state.Claims.GetClaim(uuid.MustParse(res.ID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.OtherIdentifier != subject || c.SubjectSalt == "" {
+			t.Fatalf("the claim is saved with the subject %s and the salt %q, want %s and a salt", c.OtherIdentifier, c.SubjectSalt, subject)
+		}
+
+		id, err := c.CoreClaim.GetID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id.String() == subject {
+			t.Error("the claim holds the subject id as is")
+		}
+		blinded[id.String()] = true
+
+		cred, err := iden.GetClaim(res.ID, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		salt, ok := new(big.Int).SetString(fmt.Sprint(cred.CredentialSubject[claim.SubjectSaltTerm]), 10)
+		if !ok {
+			t.Fatalf("the credential gives the salt %v", cred.CredentialSubject[claim.SubjectSaltTerm])
+		}
+		subjectID, err := core.IDFromString(subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opened, err := claim.BlindSubjectID(subjectID, salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !opened.Equal(&id) {
+			t.Errorf("the salt of the credential opens the blinded id as %s, want %s", opened.String(), id.String())
+		}
+	}
+	if len(blinded) != 2 {
+		t.Error("the claims of the subject hold the same blinded id")
+	}
+
+	claims, err := iden.GetClaimsBySubject(subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims) != 2 {
+		t.Errorf("%d claims are found by the subject, want 2", len(claims))
+	}
+}
+
+// TestIssueSignatureOnlyClaimTwice issues the same signature-only claim twice, the credentials get ids of their own and
+// are both found by their revocation nonce. Saving an issued claim again is rejected rather than overwriting it.
+func TestIssueSignatureOnlyClaimTwice(t *testing.T) {
+	iden := newTestIdentity(t)
+
+	var claims []*claim.Claim
+	for n := 0; n < 2; n++ {
+		r := testClaimRequest("", 19960424)
+		r.ProofType = ProofTypeBJJSignature
+		res, err := iden.CreateClaim(context.Background(), r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := iden.state.Claims.GetClaim(uuid.MustParse(res.ID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims = append(claims, c)
+	}
+	if claims[0].ID == claims[1].ID {
+		t.Fatalf("both credentials got the id %s", claims[0].ID)
+	}
+
+	for _, c := range claims {
+		byNonce, err := iden.state.Claims.GetClaimByRevNonce(c.RevNonce)
+		if err != nil {
+			t.Fatalf("the credential %s isn't found by its nonce: %v", c.ID, err)
+		}
+		if byNonce.ID != c.ID || byNonce.RevNonce != c.RevNonce {
+			t.Errorf("the nonce %d gives the claim %s with the nonce %d, want %s", c.RevNonce, byNonce.ID,
+				byNonce.RevNonce, c.ID)
+		}
+	}
+
+	err := iden.state.Claims.InsertClaimDB(claims[0], nil)
+	if !errors.Is(err, db.ErrClaimExists) {
+		t.Errorf("saving the issued claim again returned %v, want %v", err, db.ErrClaimExists)
+	}
+}
+
+// TestIssuanceMeasuresSchemaLoad issues a claim, the load of its schema is recorded in the schema load duration
+func TestIssuanceMeasuresSchemaLoad(t *testing.T) {
+	iden := newTestIdentity(t)
+	loads := func() uint64 {
+		m := &dto.Metric{}
+		err := metrics.SchemaLoadDuration.WithLabelValues(metrics.ResultOK).(prometheus.Histogram).Write(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m.GetHistogram().GetSampleCount()
+	}
+
+	before := loads()
+	issueTestClaim(t, iden)
+	if after := loads(); after <= before {
+		t.Errorf("the schema load duration holds %d loads after the issuance, want more than %d", after, before)
+	}
+}
+
+// TestGetClaimStatusNotFound asks the status of a claim that isn't issued and of an invalid id, both aren't found
+func TestGetClaimStatusNotFound(t *testing.T) {
+	iden := newTestIdentity(t)
+
+	for _, id := range []string{uuid.New().String(), "not a claim id"} {
+		_, err := iden.GetClaimStatus(context.Background(), id)
+		if !errors.Is(err, ErrClaimNotFound) {
+			t.Errorf("the status of %q returned %v, want %v", id, err, ErrClaimNotFound)
+		}
+	}
+}
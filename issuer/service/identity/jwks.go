@@ -0,0 +1,56 @@
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	logger "github.com/sirupsen/logrus"
+	issuer_contract "issuer/service/models"
+	"math/big"
+)
+
+const (
+	jwkKeyType = "EC"
+	jwkCurve   = "BJJ"
+)
+
+// GetJWKS returns the public keys of the issuer as a JSON Web Key Set
+func (i *Identity) GetJWKS() *issuer_contract.JSONWebKeySet {
+	logger.Debug("GetJWKS() invoked")
+
+	return &issuer_contract.JSONWebKeySet{
+		Keys: []*issuer_contract.JSONWebKey{publicKeyToJWK(i.sk.Public())},
+	}
+}
+
+// KeyID returns the kid of the issuer's signing key
+func (i *Identity) KeyID() string {
+	return publicKeyToJWK(i.sk.Public()).Kid
+}
+
+func publicKeyToJWK(pk *babyjub.PublicKey) *issuer_contract.JSONWebKey {
+	jwk := &issuer_contract.JSONWebKey{
+		Kty: jwkKeyType,
+		Crv: jwkCurve,
+		Use: "sig",
+		X:   encodeCoordinate(pk.X),
+		Y:   encodeCoordinate(pk.Y),
+	}
+	jwk.Kid = jwkThumbprint(jwk)
+
+	return jwk
+}
+
+// jwkThumbprint computes the RFC 7638 thumbprint of the key, which is stable for as long as the key doesn't change
+func jwkThumbprint(jwk *issuer_contract.JSONWebKey) string {
+	canonical := fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s","y":"%s"}`, jwk.Crv, jwk.Kty, jwk.X, jwk.Y)
+	h := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+func encodeCoordinate(c *big.Int) string {
+	var b [32]byte
+	c.FillBytes(b[:])
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
@@ -0,0 +1,83 @@
+package identity
+
+import (
+	"github.com/google/uuid"
+	logger "github.com/sirupsen/logrus"
+	issuer_contract "issuer/service/models"
+)
+
+const (
+	// DefaultClaimsLimit is the number of claims listed when the caller doesn't ask for a number
+	DefaultClaimsLimit = 50
+	// MaxClaimsLimit is the maximum number of claims listed at once
+	MaxClaimsLimit = 500
+)
+
+// ListClaims returns the page of the issued claims that follows the claim after, the cursor of the next page and the
+// number of the claims there are. The claims are ordered by their id and a page starts past the last claim of the
+// previous one, so the claims issued in between don't shift the pages. A nil after gives the first page and an empty
+// cursor is returned with the last page. The auth claim of the identity is listed only with withAuthClaim.
+func (i *Identity) ListClaims(after *uuid.UUID, limit int, withAuthClaim bool) ([]*issuer_contract.GetClaimResponse, string, int, error) {
+	logger.Debugf("ListClaims() invoked after %v with limit %d", after, limit)
+
+	if limit <= 0 {
+		limit = DefaultClaimsLimit
+	}
+	if limit > MaxClaimsLimit {
+		limit = MaxClaimsLimit
+	}
+
+	var exclude []uuid.UUID
+	if !withAuthClaim {
+		exclude = append(exclude, i.authClaimID())
+	}
+
+	// one more claim tells whether there is a next page
+	claims, total, err := i.state.Claims.ListClaims(after, limit+1, exclude...)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	var next string
+	if len(claims) > limit {
+		claims = claims[:limit]
+		next = claims[limit-1].ID.String()
+	}
+
+	res := make([]*issuer_contract.GetClaimResponse, 0, len(claims))
+	for _, c := range claims {
+		cred, err := i.claimResponse(c)
+		if err != nil {
+			return nil, "", 0, err
+		}
+		res = append(res, cred)
+	}
+
+	return res, next, total, nil
+}
+
+// GetClaimsBySubject returns the claims issued to the subject, given by its DID or identifier. The claims of the
+// subject are looked up whatever the subject network policy is, and none is an empty result.
+func (i *Identity) GetClaimsBySubject(subjectID string) ([]*issuer_contract.GetClaimResponse, error) {
+	logger.Debugf("GetClaimsBySubject() invoked with subject %s", subjectID)
+
+	subject, err := subjectNetworks{}.resolveSubject(subjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := i.state.GetClaimsBySubject(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*issuer_contract.GetClaimResponse, 0, len(claims))
+	for _, c := range claims {
+		cred, err := i.claimResponse(c)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, cred)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,48 @@
+package identity
+
+import (
+	"github.com/google/uuid"
+	"testing"
+)
+
+// TestListClaimsIssuedBetweenPages issues claims while the pages are listed, every claim issued before the first
+// page is listed exactly once
+func TestListClaimsIssuedBetweenPages(t *testing.T) {
+	iden := newTestIdentity(t)
+	want := map[string]bool{}
+	for i := 0; i < 6; i++ {
+		want[issueTestClaim(t, iden).ID.String()] = true
+	}
+
+	listed := map[string]int{}
+	var after *uuid.UUID
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("the listing doesn't reach the last page")
+		}
+		claims, next, _, err := iden.ListClaims(after, 2, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range claims {
+			listed[c.ID]++
+		}
+		if next == "" {
+			break
+		}
+		id := uuid.MustParse(next)
+		after = &id
+		issueTestClaim(t, iden)
+	}
+
+	for id := range want {
+		if listed[id] != 1 {
+			t.Errorf("claim %s is listed %d times", id, listed[id])
+		}
+	}
+	for id, n := range listed {
+		if n > 1 {
+			t.Errorf("claim %s is listed %d times", id, n)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package identity
+
+import (
+	"fmt"
+	core "github.com/iden3/go-iden3-core"
+	"github.com/pkg/errors"
+	"issuer/service/cfgs"
+	"strings"
+)
+
+const (
+	// SubjectNetworkMatch rejects the subject DIDs of another network than the issuer's, unless the network is allowed
+	SubjectNetworkMatch = "match"
+	// SubjectNetworkStrict is SubjectNetworkMatch that also rejects the subjects giving no network
+	SubjectNetworkStrict = "strict"
+)
+
+// ErrSubjectNetwork is returned when the network of the subject DID isn't accepted by the subject network policy
+var ErrSubjectNetwork = errors.New("the network of the subject isn't accepted")
+
+// DIDType is the id type of the identities published on the network. The ids of go-iden3-core only tell the
+// published identities from the read-only ones, every network maps to the default type and the network is carried
+// by the DID.
+func DIDType(blockchain, network string) [2]byte {
+	return core.TypeDefault
+}
+
+// DID is the DID of the identifier on the network
+func DID(identifier *core.ID, blockchain, network string) string {
+	did := core.DID{
+		ID:         *identifier,
+		Blockchain: core.Blockchain(blockchain),
+		NetworkID:  core.NetworkID(network),
+	}
+	return did.String()
+}
+
+// subjectNetworks is the policy applied to the network of the subject DIDs
+type subjectNetworks struct {
+	policy  string
+	network string
+	// allowed are the networks accepted besides the issuer's, as <blockchain>:<network>
+	allowed map[string]bool
+}
+
+func newSubjectNetworks(cfg *cfgs.IssuerConfig) subjectNetworks {
+	n := subjectNetworks{
+		policy:  cfg.SubjectNetworkPolicy,
+		network: fmt.Sprintf("%s:%s", cfg.Blockchain, cfg.Network),
+		allowed: make(map[string]bool, len(cfg.AllowedSubjectNetworks)),
+	}
+	for _, a := range cfg.AllowedSubjectNetworks {
+		n.allowed[a] = true
+	}
+	return n
+}
+
+// resolveSubject returns the identifier of the subject given either as an identifier or as a DID, checking the
+// network of a DID against the policy
+func (n subjectNetworks) resolveSubject(subject string) (string, error) {
+	if !strings.HasPrefix(subject, core.DIDSchema+":") {
+		if n.policy == SubjectNetworkStrict {
+			return "", errors.Wrapf(ErrSubjectNetwork, "subject '%s' gives no network, expected a DID of %s", subject, n.network)
+		}
+		return subject, nil
+	}
+
+	parts := strings.Split(subject, ":")
+	if len(parts) == 3 {
+		// a read-only DID, its identity was never published on any network
+		if n.policy == SubjectNetworkStrict {
+			return "", errors.Wrapf(ErrSubjectNetwork, "subject '%s' gives no network, expected a DID of %s", subject, n.network)
+		}
+		id, err := core.IDFromString(parts[2])
+		if err != nil {
+			return "", err
+		}
+		return id.String(), nil
+	}
+
+	did, err := core.ParseDID(subject)
+	if err != nil {
+		return "", err
+	}
+
+	network := fmt.Sprintf("%s:%s", did.Blockchain, did.NetworkID)
+	if (n.policy == SubjectNetworkMatch || n.policy == SubjectNetworkStrict) && network != n.network && !n.allowed[network] {
+		return "", errors.Wrapf(ErrSubjectNetwork, "subject network %s, the issuer is on %s", network, n.network)
+	}
+
+	return did.ID.String(), nil
+}
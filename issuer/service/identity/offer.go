@@ -0,0 +1,70 @@
+package identity
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/google/uuid"
+	core "github.com/iden3/go-iden3-core"
+	"github.com/iden3/iden3comm/packers"
+	"github.com/iden3/iden3comm/protocol"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"issuer/db"
+)
+
+// offerLinkPrefix starts the universal links of the iden3comm messages, the wallets open them from a QR code too
+const offerLinkPrefix = "iden3comm://?i_m="
+
+// CredentialOffer is the iden3comm credential offer message of a claim, the wallet fetches the claim from the agent
+// endpoint of the issuer with the thread of the offer
+type CredentialOffer protocol.CredentialsOfferMessage
+
+// CreateCredentialOffer builds the message offering the claim to its subject. The claim has to be issued to a subject.
+func (i *Identity) CreateCredentialOffer(claimID string) (*CredentialOffer, error) {
+	logger.Debug("CreateCredentialOffer() invoked")
+
+	id, err := uuid.Parse(claimID)
+	if err != nil {
+		return nil, errors.Wrapf(ErrClaimNotFound, "invalid claim id '%s', %v", claimID, err)
+	}
+
+	c, err := i.state.Claims.GetClaim(id)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		return nil, errors.Wrapf(ErrClaimNotFound, "claim %s", claimID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.OtherIdentifier == "" {
+		return nil, errors.Wrapf(ErrInvalidSubject, "claim %s has no subject to offer it to", claimID)
+	}
+	subjectID, err := core.IDFromString(c.OtherIdentifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CredentialOffer{
+		ID:       uuid.NewString(),
+		Typ:      packers.MediaTypePlainMessage,
+		Type:     protocol.CredentialOfferMessageType,
+		ThreadID: uuid.NewString(),
+		Body: protocol.CredentialsOfferMessageBody{
+			URL: i.publicUrl + "/api/v1/agent",
+			Credentials: []protocol.CredentialOffer{
+				{ID: c.ID.String(), Description: c.SchemaType},
+			},
+		},
+		From: DID(i.Identifier(), i.blockchain, i.network),
+		To:   DID(&subjectID, "", ""),
+	}, nil
+}
+
+// QRPayload encodes the offer as the universal link the wallets open, from a QR code or as a deep link
+func (o *CredentialOffer) QRPayload() (string, error) {
+	msg, err := json.Marshal(o)
+	if err != nil {
+		return "", err
+	}
+
+	return offerLinkPrefix + base64.RawURLEncoding.EncodeToString(msg), nil
+}
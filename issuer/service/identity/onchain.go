@@ -0,0 +1,65 @@
+package identity
+
+import (
+	"context"
+	logger "github.com/sirupsen/logrus"
+	"io"
+	issuer_contract "issuer/service/models"
+)
+
+// VerifyOnChainState compares the latest and committed local states with the latest state of the identity on-chain.
+// A latest state that doesn't match for long points to a stuck publishing pipeline, a committed state that doesn't
+// match points to a publish the issuer considers done but the chain doesn't know about.
+func (i *Identity) VerifyOnChainState(ctx context.Context) (*issuer_contract.VerifyOnChainStateResponse, error) {
+	logger.Debug("VerifyOnChainState() invoked")
+
+	if i.stateStore == nil {
+		return nil, ErrPublishingDisabled
+	}
+
+	latestState, err := i.state.GetStateHash()
+	if err != nil {
+		return nil, err
+	}
+	committed := i.state.SnapshotCommittedState()
+	committedState, err := committed.State()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &issuer_contract.VerifyOnChainStateResponse{
+		Identifier:     i.Identifier().String(),
+		LatestState:    latestState.Hex(),
+		CommittedState: committedState.Hex(),
+	}
+
+	onChain, err := i.stateStore.GetLatestState(ctx, i.Identifier())
+	if err != nil {
+		return nil, err
+	}
+	if onChain == nil {
+		// never published, the identity is consistent as long as it's still in its genesis state
+		genesisState, err := i.state.GetGenesisState()
+		if err != nil {
+			return nil, err
+		}
+		res.Match = genesisState != nil && genesisState.Equals(latestState)
+		res.CommittedMatch = committed.IsLatestStateGenesis
+		return res, nil
+	}
+
+	res.OnChainState = onChain.State.Hex()
+	res.BlockNumber = onChain.BlockNumber
+	res.BlockTimestamp = onChain.BlockTimestamp
+	res.Match = onChain.State.Equals(latestState)
+	res.CommittedMatch = onChain.State.Equals(committedState)
+
+	return res, nil
+}
+
+// ExportTreeSnapshot writes the verifier facing snapshot of the identity state to w
+func (i *Identity) ExportTreeSnapshot(w io.Writer) error {
+	logger.Debug("ExportTreeSnapshot() invoked")
+
+	return i.state.ExportTreeSnapshot(w)
+}
@@ -0,0 +1,67 @@
+package identity
+
+import (
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"issuer/service/claim"
+	"time"
+)
+
+const (
+	// SingleActiveReject rejects a claim while the subject holds an active credential of the same type
+	SingleActiveReject = "reject"
+	// SingleActiveSupersede issues the claim and revokes the active credentials of the same type the subject holds
+	SingleActiveSupersede = "supersede"
+)
+
+// ErrActiveCredentialExists is returned when the single active credential policy of the type rejects a claim
+var ErrActiveCredentialExists = errors.New("subject already holds an active credential of this type")
+
+// activeCredentials returns the credentials of the type the subject holds that are neither revoked nor expired
+func (i *Identity) activeCredentials(subject, schemaType string) ([]*claim.Claim, error) {
+	claims, err := i.state.GetClaimsBySubject(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	active := make([]*claim.Claim, 0)
+	for _, c := range claims {
+		if c.SchemaType != schemaType || c.Revoked || (c.Expiration != 0 && c.Expiration <= now) {
+			continue
+		}
+		revoked, err := i.state.Revocations.IsRevoked(c.RevNonce)
+		if err != nil {
+			return nil, err
+		}
+		if !revoked {
+			active = append(active, c)
+		}
+	}
+
+	return active, nil
+}
+
+// checkSingleActive applies the single active credential policy of the type to a claim about to be issued to the
+// subject. It returns the credentials to revoke once the claim is issued.
+func (i *Identity) checkSingleActive(subject, schemaType string) ([]*claim.Claim, error) {
+	policy := i.singleActive[schemaType]
+	if policy == "" || subject == "" {
+		return nil, nil
+	}
+
+	active, err := i.activeCredentials(subject, schemaType)
+	if err != nil {
+		return nil, err
+	}
+	if len(active) == 0 {
+		return nil, nil
+	}
+
+	if policy == SingleActiveReject {
+		return nil, errors.Wrapf(ErrActiveCredentialExists, "credential %s of type %s", active[0].ID, schemaType)
+	}
+
+	logger.Infof("claim of type %s supersedes %d active credentials of subject %s", schemaType, len(active), subject)
+	return active, nil
+}
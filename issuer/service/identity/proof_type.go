@@ -0,0 +1,28 @@
+package identity
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	// ProofTypeSparseMerkleTree credentials are added to the claims tree, they get an MTP proof once the state is published
+	ProofTypeSparseMerkleTree = "SparseMerkleTreeProof"
+	// ProofTypeBJJSignature credentials are only signed with the auth claim key, they are valid without a state publish
+	ProofTypeBJJSignature = "BJJSignature"
+)
+
+// ErrUnsupportedProofType is returned when the claim request asks for an unknown proof type
+var ErrUnsupportedProofType = errors.New("unsupported proof type")
+
+// isSignatureOnly tells whether the requested proof type issues a signature-only credential
+func isSignatureOnly(proofType string) (bool, error) {
+	switch proofType {
+	case "", ProofTypeSparseMerkleTree:
+		return false, nil
+	case ProofTypeBJJSignature:
+		return true, nil
+	default:
+		return false, errors.Wrapf(ErrUnsupportedProofType, "'%s', expected %s or %s",
+			proofType, ProofTypeSparseMerkleTree, ProofTypeBJJSignature)
+	}
+}
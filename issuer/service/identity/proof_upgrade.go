@@ -0,0 +1,166 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"issuer/db"
+	httpclient "issuer/http"
+	"issuer/service/cfgs"
+	"issuer/service/identity/state"
+	"net/http"
+	"time"
+)
+
+// proofUpgradeCursor names the offset in the event stream up to which the issued claims were checked for an MTP proof
+const proofUpgradeCursor = "mtp_proof_upgrades"
+
+// proofUpgradeBatch is the number of events read at once while looking for the claims of a publish
+const proofUpgradeBatch = 500
+
+// ProofUpgradeNotification is posted to the webhook for every claim that can be fetched with an MTP proof
+type ProofUpgradeNotification struct {
+	ClaimID string `json:"claimId"`
+	Subject string `json:"subject,omitempty"`
+	// URL is the endpoint the credential is fetched from along with its MTP proof
+	URL   string `json:"url"`
+	State string `json:"state"`
+	TxID  string `json:"txId"`
+}
+
+// proofUpgrades notifies the holders of the claims issued before a publish that the MTP proofs of their claims
+// are available
+type proofUpgrades struct {
+	enabled    bool
+	webhookURL string
+	client     *httpclient.Client
+}
+
+func newProofUpgrades(cfg *cfgs.IssuerConfig) proofUpgrades {
+	return proofUpgrades{
+		enabled:    cfg.ProofUpgradeNotifications,
+		webhookURL: cfg.ProofUpgradeWebhookUrl,
+		client:     httpclient.NewClient(http.Client{Timeout: cfg.HTTPClientTimeout}),
+	}
+}
+
+// notifyProofUpgrades walks the claims issued since the last publish and, for those included in the newly committed
+// claims tree, appends an EventMTPProofAvailable event and posts a notification to the webhook. The walk stops at the
+// first claim the publish doesn't include, that claim and the ones after it are picked up by the next publish.
+func (i *Identity) notifyProofUpgrades(txID string) error {
+	if !i.proofUpgrades.enabled {
+		return nil
+	}
+	logger.Debugf("notifyProofUpgrades() invoked for transaction %s", txID)
+
+	since, err := i.state.GetCursor(proofUpgradeCursor)
+	if err != nil {
+		return err
+	}
+
+	view := i.state.ReadView()
+	committedState, err := view.Committed.State()
+	if err != nil {
+		return err
+	}
+
+	for {
+		events, err := i.state.GetEvents(since, proofUpgradeBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range events {
+			if e.Type == db.AuditEventClaimIssued {
+				included, notification, err := i.proofUpgrade(e.ClaimID, view)
+				if err != nil {
+					return err
+				}
+				if !included {
+					return i.state.SaveCursor(proofUpgradeCursor, since)
+				}
+				if notification == nil {
+					since = e.Offset
+					continue
+				}
+
+				notification.State = committedState.Hex()
+				notification.TxID = txID
+				err = i.state.AppendEvent(&db.Event{
+					Type:       db.EventMTPProofAvailable,
+					ClaimID:    e.ClaimID,
+					SchemaType: e.SchemaType,
+					RevNonce:   e.RevNonce,
+					Timestamp:  time.Now().Unix(),
+					TxID:       txID,
+				})
+				if err != nil {
+					return err
+				}
+				i.postProofUpgrade(notification)
+			}
+			since = e.Offset
+		}
+
+		if len(events) < proofUpgradeBatch {
+			return i.state.SaveCursor(proofUpgradeCursor, since)
+		}
+	}
+}
+
+// proofUpgrade tells whether the claim is in the claims tree of the view
+func (i *Identity) proofUpgrade(id string, view *state.ReadView) (bool, *ProofUpgradeNotification, error) {
+	claimID, err := uuid.Parse(id)
+	if err != nil {
+		return false, nil, err
+	}
+	claimModel, err := i.state.Claims.GetClaim(claimID)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		// the claim was discarded before it was published, there is nothing to notify
+		return true, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	if claimModel.SignatureOnly {
+		// the claim is proven by its signature alone, no publish upgrades it
+		return true, nil, nil
+	}
+
+	hIndex, err := claimModel.CoreClaim.HIndex()
+	if err != nil {
+		return false, nil, err
+	}
+	proof, err := view.ClaimProof(hIndex)
+	if err != nil {
+		return false, nil, err
+	}
+
+	return proof.Existence, &ProofUpgradeNotification{
+		ClaimID: id,
+		Subject: claimModel.OtherIdentifier,
+		URL:     fmt.Sprintf("%s/api/v1/claims/%s", i.publicUrl, id),
+	}, nil
+}
+
+// postProofUpgrade posts the notification to the webhook, a failed delivery is only logged since the event stream
+// keeps the notification
+func (i *Identity) postProofUpgrade(n *ProofUpgradeNotification) {
+	if i.proofUpgrades.webhookURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		logger.Errorf("can't encode the proof upgrade notification of claim %s, err: %v", n.ClaimID, err)
+		return
+	}
+
+	_, err = i.proofUpgrades.client.Post(context.Background(), i.proofUpgrades.webhookURL, body)
+	if err != nil {
+		logger.Warnf("can't deliver the proof upgrade notification of claim %s, err: %v", n.ClaimID, err)
+	}
+}
@@ -0,0 +1,107 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	// PublishModeQueue makes a publish wait for the one in flight to be confirmed
+	PublishModeQueue = "queue"
+	// PublishModeReject makes a publish fail with ErrPublishInProgress while another one is in flight
+	PublishModeReject = "reject"
+)
+
+// ErrPublishInProgress is returned in the reject publish mode when a publish is in flight
+var ErrPublishInProgress = errors.New("publish is in progress")
+
+// PublishInProgressError carries the hash of the in flight transaction, it's empty while the proof is being generated
+type PublishInProgressError struct {
+	TxHash string
+}
+
+func (e *PublishInProgressError) Error() string {
+	if e.TxHash == "" {
+		return fmt.Sprintf("%v, the transaction wasn't sent yet", ErrPublishInProgress)
+	}
+	return fmt.Sprintf("%v, transaction: %s", ErrPublishInProgress, e.TxHash)
+}
+
+func (e *PublishInProgressError) Is(target error) bool {
+	return target == ErrPublishInProgress
+}
+
+// publishGate lets a single publish be in flight, from the generation of its proof until its transaction is confirmed
+type publishGate struct {
+	mode string
+	slot chan struct{}
+
+	mu     sync.Mutex
+	txHash string
+}
+
+func newPublishGate(mode string) *publishGate {
+	return &publishGate{
+		mode: mode,
+		slot: make(chan struct{}, 1),
+	}
+}
+
+func (g *publishGate) enter(ctx context.Context) error {
+	if g.mode == PublishModeReject {
+		select {
+		case g.slot <- struct{}{}:
+			return nil
+		default:
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			return &PublishInProgressError{TxHash: g.txHash}
+		}
+	}
+
+	select {
+	case g.slot <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tryEnter takes the slot of the gate if no publish is in flight, whatever the mode of the gate
+func (g *publishGate) tryEnter() error {
+	select {
+	case g.slot <- struct{}{}:
+		return nil
+	default:
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return &PublishInProgressError{TxHash: g.txHash}
+	}
+}
+
+// drain takes the slot of the gate for good, waiting for the publish in flight to be confirmed
+func (g *publishGate) drain(ctx context.Context) error {
+	select {
+	case g.slot <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return fmt.Errorf("the publish of transaction '%s' wasn't confirmed, %w", g.txHash, ctx.Err())
+	}
+}
+
+func (g *publishGate) sent(txHash string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.txHash = txHash
+}
+
+func (g *publishGate) leave() {
+	g.mu.Lock()
+	g.txHash = ""
+	g.mu.Unlock()
+	<-g.slot
+}
@@ -4,16 +4,18 @@ import (
 	"context"
 	"github.com/iden3/go-circuits"
 	core "github.com/iden3/go-iden3-core"
-	"github.com/iden3/go-iden3-crypto/poseidon"
 	"github.com/iden3/go-merkletree-sql"
 	"github.com/iden3/go-rapidsnark/prover"
 	"github.com/iden3/go-rapidsnark/witness"
 	"github.com/pkg/errors"
 	logger "github.com/sirupsen/logrus"
+	"issuer/db"
 	"issuer/service/identity/state"
+	"issuer/service/logging"
+	"issuer/service/metrics"
 	"issuer/service/models"
 	"issuer/utils"
-	"math/big"
+	"time"
 )
 
 type TransitionInfoResponse struct {
@@ -28,81 +30,77 @@ type TransitionInfoRequest struct {
 	LatestState       *merkletree.Hash
 	NewState          *merkletree.Hash
 	Proof             *models.ZKProof
+	// newTreeState holds the roots of the proven new state, the roots of the trees at the confirmation are taken
+	// when it's nil
+	newTreeState *circuits.TreeState
 }
 
+// OnChainState is the latest state of an identity recorded in the state contract
+type OnChainState struct {
+	State          *merkletree.Hash
+	BlockNumber    uint64
+	BlockTimestamp uint64
+}
+
+// ErrPublishingDisabled is returned by the operations that need the blockchain when the issuer runs without one
+var ErrPublishingDisabled = errors.New("publishing is disabled")
+
+// ErrPublishJobNotFound is returned when polling a job that was never enqueued or whose status expired
+var ErrPublishJobNotFound = errors.New("state transition job not found")
+
+// PublishJobState is the step a queued state transition is at
+type PublishJobState string
+
+const (
+	PublishJobQueued  PublishJobState = "queued"
+	PublishJobSending PublishJobState = "sending"
+	PublishJobSent    PublishJobState = "sent"
+	PublishJobFailed  PublishJobState = "failed"
+)
+
+// PublishJobStatus is the outcome of a queued state transition, TxHash is set once it's sent and Error once it failed
+type PublishJobStatus struct {
+	State  PublishJobState
+	TxHash string
+	Error  string
+}
+
+// StateStore publishes the states of the identities on-chain, an identity given a nil one runs with publishing disabled
 type StateStore interface {
-	UpdateState(ctx context.Context, trInfo *TransitionInfoRequest) (string, error)
+	// Enqueue queues the state transition to be sent in the background and returns the id of its job, onSent is
+	// called with the hash of the sent transaction or with the error the job failed with
+	Enqueue(ctx context.Context, trInfo *TransitionInfoRequest, onSent func(txHex string, err error)) (string, error)
+	// PublishStatus returns the status of a job of Enqueue
+	PublishStatus(jobID string) (*PublishJobStatus, error)
 	WaitTransaction(ctx context.Context, txHex string) (*TransitionInfoResponse, error)
+	BuildStatePayload(trInfo *TransitionInfoRequest) ([]byte, error)
+	// GetLatestState returns nil if the contract has no state of the identity
+	GetLatestState(ctx context.Context, id *core.ID) (*OnChainState, error)
+	// Ping checks the blockchain node the states are published with is reachable
+	Ping(ctx context.Context) error
 }
 
 type Publisher struct {
 	i            *Identity
 	stateStore   StateStore
 	circuitsPath string
+	// onSent is called with the hash of the transaction once the job of Enqueue is sent
+	onSent func(txHex string)
+	// onDone is called once the transaction of the job of Enqueue is confirmed or failed
+	onDone func()
 }
 
 func (p *Publisher) PrepareInputs() ([]byte, error) {
-
-	// oldState
-	oldState, err := circuitsState(p.i.state.CommittedState)
-	if err != nil {
-		return nil, err
-	}
-
-	err = p.i.state.Roots.Tree.Add(context.Background(), oldState.ClaimsRoot.BigInt(), merkletree.HashZero.BigInt())
-	if err != nil {
-		return nil, err
-	}
-
-	newState, err := p.i.state.GetStateHash()
-	if err != nil {
-		return nil, err
-	}
-
-	authInclusionProof, _, err := p.i.state.GetInclusionProof(p.i.authClaim)
-	if err != nil {
-		return nil, err
-	}
-
-	authNonRevocationProof, _, err := p.i.state.GetRevocationProof(p.i.authClaim)
-	if err != nil {
-		return nil, err
-	}
-
-	authClaim := circuits.Claim{
-		Claim:     p.i.authClaim,
-		TreeState: oldState,
-		Proof:     authInclusionProof,
-		NonRevProof: &circuits.ClaimNonRevStatus{
-			TreeState: oldState,
-			Proof:     authNonRevocationProof,
-		},
-	}
-
-	hashOldAndNewStates, err := poseidon.Hash(
-		[]*big.Int{oldState.State.BigInt(), newState.BigInt()})
+	stateTransitionInputs, err := p.i.PrepareStateTransition()
 	if err != nil {
 		return nil, err
 	}
 
-	signature := p.i.sk.SignPoseidon(hashOldAndNewStates)
-
-	stateTransitionInputs := circuits.StateTransitionInputs{
-		ID:                p.i.Identifier,
-		NewState:          newState,
-		OldTreeState:      oldState,
-		IsOldStateGenesis: p.i.state.CommittedState.IsLatestStateGenesis,
-
-		AuthClaim: authClaim,
-
-		Signature: signature,
-	}
-
-	return stateTransitionInputs.InputsMarshal()
-
+	return stateTransitionInputs.JSON, nil
 }
 
 func (p *Publisher) GenerateProof(ctx context.Context, inputs []byte) (*models.FullProof, error) {
+	logging.FromContext(ctx).Debug("generating the state transition proof")
 
 	wasm, err := utils.ReadFileByPath(p.circuitsPath, "/stateTransition/circuit.wasm")
 	if err != nil {
@@ -145,31 +143,89 @@ func (p *Publisher) GenerateProof(ctx context.Context, inputs []byte) (*models.F
 	}, nil
 }
 
-func (p *Publisher) UpdateState(ctx context.Context, info *TransitionInfoRequest) (string, error) {
-	txHex, err := p.stateStore.UpdateState(ctx, info)
-	if err != nil {
-		return "", err
-	}
-	go func() {
-		tir, err := p.stateStore.WaitTransaction(context.Background(), txHex)
+// Enqueue queues the state transition to be sent by the state store and returns the id of its job. The transaction
+// is sent and confirmed after the caller returned.
+func (p *Publisher) Enqueue(ctx context.Context, info *TransitionInfoRequest) (string, error) {
+	// the transaction is sent and confirmed past the request, its logs keep the request ID
+	log := logging.FromContext(ctx)
+
+	jobID, err := p.stateStore.Enqueue(ctx, info, func(txHex string, err error) {
+		metrics.TransitionsSubmitted.WithLabelValues(metrics.Result(err)).Inc()
 		if err != nil {
-			logger.Printf("failed update state from '%s' to '%s'", info.LatestState, info.NewState)
+			log.Errorf("failed to send the update of the state from '%s' to '%s', err: %v", info.LatestState, info.NewState, err)
+			if p.onDone != nil {
+				p.onDone()
+			}
 			return
 		}
-		p.i.state.CommittedState = state.CommittedState{
-			Info: &state.Info{
-				TxId:           txHex,
-				BlockTimestamp: tir.BlockTimestamp,
-				BlockNumber:    tir.BlockNumber,
-			},
-
-			IsLatestStateGenesis: false,
-			RootsTreeRoot:        p.i.state.Roots.Tree.Root(),
-			ClaimsTreeRoot:       p.i.state.Claims.Tree.Root(),
-			RevocationTreeRoot:   p.i.state.Revocations.Tree.Root(),
+		if p.onSent != nil {
+			p.onSent(txHex)
+		}
+		go p.confirm(log, info, txHex, time.Now())
+	})
+	if err != nil {
+		metrics.TransitionsSubmitted.WithLabelValues(metrics.Result(err)).Inc()
+		return "", err
+	}
+
+	return jobID, nil
+}
+
+// confirm waits for the sent transaction to be confirmed, then records the transition and commits its state
+func (p *Publisher) confirm(log *logger.Entry, info *TransitionInfoRequest, txHex string, sentAt time.Time) {
+	if p.onDone != nil {
+		defer p.onDone()
+	}
+
+	tir, err := p.stateStore.WaitTransaction(context.Background(), txHex)
+	metrics.ObserveSince(metrics.TxConfirmationDuration, sentAt, err)
+	if err != nil {
+		log.Printf("failed update state from '%s' to '%s'", info.LatestState, info.NewState)
+		return
+	}
+	newTreeState := info.newTreeState
+	if newTreeState == nil {
+		newTreeState = &circuits.TreeState{
+			RootOfRoots:    p.i.state.Roots.Tree.Root(),
+			ClaimsRoot:     p.i.state.Claims.Tree.Root(),
+			RevocationRoot: p.i.state.Revocations.Tree.Root(),
 		}
-	}()
-	return txHex, err
+	}
+	err = p.i.state.RecordStateTransition(&db.StateTransition{
+		OldState:           info.LatestState.Hex(),
+		NewState:           info.NewState.Hex(),
+		TxID:               txHex,
+		BlockNumber:        tir.BlockNumber,
+		Timestamp:          int64(tir.BlockTimestamp),
+		ClaimsTreeRoot:     newTreeState.ClaimsRoot.Hex(),
+		RevocationTreeRoot: newTreeState.RevocationRoot.Hex(),
+		RootsTreeRoot:      newTreeState.RootOfRoots.Hex(),
+	})
+	if err != nil {
+		log.Errorf("state updated to '%s' but it can't be recorded as published, err: %v", info.NewState, err)
+		return
+	}
+	err = p.i.state.SetCommittedState(state.CommittedState{
+		Info: &state.Info{
+			TxId:           txHex,
+			BlockTimestamp: tir.BlockTimestamp,
+			BlockNumber:    tir.BlockNumber,
+		},
+
+		IsLatestStateGenesis: false,
+		RootsTreeRoot:        newTreeState.RootOfRoots,
+		ClaimsTreeRoot:       newTreeState.ClaimsRoot,
+		RevocationTreeRoot:   newTreeState.RevocationRoot,
+	})
+	if err != nil {
+		log.Errorf("state updated to '%s' but the committed state can't be set, err: %v", info.NewState, err)
+		return
+	}
+
+	err = p.i.notifyProofUpgrades(txHex)
+	if err != nil {
+		log.Errorf("can't notify the MTP proof upgrades of the state '%s', err: %v", info.NewState, err)
+	}
 }
 
 func circuitsState(s state.CommittedState) (circuits.TreeState, error) {
@@ -0,0 +1,45 @@
+package identity
+
+import (
+	logger "github.com/sirupsen/logrus"
+)
+
+// Reset wipes the identity and sets up a genesis state again, for starting fresh during development. The identity
+// keeps its key, but the new auth claim gives it a new identifier.
+func (i *Identity) Reset() error {
+	logger.Warn("Reset() invoked, deleting all the claims of the identity")
+
+	err := i.publishGate.tryEnter()
+	if err != nil {
+		return err
+	}
+	defer i.publishGate.leave()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	err = i.state.Reset()
+	if err != nil {
+		return err
+	}
+
+	i.transitionInputs.mu.Lock()
+	i.transitionInputs.inputs = nil
+	i.transitionInputs.mu.Unlock()
+
+	// the identifier, the auth claim and the handlers are swapped together, the requests read them through the
+	// accessors and never see a new identifier served by the old handlers
+	i.idMu.Lock()
+	err = i.init(nil)
+	if err != nil {
+		i.idMu.Unlock()
+		return err
+	}
+	i.commHandler = i.commHandler.WithIssuer(i.identifier.String())
+	i.cmdHandler = i.cmdHandler.WithIssuer(i.identifier)
+	identifier := i.identifier
+	i.idMu.Unlock()
+
+	logger.Infof("identity reset, new identifier: %s", identifier)
+	return nil
+}
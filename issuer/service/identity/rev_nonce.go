@@ -0,0 +1,62 @@
+package identity
+
+import (
+	"github.com/pkg/errors"
+	"issuer/db"
+	"issuer/service/claim"
+)
+
+// revNonceAttempts bounds the generated nonces tried for a claim, a collision is rare unless the nonces are small and
+// most of them are used
+const revNonceAttempts = 10
+
+// newRevNonceGenerator generates random revocation nonces of the given number of bits
+func newRevNonceGenerator(bits int) func() (uint64, error) {
+	return func() (uint64, error) {
+		return claim.RandBits(bits)
+	}
+}
+
+// revNonce returns the requested revocation nonce, rejecting it when another claim uses it, or generates an unused one
+// when the request gives none. A nonce that is in the revocation tree already is used too, it would issue a revoked
+// claim.
+func (i *Identity) revNonce(requested *uint64) (uint64, error) {
+	if requested != nil && *requested != 0 {
+		used, err := i.isRevNonceUsed(*requested)
+		if err != nil {
+			return 0, err
+		}
+		if used {
+			return 0, errors.Wrapf(db.ErrRevNonceInUse, "nonce %d", *requested)
+		}
+		return *requested, nil
+	}
+
+	for attempt := 0; attempt < revNonceAttempts; attempt++ {
+		nonce, err := i.revNonces()
+		if err != nil {
+			return 0, err
+		}
+		if nonce == 0 {
+			continue
+		}
+		used, err := i.isRevNonceUsed(nonce)
+		if err != nil {
+			return 0, err
+		}
+		if !used {
+			return nonce, nil
+		}
+	}
+
+	return 0, errors.Errorf("no unused revocation nonce was generated in %d attempts", revNonceAttempts)
+}
+
+func (i *Identity) isRevNonceUsed(nonce uint64) (bool, error) {
+	used, err := i.state.IsRevNonceUsed(nonce)
+	if err != nil || used {
+		return used, err
+	}
+
+	return i.state.Revocations.IsRevoked(nonce)
+}
@@ -0,0 +1,71 @@
+package identity
+
+import (
+	"fmt"
+	"github.com/iden3/go-merkletree-sql"
+	logger "github.com/sirupsen/logrus"
+	issuer_contract "issuer/service/models"
+	"sync"
+)
+
+// MaxRevocationBatchSize is the maximum number of nonces of a single batch revocation status request
+const MaxRevocationBatchSize = 1000
+
+// GetRevocationStatuses generates the revocation proofs of the nonces concurrently, by a bounded pool of workers.
+// The proofs are independent of each other, they are all generated against one read view of the committed state.
+func (i *Identity) GetRevocationStatuses(nonces []uint64, format HashFormat) (*issuer_contract.BatchRevocationStatusResponse, error) {
+	logger.Debugf("GetRevocationStatuses() invoked with %d nonces", len(nonces))
+
+	if len(nonces) > MaxRevocationBatchSize {
+		return nil, fmt.Errorf("a batch can hold at most %d nonces, got %d", MaxRevocationBatchSize, len(nonces))
+	}
+
+	view := i.state.ReadView()
+	committed := view.Committed
+
+	statuses := make([]*issuer_contract.NonceRevocationStatus, len(nonces))
+	errs := make([]error, len(nonces))
+
+	workers := i.revocationBatchWorkers
+	if workers > len(nonces) {
+		workers = len(nonces)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				var mtp *merkletree.Proof
+				mtp, errs[idx] = view.RevocationProof(nonces[idx])
+				statuses[idx] = &issuer_contract.NonceRevocationStatus{Nonce: nonces[idx], MTP: mtp}
+			}
+		}()
+	}
+	for idx := range nonces {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	for idx, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("can't generate revocation proof for nonce %d: %w", nonces[idx], err)
+		}
+	}
+
+	stateHash, err := committed.State()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &issuer_contract.BatchRevocationStatusResponse{Statuses: statuses}
+	res.Issuer.State = format.Format(stateHash)
+	res.Issuer.RevocationTreeRoot = format.Format(committed.RevocationTreeRoot)
+	res.Issuer.RootOfRoots = format.Format(committed.RootsTreeRoot)
+	res.Issuer.ClaimsTreeRoot = format.Format(committed.ClaimsTreeRoot)
+
+	return res, nil
+}
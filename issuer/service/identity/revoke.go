@@ -0,0 +1,91 @@
+package identity
+
+import (
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"issuer/db"
+	"issuer/service/claim"
+	"issuer/service/identity/state"
+	"issuer/service/metrics"
+	issuer_contract "issuer/service/models"
+)
+
+var (
+	// ErrClaimNotFound is returned when no issued claim has the id, or the revocation nonce
+	ErrClaimNotFound = errors.New("claim not found")
+	// ErrClaimAlreadyRevoked is returned when revoking a claim twice
+	ErrClaimAlreadyRevoked = errors.New("the claim is already revoked")
+)
+
+// RevokeClaim revokes the claim issued with the revocation nonce. The nonce is added to the latest revocation tree,
+// the revocation status served to the verifiers holds it once the state is published.
+func (i *Identity) RevokeClaim(nonce uint64) error {
+	logger.Debugf("RevokeClaim() invoked with nonce %d", nonce)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	c, err := i.state.Claims.GetClaimByRevNonce(nonce)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		return errors.Wrapf(ErrClaimNotFound, "no claim was issued with revocation nonce %d", nonce)
+	}
+	if err != nil {
+		return err
+	}
+	if c.ID == i.authClaimID() {
+		return errors.New("the auth claim of the identity can't be revoked")
+	}
+
+	revoked, err := i.state.Revocations.IsRevoked(nonce)
+	if err != nil {
+		return err
+	}
+	if c.Revoked || revoked {
+		return errors.Wrapf(ErrClaimAlreadyRevoked, "claim %s", c.ID)
+	}
+
+	return i.revokeClaim(c)
+}
+
+// revokeClaim revokes the claim in the latest state and records the revocation, it takes effect for verifiers
+// once the state is published
+func (i *Identity) revokeClaim(c *claim.Claim) error {
+	logger.Debugf("revokeClaim() invoked with claim %s", c.ID)
+
+	err := i.state.RevokeClaim(c)
+	if err != nil {
+		return err
+	}
+	metrics.ClaimsRevoked.Inc()
+
+	return nil
+}
+
+// ExportRevocations returns the revoked nonces of the latest revocation tree and its root, for mirroring the tree on
+// a reverse hash service. With a since root, only the nonces revoked after the tree had that root are returned, none
+// when it's still the root.
+func (i *Identity) ExportRevocations(sinceRoot string) ([]*issuer_contract.RevocationEntry, string, error) {
+	logger.Debugf("ExportRevocations() invoked since root '%s'", sinceRoot)
+
+	var since *merkletree.Hash
+	if sinceRoot != "" {
+		var err error
+		since, err = merkletree.NewHashFromHex(sinceRoot)
+		if err != nil {
+			return nil, "", errors.Wrapf(state.ErrUnknownRevocationRoot, "'%s' isn't a hex hash, %v", sinceRoot, err)
+		}
+	}
+
+	nonces, root, err := i.state.RevokedNoncesSince(since)
+	if err != nil {
+		return nil, "", err
+	}
+
+	entries := make([]*issuer_contract.RevocationEntry, 0, len(nonces))
+	for _, n := range nonces {
+		entries = append(entries, &issuer_contract.RevocationEntry{Nonce: n})
+	}
+
+	return entries, root.Hex(), nil
+}
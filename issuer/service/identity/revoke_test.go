@@ -0,0 +1,90 @@
+package identity
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"issuer/service/claim"
+	"testing"
+)
+
+// issueTestClaim issues a claim of testSchema to a new subject and returns it as saved
+func issueTestClaim(t *testing.T, iden *Identity) *claim.Claim {
+	t.Helper()
+
+	res, err := iden.CreateClaim(context.Background(), testClaimRequest(testSubject(t), 19960424))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := iden.state.Claims.GetClaim(uuid.MustParse(res.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRevokeClaim(t *testing.T) {
+	iden := newTestIdentity(t)
+	c := issueTestClaim(t, iden)
+
+	before, err := iden.state.GetStateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = iden.RevokeClaim(c.RevNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := iden.state.Revocations.IsRevoked(c.RevNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Errorf("nonce %d isn't in the revocation tree", c.RevNonce)
+	}
+	after, err := iden.state.GetStateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Equals(before) {
+		t.Error("the state didn't change with the revocation")
+	}
+}
+
+func TestRevokeClaimTwice(t *testing.T) {
+	iden := newTestIdentity(t)
+	c := issueTestClaim(t, iden)
+
+	err := iden.RevokeClaim(c.RevNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedState, err := iden.state.GetStateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = iden.RevokeClaim(c.RevNonce)
+	if !errors.Is(err, ErrClaimAlreadyRevoked) {
+		t.Fatalf("got %v revoking the claim twice, want %v", err, ErrClaimAlreadyRevoked)
+	}
+	st, err := iden.state.GetStateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Equals(revokedState) {
+		t.Error("the state changed with the second revocation")
+	}
+}
+
+func TestRevokeClaimUnknownNonce(t *testing.T) {
+	iden := newTestIdentity(t)
+	c := issueTestClaim(t, iden)
+
+	err := iden.RevokeClaim(c.RevNonce + 1)
+	if !errors.Is(err, ErrClaimNotFound) {
+		t.Fatalf("got %v revoking an unknown nonce, want %v", err, ErrClaimNotFound)
+	}
+}
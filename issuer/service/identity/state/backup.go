@@ -0,0 +1,375 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	core "github.com/iden3/go-iden3-core"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/go-merkletree-sql/db/memory"
+	logger "github.com/sirupsen/logrus"
+	"issuer/db"
+	"issuer/service/claim"
+)
+
+// Backup is the content of the identity state a backup restores. The claims tree is rebuilt from the claim rows,
+// the revocation and roots trees aren't derivable from them and are carried as their leaves.
+type Backup struct {
+	Claims *db.ClaimRows `json:"claims"`
+	// RevocationNonces are the leaves of the revocation tree
+	RevocationNonces []uint64 `json:"revocationNonces"`
+	// Roots are the claims tree roots of the roots tree, in hex
+	Roots []string `json:"roots"`
+	// State is the latest state the restored trees must compose
+	State string `json:"state"`
+	// Committed is empty in the backups taken before it was carried
+	Committed *BackupCommitted `json:"committed,omitempty"`
+}
+
+// BackupCommitted is the committed state of the backup along with the leaves its trees held, the trees are rebuilt
+// through it so the proofs against it can be generated once restored
+type BackupCommitted struct {
+	ClaimsTreeRoot       string `json:"claimsTreeRoot"`
+	RevocationTreeRoot   string `json:"revocationTreeRoot"`
+	RootsTreeRoot        string `json:"rootsTreeRoot"`
+	IsLatestStateGenesis bool   `json:"isLatestStateGenesis"`
+	TxID                 string `json:"txId,omitempty"`
+	BlockNumber          uint64 `json:"blockNumber,omitempty"`
+	BlockTimestamp       uint64 `json:"blockTimestamp,omitempty"`
+	// ClaimIndexes are the index hashes of the leaves of the committed claims tree, in hex
+	ClaimIndexes     []string `json:"claimIndexes"`
+	RevocationNonces []uint64 `json:"revocationNonces"`
+	Roots            []string `json:"roots"`
+}
+
+// Backup collects the claim rows and the leaves of the revocation and roots trees, consistent with the latest state,
+// and the leaves of the trees at the committed state
+func (is *IdentityState) Backup() (*Backup, error) {
+	logger.Debug("IdentityState.Backup() invoked")
+
+	is.treesMu.RLock()
+	defer is.treesMu.RUnlock()
+
+	rows, err := is.db.GetClaimRows()
+	if err != nil {
+		return nil, err
+	}
+	state, err := is.stateHash()
+	if err != nil {
+		return nil, err
+	}
+	b := &Backup{Claims: rows, State: state.Hex()}
+
+	b.RevocationNonces, err = nonceLeaves(is.Revocations.Tree, nil)
+	if err != nil {
+		return nil, err
+	}
+	b.Roots, err = hashLeaves(is.Roots.Tree, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	committed := is.SnapshotCommittedState()
+	if committed.ClaimsTreeRoot == nil {
+		return b, nil
+	}
+	b.Committed = &BackupCommitted{
+		ClaimsTreeRoot:       committed.ClaimsTreeRoot.Hex(),
+		RevocationTreeRoot:   committed.RevocationTreeRoot.Hex(),
+		RootsTreeRoot:        committed.RootsTreeRoot.Hex(),
+		IsLatestStateGenesis: committed.IsLatestStateGenesis,
+	}
+	if committed.Info != nil {
+		b.Committed.TxID = committed.Info.TxId
+		b.Committed.BlockNumber = committed.Info.BlockNumber
+		b.Committed.BlockTimestamp = committed.Info.BlockTimestamp
+	}
+	b.Committed.ClaimIndexes, err = hashLeaves(is.Claims.Tree, committed.ClaimsTreeRoot)
+	if err != nil {
+		return nil, err
+	}
+	b.Committed.RevocationNonces, err = nonceLeaves(is.Revocations.Tree, committed.RevocationTreeRoot)
+	if err != nil {
+		return nil, err
+	}
+	b.Committed.Roots, err = hashLeaves(is.Roots.Tree, committed.RootsTreeRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Restore writes the claim rows of the backup and the three trees rebuilt from them, along with the record of the
+// identity, in a single transaction. The state must be empty, and the rebuilt trees must compose the state of the
+// backup. The trees are rebuilt through the committed state of the backup first and it's set as the committed state.
+func (is *IdentityState) Restore(identifier *core.ID, record *db.IdentityRecord, b *Backup) error {
+	logger.Debug("IdentityState.Restore() invoked")
+
+	id, _, err := is.GetIdentityFromDB()
+	if err != nil {
+		return err
+	}
+	if id != nil || !is.IsGenesis() {
+		return errors.New("the state holds an identity already, a backup is restored into an empty state only")
+	}
+
+	claims, err := b.Claims.Decode()
+	if err != nil {
+		return err
+	}
+	trees, err := newRestoredTrees(is.depths)
+	if err != nil {
+		return err
+	}
+
+	var committed *CommittedState
+	inCommitted := make(map[string]bool)
+	if b.Committed != nil {
+		committed, err = b.Committed.committedState()
+		if err != nil {
+			return err
+		}
+		for _, hIndex := range b.Committed.ClaimIndexes {
+			inCommitted[hIndex] = true
+		}
+		err = trees.addClaims(claims, inCommitted, true)
+		if err != nil {
+			return err
+		}
+		err = trees.addLeaves(b.Committed.RevocationNonces, b.Committed.Roots)
+		if err != nil {
+			return err
+		}
+		if !trees.claims.Root().Equals(committed.ClaimsTreeRoot) ||
+			!trees.revocations.Root().Equals(committed.RevocationTreeRoot) ||
+			!trees.roots.Root().Equals(committed.RootsTreeRoot) {
+			return errors.New("the restored trees don't compose the committed state of the backup")
+		}
+	}
+	// the leaves the trees grew with after the committed state
+	err = trees.addClaims(claims, inCommitted, false)
+	if err != nil {
+		return err
+	}
+	err = trees.addLeaves(b.RevocationNonces, b.Roots)
+	if err != nil {
+		return err
+	}
+
+	state, err := merkletree.HashElems(trees.claims.Root().BigInt(), trees.revocations.Root().BigInt(), trees.roots.Root().BigInt())
+	if err != nil {
+		return err
+	}
+	if state.Hex() != b.State {
+		return errors.New("the restored trees don't compose the state of the backup")
+	}
+
+	nodes, err := trees.nodes(is.namespace)
+	if err != nil {
+		return err
+	}
+	record.TreeNamespace = is.namespace
+	err = is.db.RestoreIdentity(&db.IdentityRestore{
+		ID:        identifier.Bytes(),
+		Record:    record,
+		Primary:   is.identifier == nil,
+		Rows:      b.Claims,
+		TreeNodes: nodes,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the trees are opened again on the restored roots
+	is.treesMu.Lock()
+	err = is.openTrees()
+	is.treesMu.Unlock()
+	if err != nil {
+		return err
+	}
+	if committed == nil {
+		return nil
+	}
+	return is.SetCommittedState(*committed)
+}
+
+// committedState parses the committed roots of the backup
+func (c *BackupCommitted) committedState() (*CommittedState, error) {
+	claimsRoot, err := merkletree.NewHashFromHex(c.ClaimsTreeRoot)
+	if err != nil {
+		return nil, err
+	}
+	revocationRoot, err := merkletree.NewHashFromHex(c.RevocationTreeRoot)
+	if err != nil {
+		return nil, err
+	}
+	rootsRoot, err := merkletree.NewHashFromHex(c.RootsTreeRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &CommittedState{
+		IsLatestStateGenesis: c.IsLatestStateGenesis,
+		ClaimsTreeRoot:       claimsRoot,
+		RevocationTreeRoot:   revocationRoot,
+		RootsTreeRoot:        rootsRoot,
+	}
+	if c.TxID != "" {
+		cs.Info = &Info{TxId: c.TxID, BlockNumber: c.BlockNumber, BlockTimestamp: c.BlockTimestamp}
+	}
+	return cs, nil
+}
+
+// restoredTrees are the three trees of a restore, rebuilt in memory and written to the DB at once
+type restoredTrees struct {
+	storage     *memory.Storage
+	claims      *merkletree.MerkleTree
+	revocations *merkletree.MerkleTree
+	roots       *merkletree.MerkleTree
+}
+
+func newRestoredTrees(depths TreeDepths) (*restoredTrees, error) {
+	ctx := context.Background()
+	t := &restoredTrees{storage: memory.NewMemoryStorage()}
+
+	var err error
+	t.claims, err = merkletree.NewMerkleTree(ctx, t.storage.WithPrefix(claimsTreePrefix), depths.Claims)
+	if err != nil {
+		return nil, err
+	}
+	t.revocations, err = merkletree.NewMerkleTree(ctx, t.storage.WithPrefix(revocationsTreePrefix), depths.Revocations)
+	if err != nil {
+		return nil, err
+	}
+	t.roots, err = merkletree.NewMerkleTree(ctx, t.storage.WithPrefix(rootsTreePrefix), depths.Roots)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// addClaims inserts the claims in the committed claims tree, or with committed false the ones that weren't in it
+func (t *restoredTrees) addClaims(claims []*claim.Claim, inCommitted map[string]bool, committed bool) error {
+	for _, c := range claims {
+		if c.SignatureOnly {
+			continue
+		}
+		i, v, err := c.CoreClaim.HiHv()
+		if err != nil {
+			return err
+		}
+		hIndex, err := merkletree.NewHashFromBigInt(i)
+		if err != nil {
+			return err
+		}
+		if inCommitted[hIndex.Hex()] != committed {
+			continue
+		}
+		err = t.claims.Add(context.Background(), i, v)
+		if err != nil {
+			return wrapTreeErr(err)
+		}
+	}
+
+	return nil
+}
+
+// addLeaves inserts the revocation nonces and the roots, the ones in the trees already are skipped
+func (t *restoredTrees) addLeaves(nonces []uint64, roots []string) error {
+	ctx := context.Background()
+
+	for _, n := range nonces {
+		err := t.revocations.Add(ctx, new(big.Int).SetUint64(n), big.NewInt(0))
+		if err != nil && !errors.Is(err, merkletree.ErrEntryIndexAlreadyExists) {
+			return wrapTreeErr(err)
+		}
+	}
+	for _, r := range roots {
+		root, err := merkletree.NewHashFromHex(r)
+		if err != nil {
+			return err
+		}
+		err = t.roots.Add(ctx, root.BigInt(), merkletree.HashZero.BigInt())
+		if err != nil && !errors.Is(err, merkletree.ErrEntryIndexAlreadyExists) {
+			return wrapTreeErr(err)
+		}
+	}
+
+	return nil
+}
+
+// nodes returns the nodes of the trees and their roots as the bolt tree storage keeps them under the namespace,
+// which stores a root as its hex under the prefix of its tree
+func (t *restoredTrees) nodes(namespace []byte) (map[string][]byte, error) {
+	nodes := make(map[string][]byte)
+	err := t.storage.Iterate(context.Background(), func(k []byte, n *merkletree.Node) (bool, error) {
+		nodes[string(merkletree.Concat(namespace, k))] = n.Value()
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tree := range []struct {
+		prefix []byte
+		root   *merkletree.Hash
+	}{
+		{claimsTreePrefix, t.claims.Root()},
+		{revocationsTreePrefix, t.revocations.Root()},
+		{rootsTreePrefix, t.roots.Root()},
+	} {
+		nodes[string(merkletree.Concat(namespace, tree.prefix, []byte("root")))] = []byte(tree.root.Hex())
+	}
+
+	return nodes, nil
+}
+
+// treeLeaves returns the indexes of the leaves of the tree at the root, a nil root is the latest one
+func treeLeaves(tree *merkletree.MerkleTree, root *merkletree.Hash) ([]*big.Int, error) {
+	var leaves []*big.Int
+	err := tree.Walk(context.Background(), root, func(n *merkletree.Node) {
+		if n.Type == merkletree.NodeTypeLeaf {
+			leaves = append(leaves, n.Entry[0].BigInt())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return leaves, nil
+}
+
+// nonceLeaves returns the revocation nonces of the leaves of the tree at the root
+func nonceLeaves(tree *merkletree.MerkleTree, root *merkletree.Hash) ([]uint64, error) {
+	leaves, err := treeLeaves(tree, root)
+	if err != nil {
+		return nil, err
+	}
+
+	nonces := make([]uint64, 0, len(leaves))
+	for _, n := range leaves {
+		nonces = append(nonces, n.Uint64())
+	}
+	return nonces, nil
+}
+
+// hashLeaves returns the indexes of the leaves of the tree at the root as hashes in hex
+func hashLeaves(tree *merkletree.MerkleTree, root *merkletree.Hash) ([]string, error) {
+	leaves, err := treeLeaves(tree, root)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(leaves))
+	for _, l := range leaves {
+		h, err := merkletree.NewHashFromBigInt(l)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h.Hex())
+	}
+	return hashes, nil
+}
@@ -3,22 +3,28 @@ package state
 import (
 	"context"
 	store "github.com/demonsh/smt-bolt"
+	"github.com/google/uuid"
 	core "github.com/iden3/go-iden3-core"
 	"github.com/iden3/go-merkletree-sql"
 	logger "github.com/sirupsen/logrus"
 	"issuer/db"
 	"issuer/service/claim"
+	"math"
+	"time"
 )
 
 type Claims struct {
 	db   *db.DB
 	Tree *merkletree.MerkleTree
+	// issuer scopes the lookups to the claims of the identity, the claim rows are shared with the other tenants of
+	// the DB. It's empty until the identifier is known.
+	issuer string
 }
 
 func NewClaims(db *db.DB, treeStorage *store.BoltStore, treeDepth int) (*Claims, error) {
 	logger.Debug("creating new claims state")
 
-	claimTree, err := merkletree.NewMerkleTree(context.Background(), treeStorage.WithPrefix([]byte("claims")), treeDepth)
+	claimTree, err := merkletree.NewMerkleTree(context.Background(), treeStorage.WithPrefix(claimsTreePrefix), treeDepth)
 	if err != nil {
 		return nil, err
 	}
@@ -29,21 +35,56 @@ func NewClaims(db *db.DB, treeStorage *store.BoltStore, treeDepth int) (*Claims,
 	}, nil
 }
 
-func (c *Claims) GetClaim(id []byte) (*claim.Claim, error) {
-	logger.Debugf("GetClaim() invoked with id %x", id)
+func (c *Claims) GetClaim(id uuid.UUID) (*claim.Claim, error) {
+	logger.Debugf("GetClaim() invoked with id %s", id)
 
 	cl, err := c.db.GetClaim(id)
 	if err != nil {
 		return nil, err
 	}
+	if !c.owns(cl) {
+		return nil, db.ErrKeyNotFound
+	}
+
+	return cl, nil
+}
+
+func (c *Claims) GetClaimByRevNonce(nonce uint64) (*claim.Claim, error) {
+	logger.Debugf("GetClaimByRevNonce() invoked with nonce %d", nonce)
+
+	cl, err := c.db.GetClaimByRevNonce(nonce)
+	if err != nil {
+		return nil, err
+	}
+	if !c.owns(cl) {
+		return nil, db.ErrKeyNotFound
+	}
 
 	return cl, nil
 }
 
-func (c *Claims) SaveClaimDB(claim *claim.Claim) error {
+func (c *Claims) ListClaims(after *uuid.UUID, limit int, exclude ...uuid.UUID) ([]*claim.Claim, int, error) {
+	logger.Debugf("ListClaims() invoked after %v with limit %d", after, limit)
+
+	return c.db.ListClaims(c.issuer, after, limit, exclude...)
+}
+
+// owns tells whether the claim was issued by the identity
+func (c *Claims) owns(cl *claim.Claim) bool {
+	return c.issuer == "" || cl.Issuer == c.issuer
+}
+
+func (c *Claims) SaveClaimDB(claim *claim.Claim, audit *db.Audit) error {
 	logger.Debugf("SaveClaimDB() invoked with claim %v", claim)
 
-	return c.db.SaveClaim(claim)
+	return c.db.SaveClaim(claim, audit)
+}
+
+// InsertClaimDB saves a newly issued claim, db.ErrClaimExists is returned when a claim with its id is saved already
+func (c *Claims) InsertClaimDB(claim *claim.Claim, audit *db.Audit) error {
+	logger.Debugf("InsertClaimDB() invoked with claim %v", claim)
+
+	return c.db.InsertClaim(claim, audit)
 }
 
 func (c *Claims) SaveClaimMT(claim *core.Claim) error {
@@ -54,5 +95,57 @@ func (c *Claims) SaveClaimMT(claim *core.Claim) error {
 		return err
 	}
 
-	return c.Tree.Add(context.Background(), i, v)
+	err = c.Tree.Add(context.Background(), i, v)
+	if err != nil {
+		return wrapTreeErr(err)
+	}
+
+	warnOnTreeDepth(c.Tree, "claims", i)
+	return nil
+}
+
+// RemoveClaimMT deletes the claim from the tree, undoing a SaveClaimMT of a claim that was never handed out
+func (c *Claims) RemoveClaimMT(claim *core.Claim) error {
+	logger.Debugf("RemoveClaimMT() invoked with claim %v", claim)
+
+	i, err := claim.HIndex()
+	if err != nil {
+		return err
+	}
+
+	return c.Tree.Delete(context.Background(), i)
+}
+
+// ArchiveClaims moves the rows of the claims that expired before the given time and were revoked to the
+// archive, the claims stay in the tree and can still be fetched by id. The claims are picked before the rows are
+// moved, the revocation tree is read in its own transactions and those can't be opened within the one moving the rows.
+func (c *Claims) ArchiveClaims(expiredBefore time.Time, revs *Revocations) (int, error) {
+	logger.Debugf("ArchiveClaims() invoked with expiredBefore %v", expiredBefore)
+
+	claims, _, err := c.db.ListClaims(c.issuer, nil, math.MaxInt)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []uuid.UUID
+	for _, cl := range claims {
+		if cl.Expiration == 0 || cl.Expiration >= expiredBefore.Unix() {
+			continue
+		}
+		revoked := cl.Revoked
+		if !revoked {
+			revoked, err = revs.IsRevoked(cl.RevNonce)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if revoked {
+			ids = append(ids, cl.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	return c.db.ArchiveClaims(ids)
 }
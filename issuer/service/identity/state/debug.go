@@ -0,0 +1,67 @@
+package state
+
+import (
+	"context"
+
+	core "github.com/iden3/go-iden3-core"
+	"github.com/iden3/go-merkletree-sql"
+	logger "github.com/sirupsen/logrus"
+	"math/big"
+)
+
+// ClaimDebug is the raw state around a claim, as seen at a single point in time
+type ClaimDebug struct {
+	LatestState          *merkletree.Hash
+	LatestClaimsRoot     *merkletree.Hash
+	LatestRevocationRoot *merkletree.Hash
+	LatestRootsRoot      *merkletree.Hash
+	Committed            CommittedState
+
+	// InclusionProof and RevocationProof are generated against the latest trees,
+	// CommittedInclusionProof and CommittedRevocationProof against the committed ones
+	InclusionProof           *merkletree.Proof
+	RevocationProof          *merkletree.Proof
+	CommittedInclusionProof  *merkletree.Proof
+	CommittedRevocationProof *merkletree.Proof
+}
+
+// DebugClaim collects the roots of the latest and committed trees and the proofs of the claim in both, under the read
+// lock of the trees so that no insertion happens halfway through
+func (is *IdentityState) DebugClaim(c *core.Claim, revNonce uint64) (*ClaimDebug, error) {
+	logger.Debug("IdentityState.DebugClaim() invoked")
+
+	hIndex, err := c.HIndex()
+	if err != nil {
+		return nil, err
+	}
+	nonce := new(big.Int).SetUint64(revNonce)
+
+	is.treesMu.RLock()
+	defer is.treesMu.RUnlock()
+
+	d := &ClaimDebug{
+		LatestClaimsRoot:     is.Claims.Tree.Root(),
+		LatestRevocationRoot: is.Revocations.Tree.Root(),
+		LatestRootsRoot:      is.Roots.Tree.Root(),
+		Committed:            is.SnapshotCommittedState(),
+	}
+	if d.LatestState, err = is.stateHash(); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if d.InclusionProof, _, err = is.Claims.Tree.GenerateProof(ctx, hIndex, d.LatestClaimsRoot); err != nil {
+		return nil, err
+	}
+	if d.RevocationProof, _, err = is.Revocations.Tree.GenerateProof(ctx, nonce, d.LatestRevocationRoot); err != nil {
+		return nil, err
+	}
+	if d.CommittedInclusionProof, _, err = is.Claims.Tree.GenerateProof(ctx, hIndex, d.Committed.ClaimsTreeRoot); err != nil {
+		return nil, err
+	}
+	if d.CommittedRevocationProof, _, err = is.Revocations.Tree.GenerateProof(ctx, nonce, d.Committed.RevocationTreeRoot); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
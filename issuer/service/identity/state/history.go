@@ -0,0 +1,111 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/iden3/go-merkletree-sql"
+	logger "github.com/sirupsen/logrus"
+)
+
+// ErrUnknownState is returned when the proofs are asked at a state the identity never had, or at a published state
+// whose roots weren't recorded
+var ErrUnknownState = errors.New("unknown identity state")
+
+// StateRoots returns the roots of the trees at the given state of the identity: the latest or the committed one,
+// a published one or the genesis state. The nodes of the past roots are kept in the tree storage, so the proofs can
+// be generated against the returned roots once the trees grew.
+func (is *IdentityState) StateRoots(st *merkletree.Hash) (CommittedState, error) {
+	logger.Debugf("IdentityState.StateRoots() invoked with state %s", st.Hex())
+
+	committed := is.SnapshotCommittedState()
+	// the committed state isn't set yet while the identity is loaded
+	if committed.ClaimsTreeRoot != nil {
+		if s, err := committed.State(); err == nil && s.Equals(st) {
+			return committed, nil
+		}
+	}
+
+	is.treesMu.RLock()
+	latest := CommittedState{
+		RootsTreeRoot:      is.Roots.Tree.Root(),
+		ClaimsTreeRoot:     is.Claims.Tree.Root(),
+		RevocationTreeRoot: is.Revocations.Tree.Root(),
+	}
+	is.treesMu.RUnlock()
+	if s, err := latest.State(); err == nil && s.Equals(st) {
+		return latest, nil
+	}
+
+	_, record, err := is.savedIdentity()
+	if err != nil {
+		return CommittedState{}, err
+	}
+	if record == nil {
+		return CommittedState{}, fmt.Errorf("%w: %s", ErrUnknownState, st.Hex())
+	}
+
+	for _, t := range record.Transitions {
+		if t.NewState != st.Hex() {
+			continue
+		}
+		if t.ClaimsTreeRoot == "" {
+			// published before the roots were recorded along with the transitions
+			return CommittedState{}, fmt.Errorf("%w: the roots of the published state %s weren't recorded", ErrUnknownState, st.Hex())
+		}
+		return transitionRoots(t.TxID, t.BlockNumber, t.Timestamp, t.ClaimsTreeRoot, t.RevocationTreeRoot, t.RootsTreeRoot)
+	}
+
+	if record.GenesisState == st.Hex() {
+		return is.genesisRoots(record.AuthClaimID)
+	}
+
+	return CommittedState{}, fmt.Errorf("%w: %s", ErrUnknownState, st.Hex())
+}
+
+func transitionRoots(txID string, blockNumber uint64, timestamp int64, claimsRoot, revocationRoot, rootsRoot string) (CommittedState, error) {
+	claims, err := merkletree.NewHashFromHex(claimsRoot)
+	if err != nil {
+		return CommittedState{}, err
+	}
+	revs, err := merkletree.NewHashFromHex(revocationRoot)
+	if err != nil {
+		return CommittedState{}, err
+	}
+	roots, err := merkletree.NewHashFromHex(rootsRoot)
+	if err != nil {
+		return CommittedState{}, err
+	}
+
+	return CommittedState{
+		Info:               &Info{TxId: txID, BlockNumber: blockNumber, BlockTimestamp: uint64(timestamp)},
+		ClaimsTreeRoot:     claims,
+		RevocationTreeRoot: revs,
+		RootsTreeRoot:      roots,
+	}, nil
+}
+
+// genesisRoots gives the roots of the genesis state, its claims tree holds only the auth claim
+func (is *IdentityState) genesisRoots(authClaimID string) (CommittedState, error) {
+	id, err := uuid.Parse(authClaimID)
+	if err != nil {
+		return CommittedState{}, err
+	}
+	authClaim, err := is.Claims.GetClaim(id)
+	if err != nil {
+		return CommittedState{}, err
+	}
+
+	claimsRoot, err := genesisClaimsRoot(context.Background(), authClaim.CoreClaim, is.depths.Claims)
+	if err != nil {
+		return CommittedState{}, err
+	}
+
+	return CommittedState{
+		IsLatestStateGenesis: true,
+		ClaimsTreeRoot:       claimsRoot,
+		RevocationTreeRoot:   &merkletree.HashZero,
+		RootsTreeRoot:        &merkletree.HashZero,
+	}, nil
+}
@@ -0,0 +1,44 @@
+package state
+
+import (
+	core "github.com/iden3/go-iden3-core"
+	logger "github.com/sirupsen/logrus"
+	"issuer/db"
+)
+
+// OpenIdentityState opens the state of the single identity saved in the DB, on the trees in the namespace saved with
+// it. The trees of an identity saved before they were namespaced are moved from the root of the tree storage into
+// the namespace of its identifier first. It returns a nil state when the DB holds no identity yet.
+func OpenIdentityState(db *db.DB, depths TreeDepths) (*IdentityState, error) {
+	logger.Debug("opening the identity state")
+
+	id, record, err := db.GetSavedIdentity()
+	if err != nil {
+		return nil, err
+	}
+	if id == nil {
+		return nil, nil
+	}
+	// the tenants added to the DB later mustn't be taken for the single identity
+	err = db.SetPrimaryIdentity(id)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := record.TreeNamespace
+	if len(namespace) == 0 {
+		identifier, err := core.IDFromBytes(id)
+		if err != nil {
+			return nil, err
+		}
+		namespace = TreeNamespace(&identifier)
+
+		logger.Infof("migrating the trees of identity %s into its namespace", identifier)
+		err = db.MoveTreesToNamespace(id, [][]byte{claimsTreePrefix, revocationsTreePrefix, rootsTreePrefix}, namespace)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewIdentityState(db, namespace, depths)
+}
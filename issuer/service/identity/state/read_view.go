@@ -0,0 +1,57 @@
+package state
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/iden3/go-merkletree-sql"
+	logger "github.com/sirupsen/logrus"
+)
+
+// ReadView is an immutable view of the committed state that the read endpoints answer from. Its trees are read-only
+// copies pinned to the committed roots, so proofs generated from them never observe the insertions of the write path.
+// The claim rows don't need a view of their own: every DB read runs in a bolt read transaction, which already sees
+// a consistent snapshot without blocking the writer. Holding one read transaction open between publishes instead
+// would keep bolt from growing its memory map and stall the writes.
+type ReadView struct {
+	Committed CommittedState
+
+	claims      *merkletree.MerkleTree
+	revocations *merkletree.MerkleTree
+}
+
+// newReadView pins read-only copies of the claims and revocation trees to the roots of the committed state
+func (is *IdentityState) newReadView(cs CommittedState) (*ReadView, error) {
+	ctx := context.Background()
+
+	claims, err := is.Claims.Tree.Snapshot(ctx, cs.ClaimsTreeRoot)
+	if err != nil {
+		return nil, err
+	}
+	revs, err := is.Revocations.Tree.Snapshot(ctx, cs.RevocationTreeRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReadView{Committed: cs, claims: claims, revocations: revs}, nil
+}
+
+// ReadView returns the view of the latest committed state, nil until the committed state is set
+func (is *IdentityState) ReadView() *ReadView {
+	v, _ := is.readView.Load().(*ReadView)
+	return v
+}
+
+// ClaimProof generates the proof of existence (or non-existence) of the claim index in the committed claims tree
+func (v *ReadView) ClaimProof(hIndex *big.Int) (*merkletree.Proof, error) {
+	proof, _, err := v.claims.GenerateProof(context.Background(), hIndex, nil)
+	return proof, err
+}
+
+// RevocationProof generates the proof of existence (or non-existence) of the nonce in the committed revocation tree
+func (v *ReadView) RevocationProof(nonce uint64) (*merkletree.Proof, error) {
+	logger.Debugf("ReadView.RevocationProof() invoked with nonce of %d", nonce)
+
+	proof, _, err := v.revocations.GenerateProof(context.Background(), new(big.Int).SetUint64(nonce), nil)
+	return proof, err
+}
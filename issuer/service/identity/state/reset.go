@@ -0,0 +1,49 @@
+package state
+
+import (
+	"errors"
+
+	"github.com/iden3/go-merkletree-sql"
+	logger "github.com/sirupsen/logrus"
+)
+
+// Reset deletes the claims, the three trees and the identity record, leaving the state as empty as a new DB.
+// The trees are reopened empty and the committed state is cleared, a new genesis state has to be set up after.
+func (is *IdentityState) Reset() error {
+	logger.Debug("IdentityState.Reset() invoked")
+
+	if is.identifier != nil {
+		return errors.New("the state of a tenant can't be reset, the claims of the DB are shared with the other tenants")
+	}
+	ids, err := is.db.ListIdentities()
+	if err != nil {
+		return err
+	}
+	if len(ids) > 1 {
+		return errors.New("the DB holds tenant identities, a reset would wipe them")
+	}
+
+	is.treesMu.Lock()
+	defer is.treesMu.Unlock()
+	is.committedMu.Lock()
+	defer is.committedMu.Unlock()
+
+	prefixes := [][]byte{
+		merkletree.Concat(is.namespace, claimsTreePrefix),
+		merkletree.Concat(is.namespace, revocationsTreePrefix),
+		merkletree.Concat(is.namespace, rootsTreePrefix),
+	}
+	err = is.db.Reset(prefixes)
+	if err != nil {
+		return err
+	}
+
+	err = is.openTrees()
+	if err != nil {
+		return err
+	}
+	is.CommittedState = CommittedState{}
+	is.readView.Store((*ReadView)(nil))
+
+	return nil
+}
@@ -2,6 +2,7 @@ package state
 
 import (
 	"context"
+	"errors"
 	"math/big"
 
 	store "github.com/demonsh/smt-bolt"
@@ -16,7 +17,7 @@ type Revocations struct {
 func NewRevocations(treeStorage *store.BoltStore, treeDepth int) (*Revocations, error) {
 	logger.Debug("creating new revocations state")
 
-	revsTree, err := merkletree.NewMerkleTree(context.Background(), treeStorage.WithPrefix([]byte("revocation")), treeDepth)
+	revsTree, err := merkletree.NewMerkleTree(context.Background(), treeStorage.WithPrefix(revocationsTreePrefix), treeDepth)
 	if err != nil {
 		return nil, err
 	}
@@ -34,3 +35,35 @@ func (r *Revocations) GenerateRevocationProof(nonce *big.Int, root *merkletree.H
 	proof, _, err := r.Tree.GenerateProof(context.Background(), nonce, root)
 	return proof, err
 }
+
+// IsRevoked reports whether the nonce was added to the latest RevocationTree, published or not
+func (r *Revocations) IsRevoked(nonce uint64) (bool, error) {
+	logger.Debugf("IsRevoked() invoked with nonce of %d", nonce)
+
+	_, _, _, err := r.Tree.Get(context.Background(), new(big.Int).SetUint64(nonce))
+	if err == merkletree.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Revoke adds the nonce to the RevocationTree, revoking a nonce twice is a no-op
+func (r *Revocations) Revoke(nonce uint64) error {
+	logger.Debugf("Revoke() invoked with nonce of %d", nonce)
+
+	k := new(big.Int).SetUint64(nonce)
+	err := r.Tree.Add(context.Background(), k, big.NewInt(0))
+	if errors.Is(err, merkletree.ErrEntryIndexAlreadyExists) {
+		return nil
+	}
+	if err != nil {
+		return wrapTreeErr(err)
+	}
+	warnOnTreeDepth(r.Tree, "revocations", k)
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/iden3/go-merkletree-sql"
+	logger "github.com/sirupsen/logrus"
+	"sort"
+)
+
+// ErrUnknownRevocationRoot is returned when exporting the revocations since a root the revocation tree never had
+var ErrUnknownRevocationRoot = errors.New("unknown revocation tree root")
+
+// RevokedNoncesSince returns the nonces of the latest revocation tree, in increasing order, along with its root.
+// With a since root, only the nonces added after the tree had that root are returned: the subtrees the since tree
+// shares with the latest one are skipped, the nodes of the past roots are kept in the tree storage.
+func (is *IdentityState) RevokedNoncesSince(since *merkletree.Hash) ([]uint64, *merkletree.Hash, error) {
+	logger.Debug("IdentityState.RevokedNoncesSince() invoked")
+
+	is.treesMu.RLock()
+	defer is.treesMu.RUnlock()
+
+	ctx := context.Background()
+	tree := is.Revocations.Tree
+	root := tree.Root()
+	if since != nil && since.Equals(root) {
+		return []uint64{}, root, nil
+	}
+
+	known := make(map[merkletree.Hash]bool)
+	if since != nil {
+		err := tree.Walk(ctx, since, func(n *merkletree.Node) {
+			if k, err := n.Key(); err == nil {
+				known[*k] = true
+			}
+		})
+		if errors.Is(err, merkletree.ErrNotFound) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrUnknownRevocationRoot, since.Hex())
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	nonces := make([]uint64, 0)
+	err := collectNonces(ctx, tree, root, known, &nonces)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(nonces, func(a, b int) bool { return nonces[a] < nonces[b] })
+
+	return nonces, root, nil
+}
+
+// collectNonces appends the nonces of the leaves under the node, skipping the known nodes
+func collectNonces(ctx context.Context, tree *merkletree.MerkleTree, key *merkletree.Hash,
+	known map[merkletree.Hash]bool, nonces *[]uint64) error {
+	if known[*key] {
+		return nil
+	}
+
+	n, err := tree.GetNode(ctx, key)
+	if err != nil {
+		return err
+	}
+	switch n.Type {
+	case merkletree.NodeTypeLeaf:
+		*nonces = append(*nonces, n.Entry[0].BigInt().Uint64())
+	case merkletree.NodeTypeMiddle:
+		err = collectNonces(ctx, tree, n.ChildL, known, nonces)
+		if err != nil {
+			return err
+		}
+		return collectNonces(ctx, tree, n.ChildR, known, nonces)
+	}
+
+	return nil
+}
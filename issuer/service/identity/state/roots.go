@@ -14,7 +14,7 @@ type Roots struct {
 func NewRoots(treeStorage *store.BoltStore, treeDepth int) (*Roots, error) {
 	logger.Debug("creating new roots state")
 	
-	roots, err := merkletree.NewMerkleTree(context.Background(), treeStorage.WithPrefix([]byte("ror")), treeDepth)
+	roots, err := merkletree.NewMerkleTree(context.Background(), treeStorage.WithPrefix(rootsTreePrefix), treeDepth)
 	if err != nil {
 		return nil, err
 	}
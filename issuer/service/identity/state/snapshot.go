@@ -0,0 +1,110 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/iden3/go-merkletree-sql"
+	logger "github.com/sirupsen/logrus"
+)
+
+// SnapshotNode is a non empty node of a merkle tree. The key of a middle node is the hash of its children,
+// the key of a leaf node is the hash of its index, value and 1.
+type SnapshotNode struct {
+	Key    string `json:"key"`
+	Type   string `json:"type"`
+	ChildL string `json:"childL,omitempty"`
+	ChildR string `json:"childR,omitempty"`
+	Index  string `json:"index,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+// TreeSnapshot is the node set of a merkle tree under its root
+type TreeSnapshot struct {
+	Root  string         `json:"root"`
+	Nodes []SnapshotNode `json:"nodes"`
+}
+
+// Snapshot is the verifier facing snapshot of the identity state: re-hashing the nodes of each tree gives its root
+// and hashing the claims, revocations and roots tree roots gives the state
+type Snapshot struct {
+	State          string       `json:"state"`
+	ClaimsTree     TreeSnapshot `json:"claimsTree"`
+	RevocationTree TreeSnapshot `json:"revocationTree"`
+	RootsTree      TreeSnapshot `json:"rootsTree"`
+	// Publish is the last on-chain publish of the identity, nil if the identity was never published
+	Publish   *Info     `json:"publish,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ExportTreeSnapshot writes a JSON snapshot of the latest state and the nodes of all three trees to w. The roots are
+// taken first and the trees are walked from them, so insertions made during the export don't leak in the snapshot.
+func (is *IdentityState) ExportTreeSnapshot(w io.Writer) error {
+	logger.Debug("IdentityState.ExportTreeSnapshot() invoked")
+
+	claimsRoot, revsRoot, rootsRoot := is.Claims.Tree.Root(), is.Revocations.Tree.Root(), is.Roots.Tree.Root()
+	state, err := merkletree.HashElems(claimsRoot.BigInt(), revsRoot.BigInt(), rootsRoot.BigInt())
+	if err != nil {
+		return err
+	}
+
+	snapshot := Snapshot{
+		State:     state.Hex(),
+		CreatedAt: time.Now().UTC(),
+	}
+	if snapshot.ClaimsTree, err = snapshotTree(is.Claims.Tree, claimsRoot); err != nil {
+		return err
+	}
+	if snapshot.RevocationTree, err = snapshotTree(is.Revocations.Tree, revsRoot); err != nil {
+		return err
+	}
+	if snapshot.RootsTree, err = snapshotTree(is.Roots.Tree, rootsRoot); err != nil {
+		return err
+	}
+
+	committed := is.SnapshotCommittedState()
+	if committed.Info != nil && committed.Info.TxId != "" {
+		info := *committed.Info
+		snapshot.Publish = &info
+	}
+
+	return json.NewEncoder(w).Encode(snapshot)
+}
+
+// snapshotTree collects the non empty nodes of the tree under the root
+func snapshotTree(tree *merkletree.MerkleTree, root *merkletree.Hash) (TreeSnapshot, error) {
+	ts := TreeSnapshot{Root: root.Hex(), Nodes: make([]SnapshotNode, 0)}
+
+	var walkErr error
+	err := tree.Walk(context.Background(), root, func(n *merkletree.Node) {
+		if walkErr != nil || n.Type == merkletree.NodeTypeEmpty {
+			return
+		}
+
+		k, err := n.Key()
+		if err != nil {
+			walkErr = err
+			return
+		}
+
+		sn := SnapshotNode{Key: k.Hex()}
+		switch n.Type {
+		case merkletree.NodeTypeMiddle:
+			sn.Type = "middle"
+			sn.ChildL = n.ChildL.Hex()
+			sn.ChildR = n.ChildR.Hex()
+		case merkletree.NodeTypeLeaf:
+			sn.Type = "leaf"
+			sn.Index = n.Entry[0].Hex()
+			sn.Value = n.Entry[1].Hex()
+		}
+		ts.Nodes = append(ts.Nodes, sn)
+	})
+	if err != nil {
+		return ts, err
+	}
+
+	return ts, walkErr
+}
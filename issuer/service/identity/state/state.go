@@ -3,17 +3,22 @@ package state
 import (
 	"context"
 	"errors"
+	"fmt"
 	store "github.com/demonsh/smt-bolt"
 	"github.com/google/uuid"
 	core "github.com/iden3/go-iden3-core"
 	"github.com/iden3/go-iden3-crypto/babyjub"
 	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/go-merkletree-sql/db/memory"
 	"github.com/iden3/go-schema-processor/verifiable"
 	logger "github.com/sirupsen/logrus"
 	"issuer/db"
 	"issuer/service/claim"
 	"issuer/service/schema"
 	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Info contains information about when the state was committed.
@@ -36,73 +41,254 @@ func (cs *CommittedState) State() (*merkletree.Hash, error) {
 	return merkletree.HashElems(cs.ClaimsTreeRoot.BigInt(), cs.RevocationTreeRoot.BigInt(), cs.RootsTreeRoot.BigInt())
 }
 
-const treeDepth = 32
+const (
+	// DefaultTreeDepth is the depth of the trees the iden3 circuits are built for
+	DefaultTreeDepth = 32
+	// MinTreeDepth and MaxTreeDepth bound the depths merkletree-sql supports, a proof has
+	// room for the siblings of 240 levels
+	MinTreeDepth = 2
+	MaxTreeDepth = 240
+)
+
+// the prefixes the trees are stored under, in the namespace of the identity
+var (
+	claimsTreePrefix      = []byte("claims")
+	revocationsTreePrefix = []byte("revocation")
+	rootsTreePrefix       = []byte("ror")
+)
+
+// TreeDepths are the maximum depths of the trees of an identity
+type TreeDepths struct {
+	Claims      int
+	Revocations int
+	Roots       int
+}
+
+// UniformTreeDepths gives all three trees the same depth
+func UniformTreeDepths(depth int) TreeDepths {
+	return TreeDepths{Claims: depth, Revocations: depth, Roots: depth}
+}
+
+func (d TreeDepths) validate() error {
+	trees := []struct {
+		name  string
+		depth int
+	}{{"claims", d.Claims}, {"revocations", d.Revocations}, {"roots", d.Roots}}
+
+	for _, t := range trees {
+		if t.depth < MinTreeDepth || t.depth > MaxTreeDepth {
+			return fmt.Errorf("the depth of the %s tree must be between %d and %d, got %d", t.name, MinTreeDepth, MaxTreeDepth, t.depth)
+		}
+	}
+	return nil
+}
+
+// treeDepthWarningRatio is the share of the maximum depth above which a leaf insertion is logged as a warning
+const treeDepthWarningRatio = 0.9
+
+// ErrTreeFull is returned when a leaf can't be added to a tree because its path would exceed the tree depth
+var ErrTreeFull = errors.New("merkle tree reached its maximum depth, no more entries can be added on this path")
+
+// wrapTreeErr maps the low level merkle tree overflow error to ErrTreeFull
+func wrapTreeErr(err error) error {
+	if errors.Is(err, merkletree.ErrReachedMaxLevel) {
+		return fmt.Errorf("%w: %v", ErrTreeFull, err)
+	}
+	return err
+}
+
+// warnOnTreeDepth logs a warning when the leaf of the key sits close to the maximum depth of the tree,
+// so the operators know about the shrinking capacity before insertions start failing
+func warnOnTreeDepth(tree *merkletree.MerkleTree, name string, k *big.Int) {
+	proof, _, err := tree.GenerateProof(context.Background(), k, nil)
+	if err != nil {
+		logger.Warnf("can't check the depth of the %s tree, err: %v", name, err)
+		return
+	}
+
+	depth := len(proof.AllSiblings())
+	if float64(depth) >= float64(tree.MaxLevels())*treeDepthWarningRatio {
+		logger.Warnf("%s tree leaf inserted at depth %d out of %d, the tree is close to its capacity", name, depth, tree.MaxLevels())
+	}
+}
 
 type IdentityState struct {
 	CommittedState CommittedState
+	// committedMu guards the CommittedState replaced when a publish is confirmed, it's read through
+	// SnapshotCommittedState and written through SetCommittedState
+	committedMu sync.RWMutex
+	// readView holds the *ReadView of the CommittedState, swapped along with it
+	readView atomic.Value
+
+	// treesMu serializes the insertions in the latest trees against readers that need their roots and proofs
+	// to be consistent with each other
+	treesMu sync.RWMutex
 
 	Claims      *Claims
 	Revocations *Revocations
 	Roots       *Roots
 	db          *db.DB
+
+	// the trees are created again from these on a Reset
+	treeStorage *store.BoltStore
+	namespace   []byte
+	depths      TreeDepths
+
+	// identifier is the tenant the state belongs to, nil for the single identity of the DB
+	identifier *core.ID
 }
 
-func NewIdentityState(db *db.DB) (*IdentityState, error) {
+// SnapshotCommittedState returns a copy of the committed state taken under the read lock
+func (is *IdentityState) SnapshotCommittedState() CommittedState {
+	is.committedMu.RLock()
+	defer is.committedMu.RUnlock()
+
+	return is.CommittedState
+}
+
+// SetCommittedState replaces the committed state under the write lock and swaps the read view to it
+func (is *IdentityState) SetCommittedState(cs CommittedState) error {
+	view, err := is.newReadView(cs)
+	if err != nil {
+		return err
+	}
+
+	is.committedMu.Lock()
+	defer is.committedMu.Unlock()
+
+	is.CommittedState = cs
+	is.readView.Store(view)
+	return nil
+}
+
+// TreeNamespace returns the storage namespace that isolates the merkle trees of the given identity
+// from the trees of other identities sharing the same DB
+func TreeNamespace(identifier *core.ID) []byte {
+	return append(identifier.Bytes(), '/')
+}
+
+// NewIdentityState creates the state of an identity. All the identity's merkle trees are stored under
+// the given namespace (see TreeNamespace), an empty namespace keeps the trees at the root of the tree storage.
+// The depths of the trees are fixed once they hold leaves, other depths give other roots and proofs.
+func NewIdentityState(db *db.DB, namespace []byte, depths TreeDepths) (*IdentityState, error) {
 	logger.Debug("creating new identity state")
 
-	treeStorage, err := store.NewBoltStorage(db.GetConnection())
+	err := depths.validate()
 	if err != nil {
 		return nil, err
 	}
 
-	claims, err := NewClaims(db, treeStorage, treeDepth)
+	boltStorage, err := store.NewBoltStorage(db.GetConnection())
 	if err != nil {
 		return nil, err
 	}
+	// the bolt store always returns a bolt store narrowed to the prefix
+	treeStorage := boltStorage.WithPrefix(namespace).(*store.BoltStore)
 
-	revs, err := NewRevocations(treeStorage, treeDepth)
+	is := &IdentityState{
+		db:          db,
+		treeStorage: treeStorage,
+		namespace:   namespace,
+		depths:      depths,
+	}
+	err = is.openTrees()
 	if err != nil {
 		return nil, err
 	}
 
-	roots, err := NewRoots(treeStorage, treeDepth)
+	return is, nil
+}
+
+// NewTenantState creates the state of one of the identities sharing the DB, its trees are stored in the namespace of
+// the identifier and its record is looked up by the identifier
+func NewTenantState(db *db.DB, identifier *core.ID, depths TreeDepths) (*IdentityState, error) {
+	is, err := NewIdentityState(db, TreeNamespace(identifier), depths)
 	if err != nil {
 		return nil, err
 	}
+	is.identifier = identifier
+	is.scopeClaims(identifier)
 
-	return &IdentityState{
-		Claims:      claims,
-		Revocations: revs,
-		Roots:       roots,
-		db:          db,
-	}, nil
+	return is, nil
 }
 
-func (is *IdentityState) SetupGenesisState(pk *babyjub.PublicKey) (*core.ID, *core.Claim, error) {
+// openTrees creates the three trees from the tree storage, on their stored roots
+func (is *IdentityState) openTrees() error {
+	claims, err := NewClaims(is.db, is.treeStorage, is.depths.Claims)
+	if err != nil {
+		return err
+	}
+
+	revs, err := NewRevocations(is.treeStorage, is.depths.Revocations)
+	if err != nil {
+		return err
+	}
+
+	roots, err := NewRoots(is.treeStorage, is.depths.Roots)
+	if err != nil {
+		return err
+	}
+
+	is.Claims = claims
+	is.Revocations = revs
+	is.Roots = roots
+	return nil
+}
+
+// NewAuthClaim creates the auth claim of the key, with a random revocation nonce
+func NewAuthClaim(pk *babyjub.PublicKey) (*core.Claim, error) {
 	logger.Trace("getting auth schema hash")
 	schemaHash, err := core.NewSchemaHashFromHex(schema.AuthBJJCredentialHash)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	logger.Trace("creating new auth claim")
-	authClaim, err := claim.NewAuthClaim(pk, schemaHash)
+	return claim.NewAuthClaim(pk, schemaHash)
+}
+
+// GenesisIdentifier derives the identifier of the genesis state holding only the auth claim, without a state to add
+// it to. It's the identifier the tree namespace of a new tenant is derived from.
+func GenesisIdentifier(authClaim *core.Claim, claimsTreeDepth int, idType [2]byte) (*core.ID, error) {
+	claimsRoot, err := genesisClaimsRoot(context.Background(), authClaim, claimsTreeDepth)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	logger.Trace("adding auth claim to the claims tree")
-	err = is.AddClaimToTree(authClaim)
+	// the revocation and the roots trees of the genesis state are empty
+	genesisState, err := merkletree.HashElems(claimsRoot.BigInt(), merkletree.HashZero.BigInt(), merkletree.HashZero.BigInt())
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	currState, err := is.GetStateHash()
+	return core.IdGenesisFromIdenState(idType, genesisState.BigInt())
+}
+
+// genesisClaimsRoot is the root of a claims tree holding only the auth claim
+func genesisClaimsRoot(ctx context.Context, authClaim *core.Claim, claimsTreeDepth int) (*merkletree.Hash, error) {
+	claimsTree, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), claimsTreeDepth)
+	if err != nil {
+		return nil, err
+	}
+	i, v, err := authClaim.HiHv()
+	if err != nil {
+		return nil, err
+	}
+	err = claimsTree.Add(ctx, i, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return claimsTree.Root(), nil
+}
+
+func (is *IdentityState) SetupGenesisState(pk *babyjub.PublicKey, idType [2]byte) (*core.ID, *core.Claim, error) {
+	authClaim, err := NewAuthClaim(pk)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	identifier, err := core.IdGenesisFromIdenState(core.TypeDefault, currState.BigInt())
+	identifier, err := is.SetupGenesisStateFromAuthClaim(authClaim, idType)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -110,19 +296,49 @@ func (is *IdentityState) SetupGenesisState(pk *babyjub.PublicKey) (*core.ID, *co
 	return identifier, authClaim, nil
 }
 
-func (is *IdentityState) SaveIdentity(identifier *core.ID, authClaimId uuid.UUID) error {
+// SetupGenesisStateFromAuthClaim adds the given auth claim to the empty trees and returns the genesis identifier
+// of the id type
+func (is *IdentityState) SetupGenesisStateFromAuthClaim(authClaim *core.Claim, idType [2]byte) (*core.ID, error) {
+	logger.Trace("adding auth claim to the claims tree")
+	err := is.AddClaimToTree(authClaim)
+	if err != nil {
+		return nil, err
+	}
+
+	currState, err := is.GetStateHash()
+	if err != nil {
+		return nil, err
+	}
+
+	identifier, err := core.IdGenesisFromIdenState(idType, currState.BigInt())
+	if err != nil {
+		return nil, err
+	}
+	is.scopeClaims(identifier)
+
+	return identifier, nil
+}
+
+// SaveIdentity saves the identity record, a nil genesis state leaves it unrecorded
+func (is *IdentityState) SaveIdentity(identifier *core.ID, authClaimId uuid.UUID, genesisState *merkletree.Hash) error {
 
 	id := identifier.Bytes()
-	authId := []byte(authClaimId.String())
 
-	return is.db.SaveIdentity(id, authId)
+	record := &db.IdentityRecord{AuthClaimID: authClaimId.String(), TreeNamespace: is.namespace}
+	if genesisState != nil {
+		record.GenesisState = genesisState.Hex()
+	}
+	if is.identifier == nil {
+		return is.db.SavePrimaryIdentity(id, record)
+	}
+	return is.db.SaveIdentity(id, record)
 
 }
 
 func (is *IdentityState) GetIdentityFromDB() (*core.ID, *uuid.UUID, error) {
 	logger.Debug("IdentityState.GetIdentityFromDB() invoked")
 
-	id, authClaimId, err := is.db.GetSavedIdentity()
+	id, record, err := is.savedIdentity()
 	if err != nil {
 		return nil, nil, err
 	}
@@ -134,8 +350,9 @@ func (is *IdentityState) GetIdentityFromDB() (*core.ID, *uuid.UUID, error) {
 	if err != nil {
 		return nil, nil, err
 	}
+	is.scopeClaims(&coreId)
 
-	claimId, err := uuid.Parse(string(authClaimId))
+	claimId, err := uuid.Parse(record.AuthClaimID)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -143,21 +360,325 @@ func (is *IdentityState) GetIdentityFromDB() (*core.ID, *uuid.UUID, error) {
 	return &coreId, &claimId, nil
 }
 
+// savedIdentity returns the record of the tenant, or the record of the single identity. Both are nil when the identity
+// wasn't saved yet.
+func (is *IdentityState) savedIdentity() ([]byte, *db.IdentityRecord, error) {
+	if is.identifier == nil {
+		return is.db.GetSavedIdentity()
+	}
+
+	id := is.identifier.Bytes()
+	record, err := is.db.GetIdentity(id)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return id, record, nil
+}
+
+// GetGenesisState returns the genesis state of the saved identity, or nil if it wasn't recorded
+func (is *IdentityState) GetGenesisState() (*merkletree.Hash, error) {
+	logger.Debug("IdentityState.GetGenesisState() invoked")
+
+	_, record, err := is.savedIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	if record == nil || record.GenesisState == "" {
+		return nil, nil
+	}
+
+	return merkletree.NewHashFromHex(record.GenesisState)
+}
+
+// GetLastPublishedState returns the latest state of the saved identity confirmed on chain, or nil if it never published
+func (is *IdentityState) GetLastPublishedState() (*merkletree.Hash, error) {
+	logger.Debug("IdentityState.GetLastPublishedState() invoked")
+
+	_, record, err := is.savedIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	if record == nil || record.LastPublishedState == "" {
+		return nil, nil
+	}
+
+	return merkletree.NewHashFromHex(record.LastPublishedState)
+}
+
+// SetLastPublishedState records the state confirmed on chain in the saved identity
+func (is *IdentityState) SetLastPublishedState(hash *merkletree.Hash) error {
+	logger.Debug("IdentityState.SetLastPublishedState() invoked")
+
+	id, record, err := is.savedIdentity()
+	if err != nil {
+		return err
+	}
+	if id == nil {
+		return errors.New("the identity isn't saved")
+	}
+
+	record.LastPublishedState = hash.Hex()
+	return is.db.SaveIdentity(id, record)
+}
+
+// RecordStateTransition appends the transition confirmed on chain to the history of the saved identity and records
+// its new state as the last published one
+func (is *IdentityState) RecordStateTransition(t *db.StateTransition) error {
+	logger.Debug("IdentityState.RecordStateTransition() invoked")
+
+	id, record, err := is.savedIdentity()
+	if err != nil {
+		return err
+	}
+	if id == nil {
+		return errors.New("the identity isn't saved")
+	}
+
+	record.LastPublishedState = t.NewState
+	record.Transitions = append(record.Transitions, t)
+	return is.db.SaveIdentity(id, record)
+}
+
+// GetStateTransitions returns the confirmed state transitions of the saved identity, oldest first
+func (is *IdentityState) GetStateTransitions() ([]*db.StateTransition, error) {
+	logger.Debug("IdentityState.GetStateTransitions() invoked")
+
+	_, record, err := is.savedIdentity()
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, nil
+	}
+
+	return record.Transitions, nil
+}
+
 func (is *IdentityState) AddClaimToTree(c *core.Claim) error {
 	logger.Debug("IdentityState.AddClaimToTree() invoked")
 
+	is.treesMu.Lock()
+	defer is.treesMu.Unlock()
+
 	return is.Claims.SaveClaimMT(c)
 }
 
+func (is *IdentityState) RemoveClaimFromTree(c *core.Claim) error {
+	logger.Debug("IdentityState.RemoveClaimFromTree() invoked")
+
+	is.treesMu.Lock()
+	defer is.treesMu.Unlock()
+
+	return is.Claims.RemoveClaimMT(c)
+}
+
+// DiscardClaim removes the claim from the claims tree, unless it's signature-only, and from the DB, recording the
+// discard in the audit log and the event stream in the transaction removing it
+func (is *IdentityState) DiscardClaim(c *claim.Claim) error {
+	logger.Debug("IdentityState.DiscardClaim() invoked")
+
+	if !c.SignatureOnly {
+		err := is.RemoveClaimFromTree(c.CoreClaim)
+		if err != nil {
+			return err
+		}
+	}
+	audit, err := is.newAudit(db.AuditEventClaimDiscarded, c)
+	if err != nil {
+		return err
+	}
+
+	return is.db.DeleteClaim(c, audit)
+}
+
 func (is *IdentityState) AddClaimToDB(c *claim.Claim) error {
 	logger.Debug("IdentityState.AddClaimToDB() invoked")
 
-	return is.Claims.SaveClaimDB(c)
+	return is.Claims.SaveClaimDB(c, nil)
+}
+
+// AddIssuedClaimToDB saves the issued claim, added to the claims tree already unless it's signature-only, and records
+// the issuance in the audit log and the event stream in the same transaction. The signature-only claims aren't kept
+// apart by the tree, db.ErrClaimExists is returned rather than overwriting a claim with the same id.
+func (is *IdentityState) AddIssuedClaimToDB(c *claim.Claim) error {
+	logger.Debug("IdentityState.AddIssuedClaimToDB() invoked")
+
+	audit, err := is.newAudit(db.AuditEventClaimIssued, c)
+	if err != nil {
+		return err
+	}
+
+	return is.Claims.InsertClaimDB(c, audit)
+}
+
+// RevokeClaim adds the revocation nonce of the claim to the revocation tree and marks the claim revoked in the DB,
+// recording the revocation in the audit log and the event stream in the same transaction
+func (is *IdentityState) RevokeClaim(c *claim.Claim) error {
+	logger.Debug("IdentityState.RevokeClaim() invoked")
+
+	is.treesMu.Lock()
+	err := is.Revocations.Revoke(c.RevNonce)
+	is.treesMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	c.Revoked = true
+	audit, err := is.newAudit(db.AuditEventClaimRevoked, c)
+	if err != nil {
+		return err
+	}
+	return is.Claims.SaveClaimDB(c, audit)
+}
+
+// newAudit is the audit entry and the event of a change of the claim, along with the state the change left the
+// identity in
+func (is *IdentityState) newAudit(event string, c *claim.Claim) (*db.Audit, error) {
+	stateHash, err := is.GetStateHash()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	return &db.Audit{
+		Entry: &db.AuditEntry{
+			Event:     event,
+			ClaimID:   c.ID.String(),
+			RevNonce:  c.RevNonce,
+			State:     stateHash.Hex(),
+			Timestamp: now,
+		},
+		Event: &db.Event{
+			Type:       event,
+			ClaimID:    c.ID.String(),
+			SchemaType: c.SchemaType,
+			RevNonce:   c.RevNonce,
+			Timestamp:  now,
+		},
+	}, nil
+}
+
+// GetClaimsBySubject returns the claims issued to the subject
+func (is *IdentityState) GetClaimsBySubject(subject string) ([]*claim.Claim, error) {
+	logger.Debug("IdentityState.GetClaimsBySubject() invoked")
+
+	claims, err := is.db.GetClaimsBySubject(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	res := claims[:0]
+	for _, c := range claims {
+		if is.Claims.owns(c) {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+// scopeClaims scopes the claim lookups to the claims issued by the identifier
+func (is *IdentityState) scopeClaims(identifier *core.ID) {
+	is.Claims.issuer = identifier.String()
+}
+
+func (is *IdentityState) AppendEvent(e *db.Event) error {
+	logger.Debug("IdentityState.AppendEvent() invoked")
+
+	return is.db.AppendEvent(e)
+}
+
+// Ping checks the DB is open
+func (is *IdentityState) Ping() error {
+	return is.db.Ping()
+}
+
+// IsRevNonceUsed tells whether a saved or archived claim was issued with the revocation nonce
+func (is *IdentityState) IsRevNonceUsed(nonce uint64) (bool, error) {
+	logger.Debug("IdentityState.IsRevNonceUsed() invoked")
+
+	return is.db.IsRevNonceUsed(nonce)
+}
+
+func (is *IdentityState) GetEvents(since uint64, limit int) ([]*db.Event, error) {
+	logger.Debug("IdentityState.GetEvents() invoked")
+
+	return is.db.GetEvents(since, limit)
+}
+
+func (is *IdentityState) GetCursor(name string) (uint64, error) {
+	logger.Debug("IdentityState.GetCursor() invoked")
+
+	return is.db.GetCursor(name)
+}
+
+func (is *IdentityState) SaveCursor(name string, offset uint64) error {
+	logger.Debug("IdentityState.SaveCursor() invoked")
+
+	return is.db.SaveCursor(name, offset)
+}
+
+func (is *IdentityState) GetAuditLog() ([]*db.AuditEntry, error) {
+	logger.Debug("IdentityState.GetAuditLog() invoked")
+
+	return is.db.GetAuditLog()
+}
+
+// AddRootToTree adds the claims tree root to the roots tree
+func (is *IdentityState) AddRootToTree(root *merkletree.Hash) error {
+	logger.Debug("IdentityState.AddRootToTree() invoked")
+
+	is.treesMu.Lock()
+	defer is.treesMu.Unlock()
+
+	return is.Roots.Tree.Add(context.Background(), root.BigInt(), merkletree.HashZero.BigInt())
+}
+
+// RootsRootWith returns the root the roots tree would have with the claims tree root added. It's computed on an
+// in-memory copy of the roots tree, which holds a leaf per published state, the roots tree is left as it is.
+func (is *IdentityState) RootsRootWith(root *merkletree.Hash) (*merkletree.Hash, error) {
+	logger.Debug("IdentityState.RootsRootWith() invoked")
+	ctx := context.Background()
+
+	is.treesMu.RLock()
+	leafs, err := is.Roots.Tree.DumpLeafs(ctx, nil)
+	maxLevels := is.Roots.Tree.MaxLevels()
+	is.treesMu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	roots, err := merkletree.NewMerkleTree(ctx, memory.NewMemoryStorage(), maxLevels)
+	if err != nil {
+		return nil, err
+	}
+	err = roots.ImportDumpedLeafs(ctx, leafs)
+	if err != nil {
+		return nil, err
+	}
+	err = roots.Add(ctx, root.BigInt(), merkletree.HashZero.BigInt())
+	if err != nil && !errors.Is(err, merkletree.ErrEntryIndexAlreadyExists) {
+		return nil, err
+	}
+
+	return roots.Root(), nil
 }
 
 func (is *IdentityState) GetStateHash() (*merkletree.Hash, error) {
 	logger.Debug("GetStateHash() invoked")
 
+	is.treesMu.RLock()
+	defer is.treesMu.RUnlock()
+
+	return is.stateHash()
+}
+
+// stateHash composes the latest state from the roots of the latest trees, the caller holds treesMu
+func (is *IdentityState) stateHash() (*merkletree.Hash, error) {
 	return merkletree.HashElems(
 		is.Claims.Tree.Root().BigInt(),
 		is.Revocations.Tree.Root().BigInt(),
@@ -176,7 +697,7 @@ func (is *IdentityState) GetInclusionProof(claim *core.Claim) (*merkletree.Proof
 	if err != nil {
 		return nil, nil, err
 	}
-	return is.Claims.Tree.GenerateProof(context.Background(), hi, is.CommittedState.ClaimsTreeRoot)
+	return is.Claims.Tree.GenerateProof(context.Background(), hi, is.SnapshotCommittedState().ClaimsTreeRoot)
 }
 
 func (is *IdentityState) GetRevocationProof(claim *core.Claim) (*merkletree.Proof, *big.Int, error) {
@@ -184,24 +705,25 @@ func (is *IdentityState) GetRevocationProof(claim *core.Claim) (*merkletree.Proo
 	if err != nil {
 		return nil, nil, err
 	}
-	return is.Revocations.Tree.GenerateProof(context.Background(), hi, is.CommittedState.RevocationTreeRoot)
+	return is.Revocations.Tree.GenerateProof(context.Background(), hi, is.SnapshotCommittedState().RevocationTreeRoot)
 }
 
 func (is *IdentityState) GetMTPProof(identifier *core.ID, claimIdx *big.Int) (*verifiable.Iden3SparseMerkleProof, error) {
-	mtpProof, _, err := is.Claims.Tree.GenerateProof(
-		context.Background(), claimIdx, is.CommittedState.ClaimsTreeRoot)
+	view := is.ReadView()
+	mtpProof, err := view.ClaimProof(claimIdx)
 	if err != nil {
 		return nil, err
 	}
 
-	if is.CommittedState.Info.TxId == "" {
+	committed := view.Committed
+	if committed.Info == nil || committed.Info.TxId == "" {
 		return nil, errors.New("failed generate mtp proof. Transaction not exists")
 	}
 
-	txID := is.CommittedState.Info.TxId
-	blockTimestamp := int(is.CommittedState.Info.BlockTimestamp)
-	blockNumber := int(is.CommittedState.Info.BlockNumber)
-	committedState, err := is.CommittedState.State()
+	txID := committed.Info.TxId
+	blockTimestamp := int(committed.Info.BlockTimestamp)
+	blockNumber := int(committed.Info.BlockNumber)
+	committedState, err := committed.State()
 	if err != nil {
 		return nil, err
 	}
@@ -214,9 +736,9 @@ func (is *IdentityState) GetMTPProof(identifier *core.ID, claimIdx *big.Int) (*v
 				TxID:               &txID,
 				BlockTimestamp:     &blockTimestamp,
 				BlockNumber:        &blockNumber,
-				RootOfRoots:        strptr(is.CommittedState.RootsTreeRoot.Hex()),
-				ClaimsTreeRoot:     strptr(is.CommittedState.ClaimsTreeRoot.Hex()),
-				RevocationTreeRoot: strptr(is.CommittedState.RevocationTreeRoot.Hex()),
+				RootOfRoots:        strptr(committed.RootsTreeRoot.Hex()),
+				ClaimsTreeRoot:     strptr(committed.ClaimsTreeRoot.Hex()),
+				RevocationTreeRoot: strptr(committed.RevocationTreeRoot.Hex()),
 				Value:              strptr(committedState.Hex()),
 			},
 		},
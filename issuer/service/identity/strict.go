@@ -0,0 +1,239 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	core "github.com/iden3/go-iden3-core"
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/iden3/go-iden3-crypto/poseidon"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/iden3/go-schema-processor/verifiable"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"issuer/service/claim"
+	"math/big"
+)
+
+// ErrSelfVerification is returned in strict issuance mode when a produced credential doesn't verify, the credential
+// isn't issued
+var ErrSelfVerification = errors.New("the issued credential failed its self verification")
+
+// ErrStoredClaimInvalid is returned when a claim read from the DB with verification doesn't verify, the stored claim
+// is corrupted or was tampered with
+var ErrStoredClaimInvalid = errors.New("the stored claim failed its verification")
+
+// verifyIssuedClaim checks the produced credential the way a verifier would: the core claim survives a round trip
+// through its binary encoding, the signature verifies against the key of the auth claim, the auth claim inclusion
+// proof verifies against the claims root it was issued with and both claims are in the latest claims tree
+func (i *Identity) verifyIssuedClaim(claimModel *claim.Claim, sigProof *verifiable.BJJSignatureProof2021) error {
+	logger.Debug("verifyIssuedClaim() invoked")
+
+	err := verifyClaimEncoding(claimModel)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfVerification, err)
+	}
+
+	err = verifyClaimSignature(claimModel.CoreClaim, sigProof)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfVerification, err)
+	}
+
+	authClaimModel, err := i.state.Claims.GetClaim(i.authClaimID())
+	if err != nil {
+		return err
+	}
+	err = verifyAuthClaimProof(authClaimModel)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfVerification, err)
+	}
+
+	inTree := map[string]*core.Claim{"auth claim": authClaimModel.CoreClaim}
+	if !claimModel.SignatureOnly {
+		inTree["claim"] = claimModel.CoreClaim
+	}
+	for name, c := range inTree {
+		err = i.verifyInLatestTree(c)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrSelfVerification, name, err)
+		}
+	}
+
+	return nil
+}
+
+// verifyStoredClaim checks a claim read from the DB: the core claim survives a round trip through its binary
+// encoding, its stored signature proof was made by the auth claim of the issuer and verifies, and the claim is in the
+// latest claims tree unless it's signature-only. The auth claim has no signature proof, only its inclusion is checked.
+func (i *Identity) verifyStoredClaim(claimModel *claim.Claim) error {
+	logger.Debugf("verifyStoredClaim() invoked with claim %s", claimModel.ID)
+
+	err := verifyClaimEncoding(claimModel)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStoredClaimInvalid, err)
+	}
+
+	if claimModel.ID == i.authClaimID() {
+		// the auth claim isn't signed, it's in the tree since the genesis state
+		err = i.verifyInLatestTree(claimModel.CoreClaim)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrStoredClaimInvalid, err)
+		}
+		return nil
+	}
+
+	sigProof := &verifiable.BJJSignatureProof2021{}
+	err = json.Unmarshal(claimModel.SignatureProof, sigProof)
+	if err != nil {
+		return fmt.Errorf("%w: can't parse the signature proof, %v", ErrStoredClaimInvalid, err)
+	}
+	authClaimModel, err := i.state.Claims.GetClaim(i.authClaimID())
+	if err != nil {
+		return err
+	}
+	if sigProof.IssuerData.AuthClaim == nil || !sameClaim(sigProof.IssuerData.AuthClaim, authClaimModel.CoreClaim) {
+		return fmt.Errorf("%w: the signature proof doesn't hold the auth claim of the issuer", ErrStoredClaimInvalid)
+	}
+	err = verifyClaimSignature(claimModel.CoreClaim, sigProof)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStoredClaimInvalid, err)
+	}
+
+	if !claimModel.SignatureOnly {
+		err = i.verifyInLatestTree(claimModel.CoreClaim)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrStoredClaimInvalid, err)
+		}
+	}
+
+	return nil
+}
+
+// sameClaim tells whether both claims have the same index and value
+func sameClaim(a, b *core.Claim) bool {
+	aHi, aHv, err := a.HiHv()
+	if err != nil {
+		return false
+	}
+	bHi, bHv, err := b.HiHv()
+	if err != nil {
+		return false
+	}
+	return aHi.Cmp(bHi) == 0 && aHv.Cmp(bHv) == 0
+}
+
+// verifyClaimEncoding re-parses the core claim and compares it with the claim model derived from it
+func verifyClaimEncoding(claimModel *claim.Claim) error {
+	b, err := claimModel.CoreClaim.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	parsed := &core.Claim{}
+	err = parsed.UnmarshalBinary(b)
+	if err != nil {
+		return err
+	}
+
+	hi, hv, err := claimModel.CoreClaim.HiHv()
+	if err != nil {
+		return err
+	}
+	parsedHi, parsedHv, err := parsed.HiHv()
+	if err != nil {
+		return err
+	}
+	if hi.Cmp(parsedHi) != 0 || hv.Cmp(parsedHv) != 0 {
+		return errors.New("the core claim changes through its binary encoding")
+	}
+
+	parsedModel, err := claim.CoreClaimToClaimModel(parsed, claimModel.SchemaURL, claimModel.SchemaType)
+	if err != nil {
+		return err
+	}
+	subjectID, err := claimModel.CoreSubjectID()
+	if err != nil {
+		return err
+	}
+	if parsedModel.OtherIdentifier != subjectID || parsedModel.RevNonce != claimModel.RevNonce ||
+		parsedModel.Version != claimModel.Version || parsedModel.Expiration != claimModel.Expiration {
+		return errors.New("the re-parsed core claim doesn't match the claim model")
+	}
+
+	return nil
+}
+
+// verifyClaimSignature verifies the signature of the proof with the public key held by the auth claim of the proof
+func verifyClaimSignature(c *core.Claim, sigProof *verifiable.BJJSignatureProof2021) error {
+	if sigProof.IssuerData.AuthClaim == nil {
+		return errors.New("the signature proof has no auth claim")
+	}
+
+	slots := sigProof.IssuerData.AuthClaim.RawSlotsAsInts()
+	// the key is held by the index data slots, the 3rd and 4th slots of the claim
+	pub := babyjub.PublicKey{X: slots[2], Y: slots[3]}
+
+	sig, err := claim.BJJSignatureFromHexString(sigProof.Signature)
+	if err != nil {
+		return err
+	}
+
+	hi, hv, err := c.HiHv()
+	if err != nil {
+		return err
+	}
+	commonHash, err := poseidon.Hash([]*big.Int{hi, hv})
+	if err != nil {
+		return err
+	}
+
+	if !pub.VerifyPoseidon(commonHash, sig) {
+		return errors.New("the signature doesn't verify against the auth claim key")
+	}
+
+	return nil
+}
+
+// verifyAuthClaimProof verifies the stored inclusion proof of the auth claim against the claims root it holds
+func verifyAuthClaimProof(authClaimModel *claim.Claim) error {
+	authMTP := &verifiable.Iden3SparseMerkleProof{}
+	err := json.Unmarshal(authClaimModel.MTPProof, authMTP)
+	if err != nil {
+		return err
+	}
+	if authMTP.MTP == nil || authMTP.IssuerData.State.ClaimsTreeRoot == nil {
+		return errors.New("the auth claim proof has no merkle proof or claims root")
+	}
+
+	root, err := merkletree.NewHashFromHex(*authMTP.IssuerData.State.ClaimsTreeRoot)
+	if err != nil {
+		return err
+	}
+	hi, hv, err := authClaimModel.CoreClaim.HiHv()
+	if err != nil {
+		return err
+	}
+
+	if !merkletree.VerifyProof(root, authMTP.MTP, hi, hv) {
+		return errors.New("the auth claim inclusion proof doesn't verify")
+	}
+
+	return nil
+}
+
+// verifyInLatestTree checks that the claim is a leaf of the latest claims tree
+func (i *Identity) verifyInLatestTree(c *core.Claim) error {
+	hi, hv, err := c.HiHv()
+	if err != nil {
+		return err
+	}
+
+	proof, value, err := i.state.Claims.Tree.GenerateProof(context.Background(), hi, nil)
+	if err != nil {
+		return err
+	}
+	if !proof.Existence || value.Cmp(hv) != 0 {
+		return errors.New("not in the latest claims tree")
+	}
+
+	return nil
+}
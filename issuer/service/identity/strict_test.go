@@ -0,0 +1,17 @@
+package identity
+
+import (
+	"testing"
+)
+
+func TestVerifyStoredClaim(t *testing.T) {
+	iden := newTestIdentity(t)
+	c := issueTestClaim(t, iden)
+
+	for name, id := range map[string]string{"auth claim": iden.authClaimID().String(), "issued claim": c.ID.String()} {
+		_, err := iden.GetClaim(id, true)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package identity
+
+import (
+	core "github.com/iden3/go-iden3-core"
+	"github.com/pkg/errors"
+	"issuer/service/claim"
+)
+
+var (
+	// ErrInvalidSubjectPosition is returned when the claim request puts the subject in an unknown part of the claim
+	ErrInvalidSubjectPosition = errors.New("invalid subject position")
+	// ErrInvalidSubject is returned when the subject of the claim request isn't an identifier or a DID
+	ErrInvalidSubject = errors.New("invalid subject")
+)
+
+// subjectPosition checks the requested position of the subject in the claim, the index when it isn't given, and that
+// the resolved subject can be set there. A subject in the value requires a subject.
+func subjectPosition(position, subjectID string) (string, error) {
+	switch position {
+	case "":
+		position = claim.SubjectPositionIndex
+	case claim.SubjectPositionIndex, claim.SubjectPositionValue:
+	default:
+		return "", errors.Wrapf(ErrInvalidSubjectPosition, "'%s', expected %s or %s",
+			position, claim.SubjectPositionIndex, claim.SubjectPositionValue)
+	}
+
+	if subjectID == "" {
+		if position == claim.SubjectPositionValue {
+			return "", errors.Wrapf(ErrInvalidSubjectPosition, "'%s' requires the identifier of the subject", position)
+		}
+		return position, nil
+	}
+
+	if _, err := core.IDFromString(subjectID); err != nil {
+		return "", errors.Wrapf(ErrInvalidSubject, "'%s' isn't an identifier or a DID: %v", subjectID, err)
+	}
+
+	return position, nil
+}
@@ -0,0 +1,63 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"issuer/service/cfgs"
+	"issuer/service/logging"
+	issuer_contract "issuer/service/models"
+	"time"
+)
+
+// ErrTemplateNotFound is returned when a claim is requested from a template that isn't configured
+var ErrTemplateNotFound = errors.New("claim template not found")
+
+// CreateClaimFromTemplate expands the named template and the request into a full claim request and issues the claim
+func (i *Identity) CreateClaimFromTemplate(ctx context.Context, name string, tReq *issuer_contract.CreateClaimFromTemplateRequest) (*issuer_contract.CreateClaimResponse, error) {
+	logging.FromContext(ctx).Debugf("CreateClaimFromTemplate() invoked with template %s", name)
+
+	t, ok := i.templates[name]
+	if !ok {
+		return nil, errors.Wrapf(ErrTemplateNotFound, "template '%s'", name)
+	}
+
+	cReq, err := expandTemplate(t, tReq, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return i.CreateClaim(ctx, cReq)
+}
+
+// expandTemplate builds the claim request of the template, checking that the data holds the fields the template requires
+func expandTemplate(t cfgs.ClaimTemplate, tReq *issuer_contract.CreateClaimFromTemplateRequest, now time.Time) (*issuer_contract.CreateClaimRequest, error) {
+	fields := make(map[string]json.RawMessage)
+	err := json.Unmarshal(tReq.Data, &fields)
+	if err != nil {
+		return nil, errors.Wrap(err, "claim data must be a json object")
+	}
+	for _, f := range t.RequiredFields {
+		if _, ok := fields[f]; !ok {
+			return nil, errors.Errorf("field '%s' is required by template '%s'", f, t.Name)
+		}
+	}
+
+	expiration := tReq.Expiration
+	if expiration == 0 && t.Expiration > 0 {
+		expiration = now.Add(t.Expiration).Unix()
+	}
+
+	return &issuer_contract.CreateClaimRequest{
+		Schema: &issuer_contract.Schema{
+			URL:  t.SchemaURL,
+			Type: t.SchemaType,
+		},
+		Data:            tReq.Data,
+		Identifier:      tReq.Identifier,
+		Expiration:      expiration,
+		RevNonce:        tReq.RevNonce,
+		SubjectPosition: t.SubjectPosition,
+		Evidence:        tReq.Evidence,
+	}, nil
+}
@@ -0,0 +1,53 @@
+package identity
+
+import (
+	"fmt"
+	logger "github.com/sirupsen/logrus"
+	issuer_contract "issuer/service/models"
+	"time"
+)
+
+// TemporalError is returned when the dates of a claim request are inconsistent
+type TemporalError struct {
+	Field  string
+	Reason string
+}
+
+func (e *TemporalError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+// validateClaimDates rejects a claim that expires at or before its issuance or, unless the request allows it, before
+// now, and, when a maximum skew is configured, a claim issued further in the future than the skew
+func (i *Identity) validateClaimDates(cReq *issuer_contract.CreateClaimRequest, now time.Time) error {
+	logger.Debug("validateClaimDates() invoked")
+
+	issuance := now.Unix()
+	if cReq.IssuanceDate != 0 {
+		issuance = cReq.IssuanceDate
+		if i.maxIssuanceSkew > 0 && issuance > now.Add(i.maxIssuanceSkew).Unix() {
+			return &TemporalError{
+				Field:  "issuanceDate",
+				Reason: fmt.Sprintf("%s is more than %s in the future", time.Unix(issuance, 0).UTC(), i.maxIssuanceSkew),
+			}
+		}
+	}
+
+	if cReq.Expiration == 0 {
+		return nil
+	}
+	if cReq.Expiration <= issuance {
+		return &TemporalError{
+			Field:  "expiration",
+			Reason: fmt.Sprintf("%s isn't after the issuance date %s", time.Unix(cReq.Expiration, 0).UTC(), time.Unix(issuance, 0).UTC()),
+		}
+	}
+	if cReq.Expiration <= now.Unix() && !cReq.AllowPastExpiration {
+		return &TemporalError{
+			Field:  "expiration",
+			Reason: fmt.Sprintf("%s is in the past", time.Unix(cReq.Expiration, 0).UTC()),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package identity
+
+import (
+	"bytes"
+	"github.com/google/uuid"
+	core "github.com/iden3/go-iden3-core"
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"issuer/db"
+	"issuer/service/cfgs"
+	"issuer/service/identity/state"
+	"issuer/service/schema"
+	"strings"
+	"sync"
+)
+
+// ErrTenantNotFound is returned when the identifier isn't one of the tenants saved in the DB
+var ErrTenantNotFound = errors.New("tenant identity not found")
+
+// Tenants are the issuer identities sharing a DB, each one with its merkle trees isolated in the namespace of its
+// identifier. The claim rows are shared, the claims of a tenant are told apart by their issuer. The keys of the
+// tenants aren't stored, they're given to Create, Open and Load. A tenant is served under its TenantPath, the urls
+// of its credentials start with it.
+type Tenants struct {
+	db            *db.DB
+	schemaBuilder *schema.Builder
+	cfg           *cfgs.IssuerConfig
+	stateStore    StateStore
+	depths        state.TreeDepths
+
+	mu         sync.RWMutex
+	identities map[string]*Identity
+}
+
+func NewTenants(
+	db *db.DB,
+	schemaBuilder *schema.Builder,
+	cfg *cfgs.IssuerConfig,
+	stateStore StateStore,
+	depths state.TreeDepths,
+) *Tenants {
+	return &Tenants{
+		db:            db,
+		schemaBuilder: schemaBuilder,
+		cfg:           cfg,
+		stateStore:    stateStore,
+		depths:        depths,
+		identities:    make(map[string]*Identity),
+	}
+}
+
+// TenantPath is the path the tenant identity is served under
+func TenantPath(identifier *core.ID) string {
+	return "/tenants/" + identifier.String()
+}
+
+// Load opens the tenant identity of the key, setting it up first when it isn't saved yet
+func (t *Tenants) Load(sk babyjub.PrivateKey) (*Identity, error) {
+	identifier, err := t.find(sk.Public())
+	if err != nil {
+		return nil, err
+	}
+	if identifier == nil {
+		return t.Create(sk)
+	}
+
+	return t.Open(identifier, sk)
+}
+
+// find returns the identifier of the saved tenant whose auth claim holds the key, nil when there's none. The
+// identifier can't be derived from the key, the auth claim is given a random revocation nonce.
+func (t *Tenants) find(pk *babyjub.PublicKey) (*core.ID, error) {
+	primary, _, err := t.db.GetSavedIdentity()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := t.db.ListIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if bytes.Equal(id, primary) {
+			continue
+		}
+		record, err := t.db.GetIdentity(id)
+		if err != nil {
+			return nil, err
+		}
+		authClaimID, err := uuid.Parse(record.AuthClaimID)
+		if err != nil {
+			return nil, err
+		}
+		authClaim, err := t.db.GetClaim(authClaimID)
+		if err != nil {
+			return nil, err
+		}
+
+		// the key is in the index slots 2 and 3 of the auth claim
+		slots := authClaim.CoreClaim.RawSlotsAsInts()
+		if slots[2].Cmp(pk.X) == 0 && slots[3].Cmp(pk.Y) == 0 {
+			identifier, err := core.IDFromBytes(id)
+			if err != nil {
+				return nil, err
+			}
+			return &identifier, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Create sets up a new tenant identity of the key, in its own tree namespace
+func (t *Tenants) Create(sk babyjub.PrivateKey) (*Identity, error) {
+	logger.Debug("Tenants.Create() invoked")
+
+	// the namespace is derived from the identifier, which is known from the genesis auth claim
+	authClaim, identifier, err := t.genesis(sk)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := state.NewTenantState(t.db, identifier, t.depths)
+	if err != nil {
+		return nil, err
+	}
+	iden, err := newIdentity(s, t.schemaBuilder, sk, t.tenantConfig(identifier), t.stateStore, authClaim)
+	if err != nil {
+		return nil, err
+	}
+	if !iden.Identifier().Equals(identifier) {
+		return nil, errors.Errorf("tenant identity was set up as %s instead of %s", iden.Identifier(), identifier)
+	}
+
+	t.add(iden)
+	return iden, nil
+}
+
+// Open loads the saved tenant identity with its key
+func (t *Tenants) Open(identifier *core.ID, sk babyjub.PrivateKey) (*Identity, error) {
+	logger.Debugf("Tenants.Open() invoked with identifier %s", identifier)
+
+	_, err := t.db.GetIdentity(identifier.Bytes())
+	if errors.Is(err, db.ErrKeyNotFound) {
+		return nil, errors.Wrapf(ErrTenantNotFound, "identifier %s", identifier)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := state.NewTenantState(t.db, identifier, t.depths)
+	if err != nil {
+		return nil, err
+	}
+	iden, err := newIdentity(s, t.schemaBuilder, sk, t.tenantConfig(identifier), t.stateStore, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	t.add(iden)
+	return iden, nil
+}
+
+// Get returns the tenant identity created or opened in this process
+func (t *Tenants) Get(identifier string) (*Identity, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	iden, ok := t.identities[identifier]
+	return iden, ok
+}
+
+// List returns the tenant identities created or opened in this process
+func (t *Tenants) List() []*Identity {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	res := make([]*Identity, 0, len(t.identities))
+	for _, iden := range t.identities {
+		res = append(res, iden)
+	}
+	return res
+}
+
+// ListIdentities returns the identifiers of all the identities saved in the DB, opened or not
+func (t *Tenants) ListIdentities() ([]*core.ID, error) {
+	ids, err := t.db.ListIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*core.ID, 0, len(ids))
+	for _, b := range ids {
+		id, err := core.IDFromBytes(b)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, &id)
+	}
+
+	return res, nil
+}
+
+// genesis returns the genesis auth claim of the key and the identifier it gives
+func (t *Tenants) genesis(sk babyjub.PrivateKey) (*core.Claim, *core.ID, error) {
+	authClaim, err := state.NewAuthClaim(sk.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	identifier, err := state.GenesisIdentifier(authClaim, t.depths.Claims, DIDType(t.cfg.Blockchain, t.cfg.Network))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return authClaim, identifier, nil
+}
+
+// tenantConfig is the config of the tenant, its public url is the one of its TenantPath
+func (t *Tenants) tenantConfig(identifier *core.ID) *cfgs.IssuerConfig {
+	cfg := *t.cfg
+	cfg.PublicUrl = strings.TrimSuffix(t.cfg.PublicUrl, "/") + TenantPath(identifier)
+	return &cfg
+}
+
+func (t *Tenants) add(iden *Identity) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.identities[iden.Identifier().String()] = iden
+}
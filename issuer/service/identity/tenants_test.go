@@ -0,0 +1,60 @@
+package identity
+
+import (
+	"github.com/iden3/go-iden3-crypto/babyjub"
+	"github.com/pkg/errors"
+	"issuer/service/identity/state"
+	"issuer/service/schema"
+	"testing"
+)
+
+// TestTenantsIsolated issues claims from the single identity and from a tenant of its DB, neither one can read or
+// revoke the claims of the other, and each one is loaded again as itself
+func TestTenantsIsolated(t *testing.T) {
+	iden, d := openTestIdentity(t)
+	cfg := testConfig(t)
+	depths := state.UniformTreeDepths(state.DefaultTreeDepth)
+
+	tenantKey := babyjub.NewRandPrivKey()
+	tenant, err := NewTenants(d, schema.NewBuilder(cfg, nil), cfg, nil, depths).Load(tenantKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant.Identifier().Equals(iden.Identifier()) {
+		t.Fatal("the tenant was given the identifier of the single identity")
+	}
+
+	own := issueTestClaim(t, iden)
+	tenantClaim := issueTestClaim(t, tenant)
+
+	_, err = tenant.GetClaim(own.ID.String(), false)
+	if !errors.Is(err, ErrClaimNotFound) {
+		t.Errorf("the tenant got the claim of the single identity, err: %v", err)
+	}
+	_, err = iden.GetClaim(tenantClaim.ID.String(), false)
+	if !errors.Is(err, ErrClaimNotFound) {
+		t.Errorf("the single identity got the claim of the tenant, err: %v", err)
+	}
+	err = iden.RevokeClaim(tenantClaim.RevNonce)
+	if !errors.Is(err, ErrClaimNotFound) {
+		t.Errorf("the single identity revoked the claim of the tenant, err: %v", err)
+	}
+
+	reopened, err := Open(d, schema.NewBuilder(cfg, nil), iden.sk, cfg, nil, depths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.Identifier().Equals(iden.Identifier()) {
+		t.Errorf("the single identity was loaded as %s, want %s", reopened.Identifier(), iden.Identifier())
+	}
+	reloaded, err := NewTenants(d, schema.NewBuilder(cfg, nil), cfg, nil, depths).Load(tenantKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.Identifier().Equals(tenant.Identifier()) {
+		t.Errorf("the tenant was loaded as %s, want %s", reloaded.Identifier(), tenant.Identifier())
+	}
+	if _, err = reloaded.GetClaim(tenantClaim.ID.String(), false); err != nil {
+		t.Errorf("the reloaded tenant can't get its claim, err: %v", err)
+	}
+}
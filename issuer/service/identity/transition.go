@@ -0,0 +1,263 @@
+package identity
+
+import (
+	"context"
+	"github.com/iden3/go-circuits"
+	"github.com/iden3/go-iden3-crypto/poseidon"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"issuer/service/identity/state"
+	"math/big"
+	"sync"
+)
+
+// transitionInputsCache keeps the inputs of the last transition, they stay valid as long as
+// neither the committed state nor the latest state change
+type transitionInputsCache struct {
+	mu       sync.Mutex
+	oldState *merkletree.Hash
+	newState *merkletree.Hash
+	inputs   *circuits.StateTransitionInputs
+}
+
+// TransitionInputs are the inputs of the state transition circuit for publishing the latest state, along with their
+// JSON encoding the witness calculator reads
+type TransitionInputs struct {
+	*circuits.StateTransitionInputs
+	JSON []byte
+	// NewTreeState holds the roots of the new state, they become the committed state once the transition is confirmed
+	NewTreeState circuits.TreeState
+}
+
+// PrepareStateTransition gathers the inputs proving the transition from the committed state to the latest state.
+// IsOldStateGenesis is set while the identity hasn't published a state yet. It fails when there's nothing to publish.
+func (i *Identity) PrepareStateTransition() (*TransitionInputs, error) {
+	logger.Debug("PrepareStateTransition() invoked")
+
+	return i.prepareStateTransition(true)
+}
+
+// prepareStateTransition is PrepareStateTransition, a dry run (apply false) leaves the roots tree as it is
+func (i *Identity) prepareStateTransition(apply bool) (*TransitionInputs, error) {
+	i.mu.Lock()
+	inputs, newTreeState, err := i.buildStateTransitionInputs(apply)
+	i.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if inputs.OldTreeState.State.Equals(inputs.NewState) {
+		return nil, errors.New("nothing to update")
+	}
+
+	inputsJSON, err := inputs.InputsMarshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return &TransitionInputs{StateTransitionInputs: inputs, JSON: inputsJSON, NewTreeState: newTreeState}, nil
+}
+
+// BuildStateTransitionInputs assembles the inputs of the state transition circuit for the transition from the
+// committed state to the latest state: both states, the inclusion and non revocation proofs of the auth claim and
+// the signature over the states. The inputs are reused by later calls while both states stay the same.
+func (i *Identity) BuildStateTransitionInputs() (*circuits.StateTransitionInputs, error) {
+	logger.Debug("BuildStateTransitionInputs() invoked")
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	inputs, _, err := i.buildStateTransitionInputs(true)
+	return inputs, err
+}
+
+// buildStateTransitionInputs is BuildStateTransitionInputs for a caller holding mu, it also returns the roots of the
+// new state. The claims tree root of the committed state is added to the roots tree when apply is set, a dry run
+// computes the new state as if it was added instead.
+func (i *Identity) buildStateTransitionInputs(apply bool) (*circuits.StateTransitionInputs, circuits.TreeState, error) {
+	i.transitionInputs.mu.Lock()
+	defer i.transitionInputs.mu.Unlock()
+
+	oldState, err := circuitsState(i.state.SnapshotCommittedState())
+	if err != nil {
+		return nil, circuits.TreeState{}, err
+	}
+
+	newTreeState := circuits.TreeState{
+		ClaimsRoot:     i.state.Claims.Tree.Root(),
+		RevocationRoot: i.state.Revocations.Tree.Root(),
+	}
+	if apply {
+		// the claims root may be in the roots tree already, when a previous transition to this state wasn't published
+		err = i.state.AddRootToTree(oldState.ClaimsRoot)
+		if err != nil && !errors.Is(err, merkletree.ErrEntryIndexAlreadyExists) {
+			return nil, circuits.TreeState{}, err
+		}
+		newTreeState.RootOfRoots = i.state.Roots.Tree.Root()
+	} else {
+		newTreeState.RootOfRoots, err = i.state.RootsRootWith(oldState.ClaimsRoot)
+		if err != nil {
+			return nil, circuits.TreeState{}, err
+		}
+	}
+
+	newState, err := merkletree.HashElems(newTreeState.ClaimsRoot.BigInt(), newTreeState.RevocationRoot.BigInt(), newTreeState.RootOfRoots.BigInt())
+	if err != nil {
+		return nil, circuits.TreeState{}, err
+	}
+	newTreeState.State = newState
+
+	cache := &i.transitionInputs
+	if cache.inputs != nil && cache.oldState.Equals(oldState.State) && cache.newState.Equals(newState) {
+		logger.Debug("reusing the cached state transition inputs")
+		return cache.inputs, newTreeState, nil
+	}
+
+	coreAuthClaim := i.authCoreClaim()
+	authInclusionProof, _, err := i.state.GetInclusionProof(coreAuthClaim)
+	if err != nil {
+		return nil, circuits.TreeState{}, err
+	}
+
+	authNonRevocationProof, _, err := i.state.GetRevocationProof(coreAuthClaim)
+	if err != nil {
+		return nil, circuits.TreeState{}, err
+	}
+
+	authClaim := circuits.Claim{
+		Claim:     coreAuthClaim,
+		TreeState: oldState,
+		Proof:     authInclusionProof,
+		NonRevProof: &circuits.ClaimNonRevStatus{
+			TreeState: oldState,
+			Proof:     authNonRevocationProof,
+		},
+	}
+
+	hashOldAndNewStates, err := poseidon.Hash(
+		[]*big.Int{oldState.State.BigInt(), newState.BigInt()})
+	if err != nil {
+		return nil, circuits.TreeState{}, err
+	}
+
+	signature := i.sk.SignPoseidon(hashOldAndNewStates)
+
+	isOldStateGenesis, err := i.isOldStateGenesis()
+	if err != nil {
+		return nil, circuits.TreeState{}, err
+	}
+
+	inputs := &circuits.StateTransitionInputs{
+		ID:                i.Identifier(),
+		NewState:          newState,
+		OldTreeState:      oldState,
+		IsOldStateGenesis: isOldStateGenesis,
+
+		AuthClaim: authClaim,
+
+		Signature: signature,
+	}
+
+	cache.oldState = oldState.State
+	cache.newState = newState
+	cache.inputs = inputs
+
+	return inputs, newTreeState, nil
+}
+
+// isOldStateGenesis tells whether a transition starts from the genesis state, which is the case until a state of
+// the identity is confirmed on chain
+func (i *Identity) isOldStateGenesis() (bool, error) {
+	lastPublished, err := i.state.GetLastPublishedState()
+	if err != nil {
+		return false, err
+	}
+
+	return lastPublished == nil, nil
+}
+
+// restoreCommittedState sets the committed state of a loaded identity to the roots of its last published state, or of
+// its genesis state when it never published. The trees may have grown past it with the claims issued since.
+func (i *Identity) restoreCommittedState() error {
+	lastPublished, err := i.backfillLastPublishedState()
+	if err != nil {
+		return err
+	}
+
+	st := lastPublished
+	if st == nil {
+		st, err = i.state.GetGenesisState()
+		if err != nil {
+			return err
+		}
+	}
+
+	var committed state.CommittedState
+	if st != nil {
+		committed, err = i.state.StateRoots(st)
+	}
+	if st == nil || errors.Is(err, state.ErrUnknownState) {
+		// saved before the roots were recorded along with the states, only the trees as they are can be committed
+		logger.Warnf("the roots of the committed state of %s are unknown, the latest roots are committed instead", i.Identifier())
+		committed, err = state.CommittedState{
+			RootsTreeRoot:      i.state.Roots.Tree.Root(),
+			ClaimsTreeRoot:     i.state.Claims.Tree.Root(),
+			RevocationTreeRoot: i.state.Revocations.Tree.Root(),
+		}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	committed.IsLatestStateGenesis = lastPublished == nil
+	return i.state.SetCommittedState(committed)
+}
+
+// backfillLastPublishedState returns the last published state of the identity. An identity saved before it was
+// recorded gets it from its last confirmed transition, or from the chain when no transition was recorded either.
+func (i *Identity) backfillLastPublishedState() (*merkletree.Hash, error) {
+	lastPublished, err := i.state.GetLastPublishedState()
+	if err != nil || lastPublished != nil {
+		return lastPublished, err
+	}
+
+	transitions, err := i.state.GetStateTransitions()
+	if err != nil {
+		return nil, err
+	}
+	if len(transitions) > 0 {
+		lastPublished, err = merkletree.NewHashFromHex(transitions[len(transitions)-1].NewState)
+		if err != nil {
+			return nil, err
+		}
+	} else if i.stateStore != nil {
+		ctx, cancel := i.publishContext(context.Background())
+		defer cancel()
+		onChain, err := i.stateStore.GetLatestState(ctx, i.Identifier())
+		if err != nil {
+			// taken as unpublished until the next start tries again
+			logger.Warnf("can't get the on-chain state of %s to backfill its last published state, err: %v", i.Identifier(), err)
+			return nil, nil
+		}
+		genesisState, err := i.state.GetGenesisState()
+		if err != nil {
+			return nil, err
+		}
+		if onChain != nil && (genesisState == nil || !onChain.State.Equals(genesisState)) {
+			lastPublished = onChain.State
+		}
+	}
+	if lastPublished == nil {
+		return nil, nil
+	}
+
+	return lastPublished, i.state.SetLastPublishedState(lastPublished)
+}
+
+// publishContext bounds a call to the blockchain with the publish timeout, a zero timeout leaves it unbounded
+func (i *Identity) publishContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if i.publishTimeout > 0 {
+		return context.WithTimeout(parent, i.publishTimeout)
+	}
+	return context.WithCancel(parent)
+}
@@ -0,0 +1,69 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestPrepareStateTransitionDryRun checks a dry run leaves the state as it is and proves the same new state as the
+// transition prepared for publishing
+func TestPrepareStateTransitionDryRun(t *testing.T) {
+	iden := newTestIdentity(t)
+	issueTestClaim(t, iden)
+
+	before, err := iden.state.GetStateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dryRun, err := iden.prepareStateTransition(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := iden.state.GetStateHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.Equals(before) {
+		t.Fatalf("the dry run changed the state from %s to %s", before.Hex(), after.Hex())
+	}
+
+	applied, err := iden.prepareStateTransition(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dryRun.NewState.Equals(applied.NewState) {
+		t.Errorf("the dry run proves the state %s, want %s", dryRun.NewState.Hex(), applied.NewState.Hex())
+	}
+	if !dryRun.NewTreeState.RootOfRoots.Equals(iden.state.Roots.Tree.Root()) {
+		t.Errorf("the dry run gives the roots root %s, want %s", dryRun.NewTreeState.RootOfRoots.Hex(), iden.state.Roots.Tree.Root().Hex())
+	}
+}
+
+// TestPublishingDisabled runs an identity without a state store, the operations needing the blockchain fail with
+// ErrPublishingDisabled and the readiness doesn't check it
+func TestPublishingDisabled(t *testing.T) {
+	iden := newTestIdentity(t)
+	issueTestClaim(t, iden)
+
+	_, err := iden.PublishLatestState(context.Background())
+	if !errors.Is(err, ErrPublishingDisabled) {
+		t.Errorf("PublishLatestState() err = %v, want ErrPublishingDisabled", err)
+	}
+	_, err = iden.BuildPublishPayload(context.Background())
+	if !errors.Is(err, ErrPublishingDisabled) {
+		t.Errorf("BuildPublishPayload() err = %v, want ErrPublishingDisabled", err)
+	}
+	_, err = iden.VerifyOnChainState(context.Background())
+	if !errors.Is(err, ErrPublishingDisabled) {
+		t.Errorf("VerifyOnChainState() err = %v, want ErrPublishingDisabled", err)
+	}
+
+	res := iden.Readiness(context.Background())
+	for _, dep := range res.Checks {
+		if dep.Name == "blockchain" {
+			t.Error("the readiness checks the blockchain with publishing disabled")
+		}
+	}
+}
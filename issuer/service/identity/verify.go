@@ -0,0 +1,68 @@
+package identity
+
+import (
+	"fmt"
+	"github.com/iden3/go-merkletree-sql"
+	logger "github.com/sirupsen/logrus"
+	issuer_contract "issuer/service/models"
+	"math/big"
+)
+
+// revocationLeafValue is the value the revocation tree holds for every revoked nonce
+var revocationLeafValue = big.NewInt(0)
+
+// VerifyRevocationStatus checks that the state of the revocation status is composed of its roots and that the
+// proof of (non) membership of the nonce resolves to the revocation tree root. It doesn't compare the state with
+// the state of this issuer, so statuses of any issuer can be checked.
+func (i *Identity) VerifyRevocationStatus(req *issuer_contract.VerifyRevocationStatusRequest) (*issuer_contract.VerifyRevocationStatusResponse, error) {
+	logger.Debug("VerifyRevocationStatus() invoked")
+
+	invalid := func(format string, args ...interface{}) (*issuer_contract.VerifyRevocationStatusResponse, error) {
+		return &issuer_contract.VerifyRevocationStatusResponse{Reason: fmt.Sprintf(format, args...)}, nil
+	}
+
+	if req.Status.MTP == nil {
+		return invalid("revocation status has no mtp")
+	}
+
+	format, err := ParseHashFormat(req.Format)
+	if err != nil {
+		return invalid("%v", err)
+	}
+
+	issuer := req.Status.Issuer
+	claimsRoot, err := format.Parse(issuer.ClaimsTreeRoot)
+	if err != nil {
+		return invalid("invalid claims tree root: %v", err)
+	}
+	revRoot, err := format.Parse(issuer.RevocationTreeRoot)
+	if err != nil {
+		return invalid("invalid revocation tree root: %v", err)
+	}
+	rootsRoot, err := format.Parse(issuer.RootOfRoots)
+	if err != nil {
+		return invalid("invalid root of roots: %v", err)
+	}
+	stateHash, err := format.Parse(issuer.State)
+	if err != nil {
+		return invalid("invalid state: %v", err)
+	}
+
+	composed, err := merkletree.HashElems(claimsRoot.BigInt(), revRoot.BigInt(), rootsRoot.BigInt())
+	if err != nil {
+		return nil, err
+	}
+	if !composed.Equals(stateHash) {
+		return invalid("state %s doesn't match the state composed of the roots %s", stateHash.Hex(), composed.Hex())
+	}
+
+	nonce := new(big.Int).SetUint64(req.Nonce)
+	if !merkletree.VerifyProof(revRoot, req.Status.MTP, nonce, revocationLeafValue) {
+		return invalid("mtp of nonce %d doesn't resolve to the revocation tree root %s", req.Nonce, revRoot.Hex())
+	}
+
+	return &issuer_contract.VerifyRevocationStatusResponse{
+		Valid:   true,
+		Revoked: req.Status.MTP.Existence,
+	}, nil
+}
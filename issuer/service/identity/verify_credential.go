@@ -0,0 +1,67 @@
+package identity
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/iden3/go-merkletree-sql"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"issuer/db"
+	issuer_contract "issuer/service/models"
+	"time"
+)
+
+// VerifyCredential checks the claim against the latest trees of the issuer, so a verifier can ask whether the
+// credential is still valid without checking a ZK proof: the inclusion proof of the claim verifies against the
+// latest claims root, its revocation nonce isn't in the latest revocation tree and it isn't expired. The trees are
+// read at a single point in time.
+func (i *Identity) VerifyCredential(claimID string) (*issuer_contract.CredentialVerification, error) {
+	logger.Debugf("VerifyCredential() invoked with claim %s", claimID)
+
+	id, err := uuid.Parse(claimID)
+	if err != nil {
+		return nil, errors.Wrapf(ErrClaimNotFound, "invalid claim id '%s', %v", claimID, err)
+	}
+	claimModel, err := i.state.Claims.GetClaim(id)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		return nil, errors.Wrapf(ErrClaimNotFound, "claim %s", claimID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := i.state.DebugClaim(claimModel.CoreClaim, claimModel.RevNonce)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &issuer_contract.CredentialVerification{ID: claimModel.ID.String(), State: d.LatestState.Hex()}
+
+	if claimModel.SignatureOnly {
+		// the signature proof is the only proof of the claim
+		res.Checks.Inclusion = issuer_contract.VerificationCheck{Passed: true, Detail: "signature-only claim, it isn't in the claims tree"}
+	} else {
+		hi, hv, err := claimModel.CoreClaim.HiHv()
+		if err != nil {
+			return nil, err
+		}
+		res.Checks.Inclusion.Passed = merkletree.VerifyProof(d.LatestClaimsRoot, d.InclusionProof, hi, hv)
+		if !res.Checks.Inclusion.Passed {
+			res.Checks.Inclusion.Detail = fmt.Sprintf("the claim isn't in the claims tree of root %s", d.LatestClaimsRoot.Hex())
+		}
+	}
+
+	res.Checks.NotRevoked.Passed = !d.RevocationProof.Existence
+	if !res.Checks.NotRevoked.Passed {
+		res.Checks.NotRevoked.Detail = fmt.Sprintf("revocation nonce %d is in the revocation tree of root %s",
+			claimModel.RevNonce, d.LatestRevocationRoot.Hex())
+	}
+
+	res.Checks.NotExpired.Passed = claimModel.Expiration == 0 || time.Now().Unix() < claimModel.Expiration
+	if !res.Checks.NotExpired.Passed {
+		res.Checks.NotExpired.Detail = fmt.Sprintf("expired at %s", time.Unix(claimModel.Expiration, 0).UTC().Format(time.RFC3339))
+	}
+
+	res.Valid = res.Checks.Inclusion.Passed && res.Checks.NotRevoked.Passed && res.Checks.NotExpired.Passed
+	return res, nil
+}
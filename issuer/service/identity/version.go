@@ -0,0 +1,31 @@
+package identity
+
+import (
+	core "github.com/iden3/go-iden3-core"
+	logger "github.com/sirupsen/logrus"
+)
+
+// nextVersion returns the version that follows the highest version of the claims of the type issued to the subject,
+// 0 when the subject holds none
+func (i *Identity) nextVersion(subjectID, schemaType string) (uint32, error) {
+	logger.Debugf("nextVersion() invoked for a claim of type %s", schemaType)
+
+	subject, err := core.IDFromString(subjectID)
+	if err != nil {
+		return 0, err
+	}
+
+	claims, err := i.state.GetClaimsBySubject(subject.String())
+	if err != nil {
+		return 0, err
+	}
+
+	var next uint32
+	for _, c := range claims {
+		if c.SchemaType == schemaType && c.Version >= next {
+			next = c.Version + 1
+		}
+	}
+
+	return next, nil
+}
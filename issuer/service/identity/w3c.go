@@ -0,0 +1,95 @@
+package identity
+
+import (
+	"github.com/google/uuid"
+	core "github.com/iden3/go-iden3-core"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	"issuer/db"
+	"issuer/service/claim"
+	issuer_contract "issuer/service/models"
+	"issuer/service/schema"
+	"time"
+)
+
+const (
+	// W3CCredentialsContext is the base context of the W3C Verifiable Credentials
+	W3CCredentialsContext = "https://www.w3.org/2018/credentials/v1"
+	// W3CVerifiableCredential is the base type of the W3C Verifiable Credentials
+	W3CVerifiableCredential = "VerifiableCredential"
+)
+
+// GetW3CCredential renders the claim as a W3C Verifiable Credential. Its proofs are the BJJ signature proof and, once
+// a state including the claim is published, the MTP proof, both when the claim has both.
+func (i *Identity) GetW3CCredential(id string) (*issuer_contract.W3CCredential, error) {
+	logger.Debug("GetW3CCredential() invoked")
+
+	claimID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors.Wrapf(ErrClaimNotFound, "invalid claim id '%s', %v", id, err)
+	}
+
+	claimModel, err := i.state.Claims.GetClaim(claimID)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		return nil, errors.Wrapf(ErrClaimNotFound, "claim %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = i.attachMTPProof(claimModel)
+	if err != nil {
+		return nil, err
+	}
+
+	return i.w3cCredential(claimModel)
+}
+
+// w3cCredential converts the claim to its W3C form. The subject identifier is given as a DID, the read-only form as
+// the network of the subject isn't recorded.
+func (i *Identity) w3cCredential(claimModel *claim.Claim) (*issuer_contract.W3CCredential, error) {
+	c, err := claim.ClaimModelToIden3Credential(claimModel)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := c.CredentialSubject
+	if claimModel.OtherIdentifier != "" {
+		subjectID, err := core.IDFromString(claimModel.OtherIdentifier)
+		if err != nil {
+			return nil, err
+		}
+		subject["id"] = DID(&subjectID, "", "")
+	}
+
+	proofs, ok := c.Proof.([]interface{})
+	if !ok {
+		return nil, errors.Errorf("unexpected proofs of claim %s", claimModel.ID)
+	}
+
+	res := &issuer_contract.W3CCredential{
+		Context:           []string{W3CCredentialsContext, schema.Iden3CredentialSchemaURL, claimModel.SchemaURL},
+		ID:                claim.CredentialURN(claimModel.ID),
+		Type:              []string{W3CVerifiableCredential, claimModel.SchemaType},
+		Issuer:            DID(i.Identifier(), i.blockchain, i.network),
+		CredentialSubject: subject,
+		CredentialSchema: issuer_contract.W3CCredentialSchema{
+			ID:   claimModel.SchemaURL,
+			Type: claimModel.SchemaType,
+		},
+		Proof: proofs,
+	}
+	if c.CredentialStatus != nil && c.CredentialStatus.ID != "" {
+		res.CredentialStatus = c.CredentialStatus
+	}
+	if claimModel.IssuanceDate != 0 {
+		issuedAt := time.Unix(claimModel.IssuanceDate, 0).UTC()
+		res.IssuanceDate = &issuedAt
+	}
+	if claimModel.Expiration != 0 {
+		expiresAt := time.Unix(claimModel.Expiration, 0).UTC()
+		res.ExpirationDate = &expiresAt
+	}
+
+	return res, nil
+}
@@ -0,0 +1,78 @@
+package janitor
+
+import (
+	"context"
+	logger "github.com/sirupsen/logrus"
+	"issuer/service/metrics"
+	"sync"
+	"time"
+)
+
+// Task evicts the expired entries of a store and returns the number of evicted entries
+type Task func() (int, error)
+
+type namedTask struct {
+	name string
+	run  Task
+}
+
+// Janitor runs the registered eviction tasks every interval, so the stores of the issuer don't grow unbounded
+type Janitor struct {
+	interval time.Duration
+
+	mu    sync.Mutex
+	tasks []namedTask
+}
+
+func New(interval time.Duration) *Janitor {
+	return &Janitor{
+		interval: interval,
+	}
+}
+
+// Register adds a task that runs on every sweep, tasks run in the order they were registered
+func (j *Janitor) Register(name string, t Task) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.tasks = append(j.tasks, namedTask{name: name, run: t})
+}
+
+// Run sweeps every interval until the context is done
+func (j *Janitor) Run(ctx context.Context) {
+	logger.Infof("janitor sweeps every %v", j.interval)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Debug("janitor stopped")
+			return
+		case <-ticker.C:
+			j.Sweep()
+		}
+	}
+}
+
+// Sweep runs every registered task once, a failing task doesn't stop the others
+func (j *Janitor) Sweep() {
+	j.mu.Lock()
+	tasks := append([]namedTask{}, j.tasks...)
+	j.mu.Unlock()
+
+	for _, t := range tasks {
+		n, err := t.run()
+		if err != nil {
+			logger.Errorf("janitor task %s failed, err: %v", t.name, err)
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+
+		logger.Infof("janitor task %s evicted %d entries", t.name, n)
+		metrics.JanitorEvicted.WithLabelValues(t.name).Add(float64(n))
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"fmt"
+	logger "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// initGlobalLogger sets up the level, format and output of the logs. The returned func stops reopening the log file
+// on SIGHUP and closes it.
+func initGlobalLogger(level, format, output string) (func(), error) {
+	logLevel, err := logger.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	var formatter logger.Formatter
+	switch format {
+	case "json":
+		formatter = &logger.JSONFormatter{TimestampFormat: time.RFC3339Nano}
+	case "text":
+		// colorized when writing to a terminal
+		formatter = &logger.TextFormatter{FullTimestamp: true, TimestampFormat: time.RFC3339Nano}
+	default:
+		return nil, fmt.Errorf("unsupported log format %s", format)
+	}
+
+	var out io.Writer
+	stop := func() {}
+	switch output {
+	case "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		f, err := openLogFile(output)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+		stop = f.reopenOnSIGHUP()
+	}
+
+	logger.SetLevel(logLevel)
+	logger.SetFormatter(formatter)
+	logger.SetOutput(out)
+	return stop, nil
+}
+
+// logFile is the file the logs are appended to, it's reopened once moved away by a log rotation
+type logFile struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+func openLogFile(path string) (*logFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("can't open the log file %s, %w", path, err)
+	}
+	return &logFile{path: path, f: f}, nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Write(p)
+}
+
+// reopen switches to a new file at the path, the logs keep going to the previous one when it can't be opened
+func (l *logFile) reopen() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	prev := l.f
+	l.f = f
+	l.mu.Unlock()
+
+	return prev.Close()
+}
+
+func (l *logFile) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// reopenOnSIGHUP reopens the file on every SIGHUP until the returned func is called, which closes the file
+func (l *logFile) reopenOnSIGHUP() func() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-hup:
+				err := l.reopen()
+				if err != nil {
+					logger.Errorf("can't reopen the log file %s, err: %v", l.path, err)
+					continue
+				}
+				logger.Infof("log file %s reopened", l.path)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(hup)
+			close(done)
+			// the logs of the rest of the shutdown aren't lost
+			logger.SetOutput(os.Stderr)
+			if err := l.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "can't close the log file %s, err: %v\n", l.path, err)
+			}
+		})
+	}
+}
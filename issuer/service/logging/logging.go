@@ -0,0 +1,26 @@
+// Package logging carries the logger of a request in its context, so the logs of the layers serving it share the
+// request ID and can be grepped together
+package logging
+
+import (
+	"context"
+	logger "github.com/sirupsen/logrus"
+)
+
+// RequestIDField is the field of the logs holding the ID of the request they were written for
+const RequestIDField = "request_id"
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying the logger
+func NewContext(ctx context.Context, l *logger.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the global logger when it carries none
+func FromContext(ctx context.Context) *logger.Entry {
+	if l, ok := ctx.Value(loggerKey{}).(*logger.Entry); ok {
+		return l
+	}
+	return logger.NewEntry(logger.StandardLogger())
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+const namespace = "issuer"
+
+// Result labels of the operations that can fail
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+var (
+	// ClaimsIssued counts the claims added and saved, whether they go in the claims tree or are signature-only
+	ClaimsIssued = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "claims_issued_total",
+		Help:      "Claims issued.",
+	})
+
+	// ClaimsRevoked counts the claims whose revocation nonce was added to the revocation tree
+	ClaimsRevoked = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "claims_revoked_total",
+		Help:      "Claims revoked.",
+	})
+
+	// JanitorEvicted counts the entries the janitor tasks evicted, the tasks are named after the store they sweep
+	JanitorEvicted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "janitor_evicted_total",
+		Help:      "Entries evicted by the janitor, by task.",
+	}, []string{"task"})
+
+	// SchemaLoadDuration is the time a schema took to load, from the cache, the disk or downloaded
+	SchemaLoadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "schema_load_duration_seconds",
+		Help:      "Time a schema took to load, by result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+
+	// SchemaLoadsInFlight is the number of schema loads holding a slot of the concurrent load limit
+	SchemaLoadsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "schema_loads_in_flight",
+		Help:      "Schema loads running.",
+	})
+
+	// TransitionsSubmitted counts the state transition transactions sent to the state contract
+	TransitionsSubmitted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "state_transitions_submitted_total",
+		Help:      "State transition transactions submitted, by result.",
+	}, []string{"result"})
+
+	// TxConfirmationDuration is the time a state transition transaction took to be confirmed after it was sent.
+	// Blocks take seconds and the confirmations minutes, the buckets go from 5s to about 20m.
+	TxConfirmationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tx_confirmation_duration_seconds",
+		Help:      "Time a state transition transaction took to be confirmed, by result.",
+		Buckets:   prometheus.ExponentialBuckets(5, 2, 9),
+	}, []string{"result"})
+)
+
+// Result is the result label of an operation returning err
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultOK
+}
+
+// ObserveSince records the time elapsed since start in the histogram, labelled with the result of err
+func ObserveSince(h *prometheus.HistogramVec, start time.Time, err error) {
+	h.WithLabelValues(Result(err)).Observe(time.Since(start).Seconds())
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
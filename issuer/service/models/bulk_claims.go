@@ -0,0 +1,14 @@
+package models
+
+// BulkClaimsResponse holds the result of every row of a bulk issuance, in the order of the rows
+type BulkClaimsResponse struct {
+	Issued  int                `codec:"issued"`
+	Results []*BulkClaimResult `codec:"results"`
+}
+
+// BulkClaimResult is either the id of the claim issued from the row or the reason it wasn't issued
+type BulkClaimResult struct {
+	Row   int    `codec:"row"`
+	ID    string `codec:"id,omitempty"`
+	Error string `codec:"error,omitempty"`
+}
@@ -3,16 +3,43 @@ package models
 import "encoding/json"
 
 type CreateClaimRequest struct {
-	Schema          *Schema         `codec:"schema"`
-	Data            json.RawMessage `codec:"data"`
-	Identifier      string          `codec:"identifier"`
-	Expiration      int64           `codec:"expiration"`
-	Version         uint32          `codec:"version"`
-	RevNonce        *uint64         `codec:"revNonce"`
-	SubjectPosition string          `codec:"subjectPosition"`
+	Schema     *Schema         `codec:"schema"`
+	Data       json.RawMessage `codec:"data"`
+	Identifier string          `codec:"identifier"`
+	Expiration int64           `codec:"expiration"`
+	// AllowPastExpiration issues a credential that is already expired, e.g. to backfill a credential history
+	AllowPastExpiration bool `codec:"allowPastExpiration"`
+	// IssuanceDate is the optional unix timestamp the credential is issued at, the expiration must be after it.
+	// It defaults to the time of the request.
+	IssuanceDate int64 `codec:"issuanceDate"`
+	// Version defaults to the version following the ones of the claims of the type issued to the subject
+	Version         *uint32 `codec:"version"`
+	RevNonce        *uint64 `codec:"revNonce"`
+	SubjectPosition string  `codec:"subjectPosition"`
+	// Evidence is the optional id of an already issued credential that the new credential references
+	Evidence string `codec:"evidence"`
+	// ProofType is SparseMerkleTreeProof (the default) for a credential added to the claims tree, or BJJSignature
+	// for a credential only signed by the issuer, valid without publishing a state
+	ProofType string `codec:"proofType"`
+	// CredentialStatusType is SparseMerkleTreeProof (the default) for a revocation checked on the issuer, or
+	// Iden3ReverseSparseMerkleTreeProof for a revocation checked on the reverse hash service against the published state
+	CredentialStatusType string `codec:"credentialStatusType"`
 }
 
 type Schema struct {
 	URL  string `codec:"url"`
 	Type string `codec:"type"`
+	// ExpectedSchemaHash is the optional hex schema hash the downloaded schema must have, so a changed remote
+	// schema can't alter the slots of the claims
+	ExpectedSchemaHash string `codec:"expectedSchemaHash"`
+}
+
+// CreateClaimFromTemplateRequest holds the parts of a claim request that a template doesn't pre-fill
+type CreateClaimFromTemplateRequest struct {
+	Data       json.RawMessage `codec:"data"`
+	Identifier string          `codec:"identifier"`
+	// Expiration overrides the expiration derived from the template, as a unix timestamp
+	Expiration int64   `codec:"expiration"`
+	RevNonce   *uint64 `codec:"revNonce"`
+	Evidence   string  `codec:"evidence"`
 }
@@ -2,4 +2,7 @@ package models
 
 type CreateClaimResponse struct {
 	ID string `codec:"id"`
+	// SchemaHash is the hex hash of the schema embedded in the core claim, it identifies the schema version the
+	// claim was issued against
+	SchemaHash string `codec:"schemaHash"`
 }
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/iden3/go-merkletree-sql"
+)
+
+// DebugClaimResponse is the raw state around a claim, meant for troubleshooting a credential that fails to verify
+type DebugClaimResponse struct {
+	Identifier string `codec:"identifier"`
+
+	Latest    DebugTreeState `codec:"latest"`
+	Committed DebugTreeState `codec:"committed"`
+
+	AuthClaim DebugClaim `codec:"authClaim"`
+	Claim     DebugClaim `codec:"claim"`
+
+	InclusionProof           *merkletree.Proof `codec:"inclusionProof"`
+	RevocationProof          *merkletree.Proof `codec:"revocationProof"`
+	CommittedInclusionProof  *merkletree.Proof `codec:"committedInclusionProof"`
+	CommittedRevocationProof *merkletree.Proof `codec:"committedRevocationProof"`
+}
+
+// DebugTreeState holds the roots of the trees and the state composed from them
+type DebugTreeState struct {
+	State              string `codec:"state"`
+	ClaimsTreeRoot     string `codec:"claimsTreeRoot"`
+	RevocationTreeRoot string `codec:"revocationTreeRoot"`
+	RootOfRoots        string `codec:"rootOfRoots"`
+	// TxID, BlockNumber and BlockTimestamp are set on the committed state once it's published
+	TxID           string `codec:"txId,omitempty"`
+	BlockNumber    uint64 `codec:"blockNumber,omitempty"`
+	BlockTimestamp uint64 `codec:"blockTimestamp,omitempty"`
+}
+
+// DebugClaim is the stored model of a claim along with its raw entry
+type DebugClaim struct {
+	ID              string          `codec:"id"`
+	SchemaURL       string          `codec:"schemaUrl,omitempty"`
+	SchemaType      string          `codec:"schemaType,omitempty"`
+	SchemaHash      string          `codec:"schemaHash"`
+	OtherIdentifier string          `codec:"otherIdentifier,omitempty"`
+	Expiration      int64           `codec:"expiration,omitempty"`
+	Revoked         bool            `codec:"revoked"`
+	Version         uint32          `codec:"version"`
+	RevNonce        uint64          `codec:"revNonce"`
+	HIndex          string          `codec:"hIndex"`
+	Status          string          `codec:"status,omitempty"`
+	Entry           []string        `codec:"entry"`
+	Data            json.RawMessage `codec:"data,omitempty"`
+	MTPProof        json.RawMessage `codec:"mtpProof,omitempty"`
+	SignatureProof  json.RawMessage `codec:"signatureProof,omitempty"`
+}
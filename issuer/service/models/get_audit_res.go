@@ -0,0 +1,19 @@
+package models
+
+type GetAuditLogResponse struct {
+	Valid bool `codec:"valid"`
+	// BrokenAt is the sequence number of the first entry that breaks the hash chain
+	BrokenAt uint64         `codec:"brokenAt,omitempty"`
+	Entries  []*AuditRecord `codec:"entries"`
+}
+
+type AuditRecord struct {
+	Seq       uint64 `codec:"seq"`
+	Event     string `codec:"event"`
+	ClaimID   string `codec:"claimId"`
+	RevNonce  uint64 `codec:"revNonce"`
+	State     string `codec:"state"`
+	Timestamp int64  `codec:"timestamp"`
+	PrevHash  string `codec:"prevHash"`
+	Hash      string `codec:"hash"`
+}
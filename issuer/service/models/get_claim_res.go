@@ -1,7 +1,16 @@
 package models
 
 import (
+	"time"
+
 	"github.com/iden3/go-schema-processor/verifiable"
 )
 
-type GetClaimResponse *verifiable.Iden3Credential
+// GetClaimResponse is the credential along with whether it's expired, so holders and verifiers don't have to read
+// the expiration out of the claim slots
+type GetClaimResponse struct {
+	*verifiable.Iden3Credential
+	Expired bool `codec:"expired"`
+	// ExpiresAt is nil for a credential that doesn't expire
+	ExpiresAt *time.Time `codec:"expiresAt,omitempty"`
+}
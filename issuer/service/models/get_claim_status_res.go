@@ -0,0 +1,25 @@
+package models
+
+import "github.com/iden3/go-merkletree-sql"
+
+// GetClaimStatusResponse tells whether a credential is currently valid: not revoked in the committed state of the
+// issuer, not expired, and whether the issuer's latest state is the one published on-chain
+type GetClaimStatusResponse struct {
+	ID    string `codec:"id"`
+	Valid bool   `codec:"valid"`
+
+	Revoked         bool              `codec:"revoked"`
+	RevocationProof *merkletree.Proof `codec:"revocationProof"`
+
+	Expired    bool  `codec:"expired"`
+	Expiration int64 `codec:"expiration,omitempty"`
+
+	Issuer struct {
+		State              string `codec:"state"`
+		RevocationTreeRoot string `codec:"revocationTreeRoot"`
+		// OnChainState is empty when the issuer never published its state
+		OnChainState string `codec:"onChainState,omitempty"`
+		// Published is true when the latest local state is the on-chain state, nothing is waiting to be published
+		Published bool `codec:"published"`
+	} `codec:"issuer"`
+}
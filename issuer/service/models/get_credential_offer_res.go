@@ -0,0 +1,10 @@
+package models
+
+import "github.com/iden3/iden3comm/protocol"
+
+// GetCredentialOfferResponse is the offer message of a credential along with the universal link encoding it, the
+// payload of the QR code handed to the wallet
+type GetCredentialOfferResponse struct {
+	Offer     *protocol.CredentialsOfferMessage `codec:"offer"`
+	QRPayload string                            `codec:"qrPayload"`
+}
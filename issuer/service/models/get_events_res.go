@@ -0,0 +1,17 @@
+package models
+
+type GetEventsResponse struct {
+	Events []*EventRecord `codec:"events"`
+	// NextOffset is the offset to request the following events with, it's the since offset when there are no new events
+	NextOffset uint64 `codec:"nextOffset"`
+}
+
+type EventRecord struct {
+	Offset     uint64 `codec:"offset"`
+	Type       string `codec:"type"`
+	ClaimID    string `codec:"claimId"`
+	SchemaType string `codec:"schemaType"`
+	RevNonce   uint64 `codec:"revNonce"`
+	Timestamp  int64  `codec:"timestamp"`
+	TxID       string `codec:"txId,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+// Statuses of the issuer and of its dependencies
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusUnavailable = "unavailable"
+)
+
+// HealthResponse is the status of the issuer, along with the status of each dependency for the readiness
+type HealthResponse struct {
+	Status string              `codec:"status"`
+	Checks []*DependencyStatus `codec:"checks,omitempty"`
+}
+
+type DependencyStatus struct {
+	Name   string `codec:"name"`
+	Status string `codec:"status"`
+	Error  string `codec:"error,omitempty"`
+}
@@ -2,6 +2,7 @@ package models
 
 type GetIdentityResponse struct {
 	Identifier string         `codec:"Identifier"`
+	DID        string         `codec:"DID"`
 	State      *IdentityState `codec:"State"`
 }
 
@@ -13,3 +14,18 @@ type IdentityState struct {
 	ClaimsTreeRoot     string `codec:"ClaimsTreeRoot"`
 	RevocationTreeRoot string `codec:"RevocationTreeRoot"`
 }
+
+type GetGenesisResponse struct {
+	Identifier   string `codec:"identifier"`
+	GenesisState string `codec:"genesisState"`
+	Published    bool   `codec:"published"`
+}
+
+// PublishPayloadResponse is the transitState call data of the transition to the latest state, hex encoded
+type PublishPayloadResponse struct {
+	Identifier        string `codec:"identifier"`
+	LatestState       string `codec:"latestState"`
+	NewState          string `codec:"newState"`
+	IsOldStateGenesis bool   `codec:"isOldStateGenesis"`
+	Payload           string `codec:"payload"`
+}
@@ -0,0 +1,16 @@
+package models
+
+// JSONWebKeySet is the issuer's JWK set, served at /.well-known/jwks.json
+type JSONWebKeySet struct {
+	Keys []*JSONWebKey `codec:"keys"`
+}
+
+// JSONWebKey is a BabyJubJub public key in JWK form. x and y are the base64url encoded (big-endian) coordinates.
+type JSONWebKey struct {
+	Kty string `codec:"kty"`
+	Crv string `codec:"crv"`
+	Kid string `codec:"kid"`
+	Use string `codec:"use"`
+	X   string `codec:"x"`
+	Y   string `codec:"y"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "github.com/iden3/go-merkletree-sql"
+
+// GetProofBundleResponse is a self-contained set of proofs for a single claim, all anchored at
+// the same (published) issuer state, that can be checked offline against the on-chain state
+type GetProofBundleResponse struct {
+	Issuer struct {
+		ID                 string `codec:"id"`
+		State              string `codec:"state"`
+		RootOfRoots        string `codec:"root_of_roots"`
+		ClaimsTreeRoot     string `codec:"claims_tree_root"`
+		RevocationTreeRoot string `codec:"revocation_tree_root"`
+		TxID               string `codec:"tx_id,omitempty"`
+		BlockNumber        uint64 `codec:"block_number,omitempty"`
+		BlockTimestamp     uint64 `codec:"block_timestamp,omitempty"`
+	} `codec:"issuer"`
+	Claim struct {
+		ID       string `codec:"id"`
+		HIndex   string `codec:"h_index"`
+		HValue   string `codec:"h_value"`
+		RevNonce uint64 `codec:"rev_nonce"`
+	} `codec:"claim"`
+	InclusionProof  *merkletree.Proof `codec:"inclusion_proof"`
+	RevocationProof *merkletree.Proof `codec:"revocation_proof"`
+}
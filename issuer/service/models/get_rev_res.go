@@ -12,3 +12,37 @@ type GetRevocationStatusResponse struct {
 	} `codec:"issuer"`
 	MTP *merkletree.Proof `codec:"mtp"`
 }
+
+// BatchRevocationStatusRequest lists the revocation nonces to get the status of
+type BatchRevocationStatusRequest struct {
+	Nonces []uint64 `codec:"nonces"`
+}
+
+// BatchRevocationStatusResponse holds the status of every requested nonce, in the order of the request,
+// all against the same issuer state
+type BatchRevocationStatusResponse struct {
+	Issuer struct {
+		State              string `codec:"state,omitempty"`
+		RootOfRoots        string `codec:"root_of_roots,omitempty"`
+		ClaimsTreeRoot     string `codec:"claims_tree_root,omitempty"`
+		RevocationTreeRoot string `codec:"revocation_tree_root,omitempty"`
+	} `codec:"issuer"`
+	Statuses []*NonceRevocationStatus `codec:"statuses"`
+}
+
+type NonceRevocationStatus struct {
+	Nonce uint64            `codec:"nonce"`
+	MTP   *merkletree.Proof `codec:"mtp"`
+}
+
+// RevocationEntry is a nonce of the revocation tree
+type RevocationEntry struct {
+	Nonce uint64 `codec:"nonce"`
+}
+
+// ExportRevocationsResponse holds the nonces of the revocation tree, or the ones added since the requested root,
+// along with the root of the tree they were read from
+type ExportRevocationsResponse struct {
+	RevocationTreeRoot string             `codec:"revocation_tree_root"`
+	Revocations        []*RevocationEntry `codec:"revocations"`
+}
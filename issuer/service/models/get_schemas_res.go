@@ -0,0 +1,18 @@
+package models
+
+type GetSchemasResponse struct {
+	Schemas []*SupportedSchema `codec:"schemas"`
+}
+
+type SupportedSchema struct {
+	URL         string         `codec:"url"`
+	Type        string         `codec:"type"`
+	DisplayName string         `codec:"displayName"`
+	Fields      []*SchemaField `codec:"fields,omitempty"`
+}
+
+type SchemaField struct {
+	Name string `codec:"name"`
+	ID   string `codec:"id"`
+	Type string `codec:"type"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/iden3/go-schema-processor/verifiable"
+)
+
+// W3CCredential is a credential in the JSON-LD serialization of the W3C Verifiable Credentials Data Model
+type W3CCredential struct {
+	Context []string `codec:"@context"`
+	ID      string   `codec:"id"`
+	Type    []string `codec:"type"`
+	Issuer  string   `codec:"issuer"`
+	// IssuanceDate is nil for the credentials issued before the issuance date was recorded
+	IssuanceDate      *time.Time                   `codec:"issuanceDate,omitempty"`
+	ExpirationDate    *time.Time                   `codec:"expirationDate,omitempty"`
+	CredentialSubject map[string]interface{}       `codec:"credentialSubject"`
+	CredentialStatus  *verifiable.CredentialStatus `codec:"credentialStatus,omitempty"`
+	CredentialSchema  W3CCredentialSchema          `codec:"credentialSchema"`
+	// Proof holds the BJJ signature proof of the credential and, once the state including it is published, its MTP proof
+	Proof []interface{} `codec:"proof"`
+}
+
+type W3CCredentialSchema struct {
+	ID   string `codec:"id"`
+	Type string `codec:"type"`
+}
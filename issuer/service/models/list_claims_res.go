@@ -0,0 +1,9 @@
+package models
+
+type ListClaimsResponse struct {
+	Claims []*GetClaimResponse `codec:"claims"`
+	// Total is the number of the listed claims over all the pages
+	Total int `codec:"total"`
+	// Next is the id of the last listed claim, passed as after to get the next page. It is empty on the last page.
+	Next string `codec:"next,omitempty"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// PublishResponse is the job the transition to the latest state was queued with
+type PublishResponse struct {
+	JobID string `codec:"jobId"`
+}
+
+// PublishStatusResponse is the status of a queued state transition: queued, sending, sent or failed
+type PublishStatusResponse struct {
+	JobID string `codec:"jobId"`
+	State string `codec:"state"`
+	// TxHash is set once the transaction is sent and Error once the job failed
+	TxHash string `codec:"txHash,omitempty"`
+	Error  string `codec:"error,omitempty"`
+}
@@ -0,0 +1,24 @@
+package models
+
+// CredentialVerification tells whether a credential is still valid against the latest state of the issuer: the claim
+// is in the claims tree, its revocation nonce isn't in the revocation tree and it isn't expired. Valid is set when
+// all three checks pass.
+type CredentialVerification struct {
+	ID    string `codec:"id"`
+	Valid bool   `codec:"valid"`
+
+	Checks struct {
+		Inclusion  VerificationCheck `codec:"inclusion"`
+		NotRevoked VerificationCheck `codec:"notRevoked"`
+		NotExpired VerificationCheck `codec:"notExpired"`
+	} `codec:"checks"`
+
+	// State is the latest state of the issuer the checks were made against, published or not
+	State string `codec:"state"`
+}
+
+// VerificationCheck is the outcome of one of the checks of a credential verification
+type VerificationCheck struct {
+	Passed bool   `codec:"passed"`
+	Detail string `codec:"detail,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+// VerifyOnChainStateResponse compares the local states of the identity with its latest state in the state contract
+type VerifyOnChainStateResponse struct {
+	Identifier     string `codec:"identifier"`
+	LatestState    string `codec:"latestState"`
+	CommittedState string `codec:"committedState"`
+	// OnChainState is empty when the identity was never published
+	OnChainState   string `codec:"onChainState,omitempty"`
+	BlockNumber    uint64 `codec:"blockNumber,omitempty"`
+	BlockTimestamp uint64 `codec:"blockTimestamp,omitempty"`
+	// Match is true when the latest local state is the on-chain state, nothing is waiting to be published
+	Match bool `codec:"match"`
+	// CommittedMatch is true when the state the issuer considers committed is the on-chain state
+	CommittedMatch bool `codec:"committedMatch"`
+}
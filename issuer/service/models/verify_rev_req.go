@@ -0,0 +1,17 @@
+package models
+
+// VerifyRevocationStatusRequest is a revocation status, as returned by the revocation status endpoint,
+// together with the nonce it was requested for
+type VerifyRevocationStatusRequest struct {
+	Nonce  uint64                      `codec:"nonce"`
+	Status GetRevocationStatusResponse `codec:"status"`
+	// Format is the format the status was requested in, hex by default
+	Format string `codec:"format"`
+}
+
+// VerifyRevocationStatusResponse tells whether the revocation status is consistent and, if so, whether the nonce is revoked
+type VerifyRevocationStatusResponse struct {
+	Valid   bool   `codec:"valid"`
+	Revoked bool   `codec:"revoked"`
+	Reason  string `codec:"reason,omitempty"`
+}
@@ -0,0 +1,84 @@
+package schema
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/iden3/go-schema-processor/processor"
+	"github.com/patrickmn/go-cache"
+	"issuer/service/logging"
+)
+
+// SchemaCache keeps the loaded schema documents, keyed on the SHA1 hash of their URL. A shared
+// implementation, e.g. backed by Redis, is plugged in with Builder.WithSchemaCache
+type SchemaCache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, val []byte)
+}
+
+// MemorySchemaCache is the in-process SchemaCache, the entries expire after the TTL
+type MemorySchemaCache struct {
+	entries *cache.Cache
+}
+
+// NewMemorySchemaCache creates an in-process cache keeping the entries for the ttl
+func NewMemorySchemaCache(ttl time.Duration) *MemorySchemaCache {
+	return &MemorySchemaCache{entries: cache.New(ttl, 2*ttl)}
+}
+
+func (c *MemorySchemaCache) Get(key string) ([]byte, bool) {
+	v, ok := c.entries.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return v.([]byte), true
+}
+
+func (c *MemorySchemaCache) Set(key string, val []byte) {
+	c.entries.Set(key, val, cache.DefaultExpiration)
+}
+
+// schemaCacheKey is the hex SHA1 hash of the schema url
+func schemaCacheKey(url string) string {
+	h := sha1.Sum([]byte(url))
+	return hex.EncodeToString(h[:])
+}
+
+// cachedSchema is the cache entry, the extension is kept for picking the schema hash derivation on a hit
+type cachedSchema struct {
+	Schema    []byte `json:"schema"`
+	Extension string `json:"extension"`
+}
+
+// cachedLoader serves the schema from the cache, the wrapped loader downloads it on a miss
+type cachedLoader struct {
+	cache  SchemaCache
+	key    string
+	loader processor.SchemaLoader
+}
+
+func (l *cachedLoader) Load(ctx context.Context) (schema []byte, extension string, err error) {
+	if v, ok := l.cache.Get(l.key); ok {
+		var entry cachedSchema
+		if err = json.Unmarshal(v, &entry); err == nil {
+			return entry.Schema, entry.Extension, nil
+		}
+		logging.FromContext(ctx).WithError(err).Warnf("discarding the malformed cached schema %s", l.key)
+	}
+
+	schema, extension, err = l.loader.Load(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	v, err := json.Marshal(cachedSchema{Schema: schema, Extension: extension})
+	if err != nil {
+		return nil, "", err
+	}
+	l.cache.Set(l.key, v)
+
+	return schema, extension, nil
+}
@@ -0,0 +1,84 @@
+package schema
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// xsdNamespace is the IRI the compact xsd: prefix of the JSON-LD schemas expands to
+const xsdNamespace = "http://www.w3.org/2001/XMLSchema#"
+
+// CoerceData types the string values of the credential data after the fields the schema declares for the credential
+// type, for the data sent in a format without types, e.g. a form. The values of the integer and boolean fields are
+// parsed, the other ones stay strings, so "01234" keeps its leading zero in a string field. JSON schemas don't declare
+// the types of their fields, their data is returned as is.
+func (b *Builder) CoerceData(ctx context.Context, url, _type string, data []byte) ([]byte, error) {
+	loader, err := b.getLoader(url)
+	if err != nil {
+		return nil, err
+	}
+	schemaBytes, extension, err := loader.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	format, err := schemaFormat(extension)
+	if err != nil {
+		return nil, err
+	}
+	if format != JSONLD {
+		return data, nil
+	}
+
+	fields, err := describe(schemaBytes, url, _type)
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(fields))
+	for _, f := range fields {
+		types[f.Name] = strings.TrimPrefix(strings.TrimPrefix(f.Type, xsdNamespace), "xsd:")
+	}
+
+	values := make(map[string]interface{})
+	err = json.Unmarshal(data, &values)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSchemaValidation, err)
+	}
+	for name, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		values[name], err = coerceValue(s, types[name])
+		if err != nil {
+			return nil, fmt.Errorf("%w: field %s: %v", ErrSchemaValidation, name, err)
+		}
+	}
+
+	return json.Marshal(values)
+}
+
+// coerceValue parses the string as a value of the xsd type, the values of the types other than the integer and
+// boolean ones are kept as strings
+func coerceValue(s, xsdType string) (interface{}, error) {
+	switch xsdType {
+	case "integer", "int", "long", "short", "byte", "nonNegativeInteger", "positiveInteger",
+		"nonPositiveInteger", "negativeInteger", "unsignedLong", "unsignedInt", "unsignedShort", "unsignedByte":
+		i, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, fmt.Errorf("'%s' isn't an integer", s)
+		}
+		return json.Number(i.String()), nil
+	case "boolean":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' isn't a boolean", s)
+		}
+		return b, nil
+	default:
+		return s, nil
+	}
+}
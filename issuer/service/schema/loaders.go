@@ -0,0 +1,221 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/iden3/go-schema-processor/processor"
+	shell "github.com/ipfs/go-ipfs-api"
+	httpclient "issuer/http"
+	"issuer/service/logging"
+	"issuer/service/metrics"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrSchemaLoadBusy is returned when all the schema load slots are taken for longer than the queue timeout
+var ErrSchemaLoadBusy = errors.New("too many concurrent schema loads, try again later")
+
+// loadLimiter bounds the number of schema loads running at the same time
+type loadLimiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+func newLoadLimiter(size int, queueTimeout time.Duration) *loadLimiter {
+	return &loadLimiter{
+		slots:        make(chan struct{}, size),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// acquire waits for a free slot for at most the queue timeout, a 0 timeout waits as long as the context allows
+func (l *loadLimiter) acquire(ctx context.Context) error {
+	var expired <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		metrics.SchemaLoadsInFlight.Inc()
+		return nil
+	case <-expired:
+		return ErrSchemaLoadBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *loadLimiter) release() {
+	metrics.SchemaLoadsInFlight.Dec()
+	<-l.slots
+}
+
+// limitedLoader takes a slot of the limiter for the duration of the wrapped load
+type limitedLoader struct {
+	limiter *loadLimiter
+	loader  processor.SchemaLoader
+}
+
+func (l *limitedLoader) Load(ctx context.Context) (schema []byte, extension string, err error) {
+	if err = l.limiter.acquire(ctx); err != nil {
+		return nil, "", err
+	}
+	defer l.limiter.release()
+
+	return l.loader.Load(ctx)
+}
+
+// measuredLoader records the time the wrapped load took, whether it's served from the cache or downloaded
+type measuredLoader struct {
+	loader processor.SchemaLoader
+}
+
+func (l *measuredLoader) Load(ctx context.Context) (schema []byte, extension string, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ObserveSince(metrics.SchemaLoadDuration, start, err)
+	}()
+
+	return l.loader.Load(ctx)
+}
+
+// timeoutLoader bounds the wrapped load, so a slow host fails the load instead of holding it
+type timeoutLoader struct {
+	timeout time.Duration
+	loader  processor.SchemaLoader
+}
+
+func (l *timeoutLoader) Load(ctx context.Context) (schema []byte, extension string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+
+	return l.loader.Load(ctx)
+}
+
+// ipfsLoader cats the schema from the IPFS gateways in order, the next gateway is tried when one fails or doesn't
+// answer within the timeout
+type ipfsLoader struct {
+	gateways []string
+	cid      string
+	// timeout bounds the request to each gateway, 0 doesn't bound it
+	timeout time.Duration
+}
+
+func (l *ipfsLoader) Load(ctx context.Context) (schema []byte, extension string, err error) {
+	if l.cid == "" {
+		return nil, "", errors.New("CID is empty")
+	}
+
+	for i, gateway := range l.gateways {
+		schema, err = l.cat(ctx, gateway)
+		if err == nil {
+			logging.FromContext(ctx).Debugf("schema %s loaded from IPFS gateway %s", l.cid, gateway)
+			return schema, "json-ld", nil
+		}
+		if ctx.Err() != nil {
+			return nil, "", fmt.Errorf("loading schema %s from IPFS gateway %s: %w", l.cid, gateway, ctx.Err())
+		}
+		if i < len(l.gateways)-1 {
+			logging.FromContext(ctx).WithError(err).Warnf("IPFS gateway %s failed to serve schema %s, trying %s", gateway, l.cid, l.gateways[i+1])
+		}
+	}
+
+	return nil, "", fmt.Errorf("%w: no IPFS gateway served schema %s, last err: %v", ErrSchemaLoad, l.cid, err)
+}
+
+func (l *ipfsLoader) cat(ctx context.Context, gateway string) ([]byte, error) {
+	if l.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.timeout)
+		defer cancel()
+	}
+
+	res, err := shell.NewShell(gateway).Request("cat", l.cid).Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	buf := new(bytes.Buffer)
+	_, err = buf.ReadFrom(res.Output)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// arweaveLoader loads the schema stored by an Arweave transaction from the gateway, the path is the one of the
+// document within a path manifest
+type arweaveLoader struct {
+	client  *httpclient.Client
+	gateway string
+	txID    string
+	path    string
+}
+
+func (l *arweaveLoader) Load(ctx context.Context) (schema []byte, extension string, err error) {
+	if l.txID == "" {
+		return nil, "", errors.New("arweave transaction ID is empty")
+	}
+
+	schema, err = l.client.Get(ctx, strings.TrimSuffix(l.gateway, "/")+"/"+l.txID+l.path)
+	var statusErr *httpclient.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return nil, "", fmt.Errorf("%w on arweave: transaction %s%s isn't served by %s", ErrSchemaNotFound, l.txID, l.path, l.gateway)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: arweave gateway %s failed to serve transaction %s%s, err: %v", ErrSchemaLoad, l.gateway, l.txID, l.path, err)
+	}
+
+	if ext := path.Ext(l.path); ext != "" {
+		return schema, strings.TrimPrefix(ext, "."), nil
+	}
+	// the transactions carry no file name, the documents pinned there are JSON-LD like the IPFS ones
+	return schema, "json-ld", nil
+}
+
+// loadedSchema serves a schema document that is already loaded
+type loadedSchema struct {
+	schema    []byte
+	extension string
+}
+
+func (l *loadedSchema) Load(_ context.Context) (schema []byte, extension string, err error) {
+	return l.schema, l.extension, nil
+}
+
+// httpLoader loads schemas over http(s) by the issuer's http client, so the
+// schema fetches are retried according to the client's retry policy
+type httpLoader struct {
+	client *httpclient.Client
+	url    string
+}
+
+func (l *httpLoader) Load(ctx context.Context) (schema []byte, extension string, err error) {
+	u, err := url.Parse(l.url)
+	if err != nil {
+		return nil, "", err
+	}
+
+	schema, err = l.client.Get(ctx, u.String())
+	var statusErr *httpclient.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return nil, "", fmt.Errorf("%w: %v", ErrSchemaNotFound, err)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrSchemaLoad, err)
+	}
+
+	return schema, strings.TrimPrefix(path.Ext(u.Path), "."), nil
+}
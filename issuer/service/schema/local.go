@@ -0,0 +1,164 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalSchemasPath is the path the issuer serves its own schemas under
+const LocalSchemasPath = "/schemas/"
+
+// ErrLocalSchemaNotFound is returned when a schema the issuer should host isn't in the schemas directory,
+// it's an ErrSchemaNotFound
+var ErrLocalSchemaNotFound = fmt.Errorf("local %w", ErrSchemaNotFound)
+
+// LocalSchemas are the schema documents the issuer hosts itself, read from a directory. Their URLs are
+// the public url of the issuer followed by LocalSchemasPath and the file name.
+type LocalSchemas struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalSchemas returns nil if no directory is configured, the issuer doesn't host schemas then
+func NewLocalSchemas(dir, publicURL string) *LocalSchemas {
+	if dir == "" {
+		return nil
+	}
+
+	return &LocalSchemas{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(publicURL, "/") + LocalSchemasPath,
+	}
+}
+
+// URL returns the public url of the named schema, to reference it in the credentials
+func (s *LocalSchemas) URL(name string) string {
+	return s.baseURL + name
+}
+
+// resolve turns the bare file name of a hosted schema into its public url, any other url is returned as is
+func (s *LocalSchemas) resolve(_url string) string {
+	if s == nil || _url == "" || strings.ContainsAny(_url, ":/") {
+		return _url
+	}
+	return s.URL(_url)
+}
+
+// Read returns the document of the named schema and its extension
+func (s *LocalSchemas) Read(name string) ([]byte, string, error) {
+	// only plain file names, the schemas directory can't be escaped
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." {
+		return nil, "", fmt.Errorf("%w: invalid name '%s'", ErrLocalSchemaNotFound, name)
+	}
+
+	b, err := os.ReadFile(filepath.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", fmt.Errorf("%w: '%s'", ErrLocalSchemaNotFound, name)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return b, strings.TrimPrefix(path.Ext(name), "."), nil
+}
+
+// name returns the name of the schema if the url is the url of a schema the issuer hosts
+func (s *LocalSchemas) name(_url string) (string, bool) {
+	if s == nil || !strings.HasPrefix(_url, s.baseURL) {
+		return "", false
+	}
+	return strings.TrimPrefix(_url, s.baseURL), true
+}
+
+// SchemaFiles are the schema documents of the file:// urls, read from a base directory the paths can't leave
+type SchemaFiles struct {
+	dir string
+}
+
+// NewSchemaFiles returns nil if no directory is configured, the file:// urls aren't supported then
+func NewSchemaFiles(dir string) *SchemaFiles {
+	if dir == "" {
+		return nil
+	}
+	return &SchemaFiles{dir: dir}
+}
+
+// path resolves the path of the file:// url against the base directory, following the symlinks
+func (s *SchemaFiles) path(u *url.URL) (string, error) {
+	if s == nil {
+		return "", errors.New("file:// schemas aren't enabled, the schema_files_dir config parameter isn't set")
+	}
+
+	base, err := filepath.EvalSymlinks(s.dir)
+	if err != nil {
+		return "", err
+	}
+	base, err = filepath.Abs(base)
+	if err != nil {
+		return "", err
+	}
+
+	// file://kyc/age.json parses kyc as the host, file:///kyc/age.json has no host
+	p := filepath.FromSlash(path.Join(u.Host, u.Path))
+	if !filepath.IsAbs(p) || !strings.HasPrefix(p, base+string(filepath.Separator)) {
+		p = filepath.Join(base, p)
+	}
+	if !isWithin(base, p) {
+		return "", fmt.Errorf("schema '%s' is outside of the schema files directory", u)
+	}
+
+	resolved, err := filepath.EvalSymlinks(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: '%s'", ErrLocalSchemaNotFound, u)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !isWithin(base, resolved) {
+		return "", fmt.Errorf("schema '%s' is outside of the schema files directory", u)
+	}
+
+	return resolved, nil
+}
+
+// isWithin reports whether the path p is inside the directory dir
+func isWithin(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// fileLoader reads the schema of a file:// url from the schema files directory
+type fileLoader struct {
+	files *SchemaFiles
+	url   *url.URL
+}
+
+func (l *fileLoader) Load(_ context.Context) (schema []byte, extension string, err error) {
+	p, err := l.files.path(l.url)
+	if err != nil {
+		return nil, "", err
+	}
+
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return b, strings.TrimPrefix(filepath.Ext(p), "."), nil
+}
+
+// localLoader reads a schema hosted by the issuer from the schemas directory, instead of requesting it
+type localLoader struct {
+	schemas *LocalSchemas
+	name    string
+}
+
+func (l *localLoader) Load(_ context.Context) (schema []byte, extension string, err error) {
+	return l.schemas.Read(l.name)
+}
@@ -3,13 +3,23 @@ package schema
 import (
 	"context"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/ethereum/go-ethereum/crypto"
 	core "github.com/iden3/go-iden3-core"
+	jsonSuite "github.com/iden3/go-schema-processor/json"
 	jsonldSuite "github.com/iden3/go-schema-processor/json-ld"
 	"github.com/iden3/go-schema-processor/loaders"
 	"github.com/iden3/go-schema-processor/processor"
+	"github.com/iden3/go-schema-processor/utils"
+	httpclient "issuer/http"
+	"issuer/service/cfgs"
+	"issuer/service/logging"
+	"net/http"
 	"net/url"
+	"sort"
+	"strings"
+	"time"
 )
 
 const (
@@ -23,93 +33,326 @@ const (
 	// JSONLD JSON-LD schema format
 	JSONLD SchemaFormat = "json-ld"
 
-	//// JSON JSON schema format
-	//JSON SchemaFormat = "json"
+	// JSON JSON schema format
+	JSON SchemaFormat = "json"
 )
 
 type SchemaFormat string
 
+// ErrUnsupportedSchemaFormat is returned when the schema is neither a JSON-LD nor a JSON schema
+var ErrUnsupportedSchemaFormat = errors.New("unsupported schema format")
+
+// ErrSchemaHashMismatch is returned when the downloaded schema doesn't have the expected schema hash
+var ErrSchemaHashMismatch = errors.New("schema hash mismatch")
+
+var (
+	// ErrSchemaNotFound is returned when the host of the schema url doesn't have the schema
+	ErrSchemaNotFound = errors.New("schema not found")
+	// ErrSchemaLoad is returned when the host of the schema failed to serve it, or didn't answer
+	ErrSchemaLoad = errors.New("schema load failed")
+	// ErrSchemaValidation is returned when the credential data isn't valid against the schema
+	ErrSchemaValidation = errors.New("credential data doesn't match the schema")
+	// ErrUnsupportedScheme is returned when no loader supports the scheme of the schema url
+	ErrUnsupportedScheme = errors.New("unsupported schema url scheme")
+)
+
+// SchemaHasher derives the schema hash put in the claims of the credential type from the schema document
+type SchemaHasher func(schemaBytes []byte, credentialType string) core.SchemaHash
+
+// schemaFormat returns the format of the schema from the extension its loader reported, the schemas
+// served without an extension are JSON-LD
+func schemaFormat(extension string) (SchemaFormat, error) {
+	switch SchemaFormat(extension) {
+	case JSONLD, "jsonld", "":
+		return JSONLD, nil
+	case JSON:
+		return JSON, nil
+	default:
+		return "", fmt.Errorf("%w: '%s', the schema must be a .%s or a .%s document", ErrUnsupportedSchemaFormat, extension, JSONLD, JSON)
+	}
+}
+
+// FieldDescription describes a single credential subject field declared by a JSON-LD schema
+type FieldDescription struct {
+	Name string
+	ID   string
+	Type string
+}
+
+// ProcessorFactory creates the processor that loads the schema with the given loader, validates the
+// credential data against it and parses the data into slots
+type ProcessorFactory func(loader processor.SchemaLoader, credentialType string) *processor.Processor
+
+// JSONLDProcessorFactory creates a JSON-LD processor that puts one field per slot, it's the builder's default
+// for the JSON-LD schemas
+func JSONLDProcessorFactory(loader processor.SchemaLoader, credentialType string) *processor.Processor {
+	validator := jsonldSuite.Validator{ClaimType: credentialType}
+	parser := jsonldSuite.Parser{ClaimType: credentialType, ParsingStrategy: processor.OneFieldPerSlotStrategy}
+
+	return processor.InitProcessorOptions(&processor.Processor{},
+		processor.WithValidator(validator), processor.WithParser(parser), processor.WithSchemaLoader(loader))
+}
+
+// JSONProcessorFactory creates a JSON schema processor that puts one field per slot, it's the builder's default
+// for the JSON schemas. The slots of the fields are declared by the schema, so the credential type isn't used.
+func JSONProcessorFactory(loader processor.SchemaLoader, _ string) *processor.Processor {
+	validator := jsonSuite.Validator{}
+	parser := jsonSuite.Parser{ParsingStrategy: processor.OneFieldPerSlotStrategy}
+
+	return processor.InitProcessorOptions(&processor.Processor{},
+		processor.WithValidator(validator), processor.WithParser(parser), processor.WithSchemaLoader(loader))
+}
+
 type Builder struct {
-	ipfsUrl string
+	// ipfsGateways are the IPFS node followed by the fallback gateways
+	ipfsGateways       []string
+	arweaveGateway     string
+	loadTimeout        time.Duration
+	httpClient         *httpclient.Client
+	limiter            *loadLimiter
+	processorFactories map[SchemaFormat]ProcessorFactory
+	schemaHashers      map[SchemaFormat]SchemaHasher
+	localSchemas       *LocalSchemas
+	schemaFiles        *SchemaFiles
+	cache              SchemaCache
 }
 
-func NewBuilder(ipfsUrl string) *Builder {
+func NewBuilder(cfg *cfgs.IssuerConfig, httpClient *httpclient.Client) *Builder {
+	var schemaCache SchemaCache
+	if cfg.SchemaCacheTTL > 0 {
+		schemaCache = NewMemorySchemaCache(cfg.SchemaCacheTTL)
+	}
+
 	return &Builder{
-		ipfsUrl: ipfsUrl,
+		cache:          schemaCache,
+		ipfsGateways:   append([]string{cfg.IpfsUrl}, cfg.IpfsGateways...),
+		arweaveGateway: cfg.ArweaveGatewayUrl,
+		loadTimeout:    cfg.SchemaLoadTimeout,
+		httpClient:     httpClient,
+		limiter:        newLoadLimiter(cfg.SchemaLoadConcurrency, cfg.SchemaLoadQueueTimeout),
+		localSchemas:   NewLocalSchemas(cfg.SchemasDir, cfg.PublicUrl),
+		schemaFiles:    NewSchemaFiles(cfg.SchemaFilesDir),
+		processorFactories: map[SchemaFormat]ProcessorFactory{
+			JSONLD: JSONLDProcessorFactory,
+			JSON:   JSONProcessorFactory,
+		},
+		// the iden3 derivation is the same for both formats: the last 16 bytes of keccak256(schema || type)
+		schemaHashers: map[SchemaFormat]SchemaHasher{
+			JSONLD: utils.CreateSchemaHash,
+			JSON:   utils.CreateSchemaHash,
+		},
 	}
 }
 
-func (b *Builder) Process(url, _type string, data []byte) (*processor.ParsedSlots, string, error) {
-	schemaBytes, _, err := b.load(url)
+// WithSchemaHasher replaces the derivation of the schema hash for the schemas of the format
+func (b *Builder) WithSchemaHasher(format SchemaFormat, h SchemaHasher) *Builder {
+	b.schemaHashers[format] = h
+	return b
+}
+
+// WithSchemaCache replaces the cache of the downloaded schemas, nil disables the caching
+func (b *Builder) WithSchemaCache(c SchemaCache) *Builder {
+	b.cache = c
+	return b
+}
+
+// WithProcessorFactory replaces the factory of the processors used to process the credential data of the schemas
+// of the format, e.g. with one that plugs in a custom validator
+func (b *Builder) WithProcessorFactory(format SchemaFormat, f ProcessorFactory) *Builder {
+	b.processorFactories[format] = f
+	return b
+}
+
+// Process parses the data into the slots of the claim and returns them with the hex schema hash. When the expected
+// hash is given, a schema with another hash is rejected with ErrSchemaHashMismatch.
+func (b *Builder) Process(ctx context.Context, url, _type string, data []byte, expectedHash string) (*processor.ParsedSlots, string, error) {
+	logging.FromContext(ctx).Debugf("processing the data against schema %s of type %s", url, _type)
+
+	schemaBytes, format, slots, err := b.getParsedSlots(ctx, url, _type, data)
 	if err != nil {
 		return nil, "", err
 	}
 
-	slots, err := b.getParsedSlots(url, _type, data)
+	encodedSchema, err := b.createSchemaHash(schemaBytes, format, _type)
 	if err != nil {
 		return nil, "", err
 	}
-
-	encodedSchema := b.createSchemaHash(schemaBytes, _type)
+	if expectedHash != "" && !strings.EqualFold(strings.TrimPrefix(expectedHash, "0x"), encodedSchema) {
+		return nil, "", fmt.Errorf("%w: schema %s has hash %s, expected %s", ErrSchemaHashMismatch, url, encodedSchema, expectedHash)
+	}
 
 	return &slots, encodedSchema, nil
 }
 
+// Describe returns the fields the schema declares for the given credential type
+func (b *Builder) Describe(ctx context.Context, url, _type string) ([]FieldDescription, error) {
+	schemaBytes, _, err := b.load(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	return describe(schemaBytes, url, _type)
+}
+
+// describe returns the fields the JSON-LD schema document declares for the credential type
+func describe(schemaBytes []byte, url, _type string) ([]FieldDescription, error) {
+	var schemaContext jsonldSuite.SchemaContext
+	err := json.Unmarshal(schemaBytes, &schemaContext)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range schemaContext.Context {
+		data, ok := c[_type]
+		if !ok {
+			continue
+		}
+
+		dataBytes, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		claimSchema := jsonldSuite.ClaimSchema{}
+		err = json.Unmarshal(dataBytes, &claimSchema)
+		if err != nil {
+			return nil, err
+		}
+
+		fields := make([]FieldDescription, 0, len(claimSchema.Context))
+		for name, v := range claimSchema.Context {
+			field, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			f := FieldDescription{Name: name}
+			f.ID, _ = field["@id"].(string)
+			f.Type, _ = field["@type"].(string)
+			fields = append(fields, f)
+		}
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+
+		return fields, nil
+	}
+
+	return nil, fmt.Errorf("type %s is not declared in schema %s", _type, url)
+}
+
+// LocalSchemas returns the schemas the issuer hosts, nil if it doesn't host any
+func (b *Builder) LocalSchemas() *LocalSchemas {
+	return b.localSchemas
+}
+
+// ResolveURL returns the url a credential references its schema by. A schema the issuer hosts can be named by its
+// file name alone, e.g. kyc-v2.json-ld, it's referenced by its url under the public url of the issuer.
+func (b *Builder) ResolveURL(_url string) string {
+	return b.localSchemas.resolve(_url)
+}
+
+// getLoader returns the loader for the url, every load of which is recorded in the schema load duration
 func (b *Builder) getLoader(_url string) (processor.SchemaLoader, error) {
+	loader, err := b.newLoader(_url)
+	if err != nil {
+		return nil, err
+	}
+
+	return &measuredLoader{loader: loader}, nil
+}
+
+// newLoader returns the loader for the url, limited by the builder's concurrent load limit and load timeout and served
+// from the builder's cache when it's set. The schemas the issuer hosts and the file:// schemas are read from the disk directly.
+func (b *Builder) newLoader(_url string) (processor.SchemaLoader, error) {
+	if name, ok := b.localSchemas.name(_url); ok {
+		return &localLoader{schemas: b.localSchemas, name: name}, nil
+	}
+	if u, err := url.Parse(_url); err == nil && u.Scheme == "file" {
+		return &fileLoader{files: b.schemaFiles, url: u}, nil
+	}
+
+	loader, err := b.getSchemeLoader(_url)
+	if err != nil {
+		return nil, err
+	}
+
+	// the IPFS loader bounds the request to each of its gateways itself
+	if _, ok := loader.(*ipfsLoader); !ok && b.loadTimeout > 0 {
+		loader = &timeoutLoader{timeout: b.loadTimeout, loader: loader}
+	}
+	loader = &limitedLoader{limiter: b.limiter, loader: loader}
+	if b.cache == nil {
+		return loader, nil
+	}
+
+	return &cachedLoader{cache: b.cache, key: schemaCacheKey(_url), loader: loader}, nil
+}
+
+func (b *Builder) getSchemeLoader(_url string) (processor.SchemaLoader, error) {
 	schemaURL, err := url.Parse(_url)
 	if err != nil {
 		return nil, err
 	}
 	switch schemaURL.Scheme {
 	case "http", "https":
+		if b.httpClient != nil {
+			return &httpLoader{client: b.httpClient, url: _url}, nil
+		}
 		return &loaders.HTTP{URL: _url}, nil
 	case "ipfs":
-		return loaders.IPFS{
-			URL: b.ipfsUrl,
-			CID: schemaURL.Host,
-		}, nil
+		return &ipfsLoader{gateways: b.ipfsGateways, cid: schemaURL.Host, timeout: b.loadTimeout}, nil
+	case "ar", "arweave":
+		client := b.httpClient
+		if client == nil {
+			client = httpclient.NewClient(http.Client{})
+		}
+		return &arweaveLoader{client: client, gateway: b.arweaveGateway, txID: schemaURL.Host, path: schemaURL.Path}, nil
 	default:
-		return nil, fmt.Errorf("loader for %s is not supported", schemaURL.Scheme)
+		return nil, fmt.Errorf("%w: loader for %s is not supported", ErrUnsupportedScheme, schemaURL.Scheme)
 	}
 }
 
-func (b *Builder) getParsedSlots(schemaURL, credentialType string, dataBytes []byte) (processor.ParsedSlots, error) {
-	ctx := context.Background()
+// getParsedSlots loads the schema, validates the data against it and parses the data into slots with the processor
+// of the factory for the schema format. The loaded schema and its format are returned as well, for computing the schema hash.
+func (b *Builder) getParsedSlots(ctx context.Context, schemaURL, credentialType string, dataBytes []byte) ([]byte, SchemaFormat, processor.ParsedSlots, error) {
 	loader, err := b.getLoader(schemaURL)
 	if err != nil {
-		return processor.ParsedSlots{}, err
+		return nil, "", processor.ParsedSlots{}, err
 	}
-	var parser processor.Parser
-	var validator processor.Validator
-	pr := &processor.Processor{}
 
-	// for the case of schemaFormat := "json-ld"
-	validator = jsonldSuite.Validator{ClaimType: credentialType}
-	parser = jsonldSuite.Parser{ClaimType: credentialType, ParsingStrategy: processor.OneFieldPerSlotStrategy}
-	// TODO to remove
+	// the format is known from the loaded schema only, the processor is given the loaded document
+	schema, extension, err := loader.Load(ctx)
+	if err != nil {
+		return nil, "", processor.ParsedSlots{}, err
+	}
+	format, err := schemaFormat(extension)
+	if err != nil {
+		return nil, "", processor.ParsedSlots{}, err
+	}
+	factory, ok := b.processorFactories[format]
+	if !ok {
+		return nil, "", processor.ParsedSlots{}, fmt.Errorf("%w: no processor for the %s schema format", ErrUnsupportedSchemaFormat, format)
+	}
 
-	// TODO : it's better to use specific processor (e.g. jsonProcessor.New()), but in this case it's a better option
-	pr = processor.InitProcessorOptions(pr, processor.WithValidator(validator), processor.WithParser(parser), processor.WithSchemaLoader(loader))
+	pr := factory(&loadedSchema{schema: schema, extension: extension}, credentialType)
 
-	schema, _, err := pr.Load(ctx)
+	err = pr.ValidateData(dataBytes, schema)
 	if err != nil {
-		return processor.ParsedSlots{}, err
+		return nil, "", processor.ParsedSlots{}, fmt.Errorf("%w: %v", ErrSchemaValidation, err)
 	}
-	err = pr.ValidateData(dataBytes, schema)
+	slots, err := pr.ParseSlots(dataBytes, schema)
 	if err != nil {
-		return processor.ParsedSlots{}, err
+		return nil, "", processor.ParsedSlots{}, err
 	}
-	return pr.ParseSlots(dataBytes, schema)
+
+	return schema, format, slots, nil
 }
 
-func (b *Builder) load(schemaURL string) (schema []byte, extension string, err error) {
+func (b *Builder) load(ctx context.Context, schemaURL string) (schema []byte, extension string, err error) {
 	loader, err := b.getLoader(schemaURL)
 	if err != nil {
 		return nil, "", err
 	}
 
 	var schemaBytes []byte
-	schemaBytes, _, err = loader.Load(context.Background())
+	schemaBytes, _, err = loader.Load(ctx)
 	if err != nil {
 		return nil, "", err
 	}
@@ -117,9 +360,12 @@ func (b *Builder) load(schemaURL string) (schema []byte, extension string, err e
 	return schemaBytes, string(JSONLD), nil
 }
 
-func (b *Builder) createSchemaHash(schemaBytes []byte, credentialType string) string {
-	var sHash core.SchemaHash
-	h := crypto.Keccak256(schemaBytes, []byte(credentialType))
-	copy(sHash[:], h[len(h)-16:])
-	return hex.EncodeToString(sHash[:])
+func (b *Builder) createSchemaHash(schemaBytes []byte, format SchemaFormat, credentialType string) (string, error) {
+	hasher, ok := b.schemaHashers[format]
+	if !ok {
+		return "", fmt.Errorf("no schema hash derivation for the %s schema format", format)
+	}
+
+	sHash := hasher(schemaBytes, credentialType)
+	return hex.EncodeToString(sHash[:]), nil
 }
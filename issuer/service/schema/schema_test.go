@@ -0,0 +1,98 @@
+package schema
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/iden3/go-schema-processor/utils"
+	dto "github.com/prometheus/client_model/go"
+	"issuer/service/cfgs"
+	"issuer/service/metrics"
+	"testing"
+)
+
+// schemaHashVectors are schema hashes of known keccak256 hashes, the schema hash being the last 16 bytes of the hash
+// of the schema document followed by the credential type
+var schemaHashVectors = []struct {
+	name           string
+	schema         string
+	credentialType string
+	want           string
+}{
+	// keccak256 of the empty input
+	{"empty", "", "", "e500b653ca82273b7bfad8045d85a470"},
+	// keccak256("mimc"), the seed of the go-iden3-crypto MiMC7 constants
+	{"mimc", "mi", "mc", "fdcaa84304a70bd13f79b5d9f7951e9e"},
+	{"mimc type only", "", "mimc", "fdcaa84304a70bd13f79b5d9f7951e9e"},
+	{"mimc schema only", "mimc", "", "fdcaa84304a70bd13f79b5d9f7951e9e"},
+}
+
+func TestCreateSchemaHash(t *testing.T) {
+	for _, v := range schemaHashVectors {
+		t.Run(v.name, func(t *testing.T) {
+			got := utils.CreateSchemaHash([]byte(v.schema), v.credentialType)
+			if hex.EncodeToString(got[:]) != v.want {
+				t.Errorf("got the schema hash %x, want %s", got[:], v.want)
+			}
+		})
+	}
+}
+
+func TestBuilderSchemaHash(t *testing.T) {
+	b := NewBuilder(&cfgs.IssuerConfig{}, nil)
+
+	for _, format := range []SchemaFormat{JSONLD, JSON} {
+		for _, v := range schemaHashVectors {
+			got, err := b.createSchemaHash([]byte(v.schema), format, v.credentialType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != v.want {
+				t.Errorf("%s %s: got the schema hash %s, want %s", format, v.name, got, v.want)
+			}
+		}
+	}
+}
+
+// blockingLoader loads once started is signalled and done is closed
+type blockingLoader struct {
+	started chan struct{}
+	done    chan struct{}
+}
+
+func (l *blockingLoader) Load(ctx context.Context) ([]byte, string, error) {
+	close(l.started)
+	<-l.done
+	return []byte("{}"), string(JSON), nil
+}
+
+// TestSchemaLoadsInFlight checks the gauge counts the load holding a slot of the limiter while it runs
+func TestSchemaLoadsInFlight(t *testing.T) {
+	inFlight := func() float64 {
+		m := &dto.Metric{}
+		if err := metrics.SchemaLoadsInFlight.Write(m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetGauge().GetValue()
+	}
+
+	before := inFlight()
+	blocking := &blockingLoader{started: make(chan struct{}), done: make(chan struct{})}
+	loader := &limitedLoader{limiter: newLoadLimiter(1, 0), loader: blocking}
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := loader.Load(context.Background())
+		errCh <- err
+	}()
+
+	<-blocking.started
+	if got := inFlight(); got != before+1 {
+		t.Errorf("%v schema loads are in flight during the load, want %v", got, before+1)
+	}
+	close(blocking.done)
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	if got := inFlight(); got != before {
+		t.Errorf("%v schema loads are in flight after the load, want %v", got, before)
+	}
+}